@@ -1,15 +1,288 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/auth"
 	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	"github.com/VineethKanaparthi/receipt-processor/internal/ratelimit"
 	"github.com/VineethKanaparthi/receipt-processor/internal/server"
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	bolt "go.etcd.io/bbolt"
 )
 
-// main function initializes and runs the server
+// main function dispatches to the admin commands or initializes and runs the server
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			restore(os.Args[2:])
+			return
+		case "migrate":
+			migrate(os.Args[2:])
+			return
+		case "apikey":
+			createAPIKey(os.Args[2:])
+			return
+		case "golden":
+			golden(os.Args[2:])
+			return
+		}
+	}
+	serve(os.Args[1:])
+}
+
+// serve initializes and runs the server
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", ":8080", "address to serve requests on")
+	grpcAddr := flags.String("grpc-addr", ":9090", "address to serve gRPC requests on, disabled when empty")
+	dbname := flags.String("db", "receipts.db", "path to the bolt database")
+	snapshotDir := flags.String("snapshot-dir", "", "directory for scheduled snapshots, disabled when empty")
+	snapshotInterval := flags.Duration("snapshot-interval", time.Hour, "time between scheduled snapshots")
+	snapshotRetain := flags.Int("snapshot-retain", 24, "number of scheduled snapshots to keep, 0 keeps all")
+	jwks := flags.String("jwks", "", "JWKS file or local URL for validating user bearer tokens, disabled when empty")
+	jwtIssuer := flags.String("jwt-issuer", "", "required iss claim of bearer tokens")
+	jwtAudience := flags.String("jwt-audience", "", "required aud claim of bearer tokens")
+	rateLimit := flags.Float64("rate-limit", 5, "receipt submissions per second allowed per client, 0 disables rate limiting")
+	rateBurst := flags.Int("rate-burst", 20, "receipt submissions a client can burst above the rate limit")
+	retailerCap := flags.Int("max-receipts-per-retailer-per-day", 0, "receipts an account can submit per retailer per day, 0 disables the cap")
+	receiptCap := flags.Int("max-points-per-receipt", 0, "points a receipt can earn, 0 disables the cap")
+	ruleCaps := flags.String("max-points-per-rule", "", "points each rule can award a receipt as rule=points separated by commas, like item_description=100")
+	dailyPointsCap := flags.Int("max-points-per-account-per-day", 0, "points an account can earn per day, 0 disables the cap")
+	holdThreshold := flags.Int("hold-threshold", service.DefaultHoldThreshold, "risk score from 0 to 100 at which receipts are held instead of credited, 0 disables holding")
+	tierSpec := flags.String("tiers", "", "membership tiers as name:minPoints:multiplier, lowest first, like "+service.ExampleTiers+"; disabled when empty")
+	tierInterval := flags.Duration("tier-interval", time.Hour, "time between evaluations of every account's tier")
+	expiryMonths := flags.Int("points-expiry-months", 0, "months after they were earned that unspent points expire, 0 keeps them forever")
+	expiryInterval := flags.Duration("expiry-interval", time.Hour, "time between runs of the job expiring points")
+	workers := flags.Int("workers", 4, "number of background workers processing receipts")
+	webhookAttempts := flags.Int("webhook-attempts", 8, "delivery attempts before a webhook event is marked failed")
+	validateResponses := flags.Bool("validate-responses", false, "check responses against the OpenAPI spec and answer violations with a 500")
+	flags.Parse(args)
+
 	server := server.NewReceiptServer()
-	db := database.NewBoltDatabase("receipts.db")
+	db := database.NewBoltDatabase(*dbname)
+	defer db.Close()
 	server.DB = db
-	server.Run(":8080")
+	server.ValidateResponses = *validateResponses
+	if *rateLimit > 0 {
+		server.RateLimiter = ratelimit.New(*rateLimit, *rateBurst)
+	}
+	perRule, err := service.ParseRuleCaps(*ruleCaps)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy := service.Policy{
+		Limits:        service.Limits{MaxPerRetailerPerDay: *retailerCap},
+		Caps:          service.Caps{PerRule: perRule, PerReceipt: *receiptCap, PerAccountPerDay: *dailyPointsCap},
+		HoldThreshold: *holdThreshold,
+		ExpiryMonths:  *expiryMonths,
+	}
+	if *tierSpec != "" {
+		tiers, err := service.ParseTiers(*tierSpec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		policy.Tiers = tiers
+	}
+	server.Processor = service.NewProcessor(db, policy, *workers)
+	if err := server.Processor.Start(); err != nil {
+		log.Fatal(err)
+	}
+	defer server.Processor.Stop()
+
+	dispatcher := service.NewDispatcher(db)
+	dispatcher.MaxAttempts = *webhookAttempts
+	dispatcher.Start()
+	defer dispatcher.Stop()
+
+	if len(policy.Tiers) > 0 {
+		tierJob := service.NewTierJob(db, policy.Tiers)
+		tierJob.Interval = *tierInterval
+		tierJob.Start()
+		defer tierJob.Stop()
+	}
+
+	if policy.ExpiryMonths > 0 {
+		expiryJob := service.NewExpiryJob(db, policy.ExpiryMonths)
+		expiryJob.Interval = *expiryInterval
+		expiryJob.Start()
+		defer expiryJob.Stop()
+	}
+
+	if *jwks != "" {
+		verifier, err := auth.NewVerifier(*jwks, *jwtIssuer, *jwtAudience)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.JWT = verifier
+	}
+
+	if *snapshotDir != "" {
+		stop := database.ScheduleSnapshots(db, *snapshotDir, *snapshotInterval, *snapshotRetain)
+		defer stop()
+	}
+
+	if *grpcAddr != "" {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer := server.GRPC()
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				log.Println(err)
+			}
+		}()
+		defer grpcServer.GracefulStop()
+	}
+
+	if err := server.Run(*addr); err != nil {
+		log.Println(err)
+	}
+}
+
+// restore validates a snapshot and swaps it in as the database, the server must be stopped
+func restore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbname := flags.String("db", "receipts.db", "path to the bolt database to replace")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: receipt-processor restore [-db receipts.db] <snapshot>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err := database.Restore(*dbname, flags.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("restored %s from %s\n", *dbname, flags.Arg(0))
+}
+
+// migrate applies pending schema migrations, or only lists and test-runs them with -dry-run
+func migrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbname := flags.String("db", "receipts.db", "path to the bolt database to migrate")
+	dryRun := flags.Bool("dry-run", false, "run pending migrations in a transaction that is rolled back")
+	flags.Parse(args)
+
+	db, err := bolt.Open(*dbname, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("schema version %d\n", version)
+
+	migrations, err := database.Migrate(db, database.Migrations, *dryRun)
+	for _, migration := range migrations {
+		log.Printf("migration %d: %s\n", migration.Version, migration.Description)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun {
+		log.Printf("dry run: %d pending migrations succeeded and were rolled back\n", len(migrations))
+	}
+}
+
+// createAPIKey bootstraps an API key directly in the database, the server must be stopped
+func createAPIKey(args []string) {
+	flags := flag.NewFlagSet("apikey", flag.ExitOnError)
+	dbname := flags.String("db", "receipts.db", "path to the bolt database")
+	name := flags.String("name", "admin", "name describing the client")
+	scopes := flags.String("scopes", "admin", "comma separated scopes: submit, read, admin")
+	flags.Parse(args)
+
+	db := database.NewBoltDatabase(*dbname)
 	defer db.Close()
+
+	key, stored, err := service.CreateAPIKey(*name, strings.Split(*scopes, ","), db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("created api key %s for %s with scopes %v\n", stored.ID, stored.Name, stored.Scopes)
+	fmt.Println(key)
+}
+
+// golden scores the receipt files of a directory against a ruleset and compares their breakdowns with the golden files
+func golden(args []string) {
+	flags := flag.NewFlagSet("golden", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory of the *.receipt.json and *.golden.json files")
+	dbname := flags.String("db", "", "bolt database whose ruleset to run, opened read-only with the server stopped; the ruleset.json of the directory when empty")
+	update := flags.Bool("update", false, "write the golden files instead of comparing them")
+	flags.Parse(args)
+
+	report, err := runGolden(*dir, *dbname, *update)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, name := range report.Passed {
+		fmt.Printf("ok      %s\n", name)
+	}
+	for _, name := range report.Updated {
+		fmt.Printf("updated %s\n", name)
+	}
+	for _, failure := range report.Failed {
+		fmt.Printf("FAIL    %s: %s\n", failure.Name, failure.Reason)
+	}
+	fmt.Printf("%d passed, %d updated, %d failed\n", len(report.Passed), len(report.Updated), len(report.Failed))
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// runGolden runs the golden files against the ruleset of the database, or of the directory's ruleset.json
+// loaded into a temporary database that is removed before it returns
+func runGolden(dir, dbname string, update bool) (*service.GoldenReport, error) {
+	var db *bolt.DB
+	if dbname != "" {
+		// The database is only read, it is not created or migrated
+		if _, err := os.Stat(dbname); err != nil {
+			return nil, err
+		}
+		var err error
+		db, err = bolt.Open(dbname, 0600, &bolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		version, err := database.SchemaVersion(db)
+		if err != nil {
+			return nil, err
+		}
+		if latest := database.Migrations[len(database.Migrations)-1].Version; version != latest {
+			return nil, fmt.Errorf("%s is at schema version %d, run migrate to bring it to %d", dbname, version, latest)
+		}
+	} else {
+		tmp, err := os.MkdirTemp("", "golden")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		db = database.NewBoltDatabase(filepath.Join(tmp, "receipts.db"))
+		defer db.Close()
+		ruleset := filepath.Join(dir, service.RulesetFileName)
+		if _, err := os.Stat(ruleset); err == nil {
+			if err := service.LoadRulesetFile(ruleset, db); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return service.RunGoldenFiles(dir, update, db)
 }
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound is returned when no key in the set matches a token's kid.
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// jwk is the subset of RFC 7517 fields needed for RSA and P-256 signing keys
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// KeySet holds the public keys of a JWKS document loaded from a file or a local endpoint.
+type KeySet struct {
+	source string
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// LoadJWKS reads the JWKS document at source, an http(s) URL or a file path.
+func LoadJWKS(source string) (*KeySet, error) {
+	set := &KeySet{source: source, client: &http.Client{Timeout: 5 * time.Second}}
+	if err := set.Refresh(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Refresh reloads the keys from the source, keeping the current keys if loading fails.
+func (set *KeySet) Refresh() error {
+	data, err := set.read()
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	set.keys = keys
+	set.lastRefresh = time.Now()
+	return nil
+}
+
+// Key returns the public key with the given kid. An empty kid matches the only key of a single key set.
+func (set *KeySet) Key(kid string) (crypto.PublicKey, error) {
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	if kid == "" && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key, nil
+		}
+	}
+	key, ok := set.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+	return key, nil
+}
+
+// refreshIfStale reloads the keys when they are older than minAge, so rotated
+// keys are picked up without letting unknown kids hammer the source.
+func (set *KeySet) refreshIfStale(minAge time.Duration) {
+	set.mu.RLock()
+	stale := time.Since(set.lastRefresh) > minAge
+	set.mu.RUnlock()
+	if stale {
+		set.Refresh()
+	}
+}
+
+func (set *KeySet) read() ([]byte, error) {
+	if !strings.HasPrefix(set.source, "http://") && !strings.HasPrefix(set.source, "https://") {
+		return os.ReadFile(set.source)
+	}
+	resp, err := set.client.Get(set.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks from %s: %s", set.source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS decodes the signing keys of a JWKS document, keys for other uses are skipped
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("invalid jwks: no signing keys")
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("rsa exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
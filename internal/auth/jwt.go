@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidToken is returned for tokens that fail signature or claim validation.
+var ErrInvalidToken = errors.New("invalid token")
+
+// refreshInterval bounds how often an unknown kid triggers a JWKS reload
+const refreshInterval = time.Minute
+
+// Verifier validates RS256 and ES256 bearer tokens against a JWKS.
+type Verifier struct {
+	Keys *KeySet
+	// Issuer and Audience are checked when set
+	Issuer   string
+	Audience string
+}
+
+// NewVerifier loads the JWKS at source, a file path or a local http endpoint.
+func NewVerifier(source, issuer, audience string) (*Verifier, error) {
+	keys, err := LoadJWKS(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{Keys: keys, Issuer: issuer, Audience: audience}, nil
+}
+
+// Verify checks the token's signature and claims and returns its subject,
+// the loyalty account the user's receipts are credited to.
+func (v *Verifier) Verify(token string) (string, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if v.Issuer != "" {
+		options = append(options, jwt.WithIssuer(v.Issuer))
+	}
+	if v.Audience != "" {
+		options = append(options, jwt.WithAudience(v.Audience))
+	}
+
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, v.keyFunc, options...)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return "", fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+	return claims.Subject, nil
+}
+
+// keyFunc picks the verification key by kid, reloading the key set once if the kid is unknown
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := v.Keys.Key(kid)
+	if errors.Is(err, ErrKeyNotFound) {
+		v.Keys.refreshIfStale(refreshInterval)
+		key, err = v.Keys.Key(kid)
+	}
+	return key, err
+}
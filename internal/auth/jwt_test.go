@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func writeJWKS(t *testing.T, keys ...map[string]string) string {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": encodeBigInt(key.N), "e": encodeBigInt(big.NewInt(int64(key.E))),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": encodeBigInt(key.X), "y": encodeBigInt(key.Y),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	verifier, err := NewVerifier(writeJWKS(t, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey)), "https://app.example", "receipts")
+	assert.NoError(t, err)
+
+	valid := jwt.RegisteredClaims{
+		Subject:   "account-1",
+		Issuer:    "https://app.example",
+		Audience:  jwt.ClaimStrings{"receipts"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	wrongIssuer := valid
+	wrongIssuer.Issuer = "https://evil.example"
+	noExpiry := valid
+	noExpiry.ExpiresAt = nil
+	noSubject := valid
+	noSubject.Subject = ""
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"rs256", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, valid), true},
+		{"es256", sign(t, jwt.SigningMethodES256, "ec", ecKey, valid), true},
+		{"expired", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, expired), false},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, wrongIssuer), false},
+		{"no expiry", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, noExpiry), false},
+		{"no subject", sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, noSubject), false},
+		{"unknown signer", sign(t, jwt.SigningMethodRS256, "rsa", otherKey, valid), false},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "other", otherKey, valid), false},
+		{"hs256 is not allowed", sign(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), valid), false},
+		{"garbage", "not.a.token", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subject, err := verifier.Verify(test.token)
+			if test.valid {
+				assert.NoError(t, err)
+				assert.Equal(t, "account-1", subject)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestKeySetFromEndpoint(t *testing.T) {
+	first, _ := rsa.GenerateKey(rand.Reader, 2048)
+	second, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keys := []map[string]string{rsaJWK("first", first)}
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer endpoint.Close()
+
+	verifier, err := NewVerifier(endpoint.URL, "", "")
+	assert.NoError(t, err)
+
+	claims := jwt.RegisteredClaims{Subject: "account-1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	_, err = verifier.Verify(sign(t, jwt.SigningMethodRS256, "first", first, claims))
+	assert.NoError(t, err)
+
+	// A rotated key is picked up once the key set is old enough to be refreshed
+	keys = append(keys, rsaJWK("second", second))
+	token := sign(t, jwt.SigningMethodRS256, "second", second, claims)
+	verifier.Keys.lastRefresh = time.Now().Add(-2 * refreshInterval)
+	_, err = verifier.Verify(token)
+	assert.NoError(t, err)
+}
+
+func TestLoadJWKSRejectsInvalidKeys(t *testing.T) {
+	_, err := LoadJWKS(writeJWKS(t, map[string]string{"kty": "EC", "kid": "a", "crv": "P-384", "x": "AQ", "y": "AQ"}))
+	assert.Error(t, err)
+
+	_, err = LoadJWKS(writeJWKS(t, map[string]string{"kty": "EC", "kid": "a", "crv": "P-256", "x": "AQ", "y": "AQ"}))
+	assert.Error(t, err)
+
+	_, err = LoadJWKS(writeJWKS(t))
+	assert.Error(t, err)
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// snapshotPrefix and snapshotSuffix frame the file names written by Snapshot
+const (
+	snapshotPrefix = "receipts-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102T150405.000000000Z"
+)
+
+// ErrInvalidSnapshot is returned when a snapshot file is not a usable receipts database.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// Backup writes a consistent copy of the database to w using a read transaction,
+// so it can run while the server keeps accepting writes.
+func Backup(db *bolt.DB, w io.Writer) (int64, error) {
+	var n int64
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// ValidateSnapshot opens the snapshot read-only, runs bolt's consistency check
+// and makes sure it is a receipts database this binary can migrate.
+func ValidateSnapshot(path string) error {
+	snapshot, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: 1 * time.Second})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	defer snapshot.Close()
+
+	return snapshot.View(func(tx *bolt.Tx) error {
+		// Drain the whole channel so the checking goroutine can finish
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+			}
+		}
+		if checkErr != nil {
+			return checkErr
+		}
+		// Snapshots taken before migrations existed only have the points bucket
+		if tx.Bucket(MetaBucket) == nil && tx.Bucket([]byte("points")) == nil {
+			return fmt.Errorf("%w: not a receipts database", ErrInvalidSnapshot)
+		}
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		if latest := Migrations[len(Migrations)-1].Version; version > latest {
+			return fmt.Errorf("%w: schema version %d is newer than %d", ErrInvalidSnapshot, version, latest)
+		}
+		return nil
+	})
+}
+
+// Restore validates the snapshot and swaps it in place of the database at dbname.
+// The database must not be open by a running server. The previous file is kept
+// next to it with a .bak suffix.
+func Restore(dbname, snapshot string) error {
+	if err := ValidateSnapshot(snapshot); err != nil {
+		return err
+	}
+
+	// Bolt holds an exclusive lock while the server is running, so failing to
+	// open the target here means it is still in use.
+	if _, err := os.Stat(dbname); err == nil {
+		current, err := bolt.Open(dbname, 0600, &bolt.Options{Timeout: 1 * time.Second})
+		if err != nil {
+			return fmt.Errorf("database %s is in use or unreadable: %w", dbname, err)
+		}
+		current.Close()
+	}
+
+	tmp := dbname + ".restore"
+	if err := copyFile(snapshot, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if _, err := os.Stat(dbname); err == nil {
+		if err := os.Rename(dbname, dbname+".bak"); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, dbname)
+}
+
+// Snapshot writes a timestamped backup of the database into dir and returns its path.
+func Snapshot(db *bolt.DB, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	name := snapshotPrefix + time.Now().UTC().Format(snapshotLayout) + snapshotSuffix
+	path := filepath.Join(dir, name)
+
+	// Write to a temporary file first so a crash never leaves a partial snapshot
+	// that looks complete.
+	tmp := path + ".tmp"
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(tmp, 0600)
+	})
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, os.Rename(tmp, path)
+}
+
+// PruneSnapshots removes all but the newest retain snapshots in dir.
+func PruneSnapshots(dir string, retain int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	if len(snapshots) <= retain {
+		return nil
+	}
+	// The timestamp layout sorts lexically in chronological order
+	sort.Strings(snapshots)
+	for _, name := range snapshots[:len(snapshots)-retain] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduleSnapshots takes a snapshot into dir every interval, keeping the newest
+// retain files. It runs until the returned stop function is called.
+func ScheduleSnapshots(db *bolt.DB, dir string, interval time.Duration, retain int) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				path, err := Snapshot(db, dir)
+				if err != nil {
+					log.Printf("snapshot failed: %v\n", err)
+					continue
+				}
+				log.Printf("snapshot written to %s\n", path)
+				if retain > 0 {
+					if err := PruneSnapshots(dir, retain); err != nil {
+						log.Printf("pruning snapshots failed: %v\n", err)
+					}
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// copyFile copies src to dst and flushes it to disk.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
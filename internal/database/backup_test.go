@@ -0,0 +1,109 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func putRecord(t *testing.T, db *bolt.DB, id, record string) {
+	t.Helper()
+	err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(ReceiptsBucket).Put([]byte(id), []byte(record))
+	})
+	assert.NoError(t, err)
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	db := NewBoltDatabase(filepath.Join(dir, "source.db"))
+	putRecord(t, db, "a", `{"id":"a","points":28}`)
+
+	var buf bytes.Buffer
+	n, err := Backup(db, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	db.Close()
+
+	snapshot := filepath.Join(dir, "snapshot.db")
+	assert.NoError(t, os.WriteFile(snapshot, buf.Bytes(), 0600))
+	assert.NoError(t, ValidateSnapshot(snapshot))
+
+	target := filepath.Join(dir, "receipts.db")
+	db = NewBoltDatabase(target)
+	putRecord(t, db, "b", `{"id":"b","points":109}`)
+	db.Close()
+
+	assert.NoError(t, Restore(target, snapshot))
+	assert.FileExists(t, target+".bak")
+
+	db = NewBoltDatabase(target)
+	defer db.Close()
+	db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ReceiptsBucket)
+		assert.Equal(t, []byte(`{"id":"a","points":28}`), bucket.Get([]byte("a")))
+		assert.Nil(t, bucket.Get([]byte("b")))
+		return nil
+	})
+}
+
+func TestRestoreRejectsInvalidSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "receipts.db")
+	db := NewBoltDatabase(target)
+	putRecord(t, db, "a", `{"id":"a","points":28}`)
+	db.Close()
+
+	garbage := filepath.Join(dir, "garbage.db")
+	assert.NoError(t, os.WriteFile(garbage, []byte("not a bolt file"), 0600))
+	assert.ErrorIs(t, Restore(target, garbage), ErrInvalidSnapshot)
+
+	// A valid bolt file without the meta or points bucket is not a receipts snapshot
+	empty := filepath.Join(dir, "empty.db")
+	other, err := bolt.Open(empty, 0600, nil)
+	assert.NoError(t, err)
+	other.Close()
+	assert.ErrorIs(t, Restore(target, empty), ErrInvalidSnapshot)
+
+	assert.NoFileExists(t, target+".bak")
+}
+
+func TestRestoreRefusesOpenDatabase(t *testing.T) {
+	dir := t.TempDir()
+	source := NewBoltDatabase(filepath.Join(dir, "source.db"))
+	snapshot, err := Snapshot(source, filepath.Join(dir, "snapshots"))
+	source.Close()
+	assert.NoError(t, err)
+
+	target := filepath.Join(dir, "receipts.db")
+	db := NewBoltDatabase(target)
+	defer db.Close()
+	assert.Error(t, Restore(target, snapshot))
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	dir := t.TempDir()
+	db := NewBoltDatabase(filepath.Join(dir, "receipts.db"))
+	defer db.Close()
+
+	snapshots := filepath.Join(dir, "snapshots")
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path, err := Snapshot(db, snapshots)
+		assert.NoError(t, err)
+		assert.NoError(t, ValidateSnapshot(path))
+		paths = append(paths, path)
+	}
+
+	assert.NoError(t, PruneSnapshots(snapshots, 2))
+	entries, err := os.ReadDir(snapshots)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.NoFileExists(t, paths[0])
+	assert.NoFileExists(t, paths[1])
+	assert.FileExists(t, paths[3])
+}
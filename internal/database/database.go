@@ -7,18 +7,13 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
-// NewBoltDatabase initializes the database
+// NewBoltDatabase initializes the database and applies pending schema migrations
 func NewBoltDatabase(dbname string) *bolt.DB {
 	db, err := bolt.Open(dbname, 0600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
 		log.Fatal(err)
 	}
-	// Initialize the points bucket in the database
-	err = db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("points"))
-		return err
-	})
-	if err != nil {
+	if _, err := Migrate(db, Migrations, false); err != nil {
 		log.Fatal(err)
 	}
 
@@ -0,0 +1,512 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names shared by the database and service packages
+var (
+	MetaBucket        = []byte("meta")
+	ReceiptsBucket    = []byte("receipts")
+	APIKeysBucket     = []byte("api_keys")
+	DailyCountsBucket = []byte("daily_counts")
+	FingerprintBucket = []byte("fingerprints")
+	ReviewQueueBucket = []byte("review_queue")
+	QueueBucket       = []byte("queue")
+	InflightBucket    = []byte("inflight")
+	LedgerBucket      = []byte("ledger")
+	WebhooksBucket    = []byte("webhooks")
+	DeliveriesBucket  = []byte("webhook_deliveries")
+	PendingBucket     = []byte("webhook_pending")
+	FeedBucket        = []byte("feed")
+	// AccountReceiptsBucket indexes each account's receipts by submission time in a nested bucket per account
+	AccountReceiptsBucket = []byte("account_receipts")
+	RetailersBucket       = []byte("retailers")
+	// RetailerNamesBucket maps the normalized names and aliases of the registry to their retailer ID
+	RetailerNamesBucket = []byte("retailer_names")
+	CampaignsBucket     = []byte("campaigns")
+	ProductsBucket      = []byte("products")
+	// AccountTiersBucket holds the membership tier and tier history of each account
+	AccountTiersBucket = []byte("account_tiers")
+	CustomRulesBucket  = []byte("custom_rules")
+)
+
+// schemaVersionKey is the key in the meta bucket holding the applied schema version
+var schemaVersionKey = []byte("schema_version")
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// Migration is a single schema change, applied inside one write transaction.
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     func(tx *bolt.Tx) error
+}
+
+// Migrations lists every schema change in the order it has to be applied.
+// Append new migrations to the end with the next version number, never edit applied ones.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create the points bucket",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("points"))
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "move raw points values into receipt records",
+		Migrate:     migratePointsToRecords,
+	},
+	{
+		Version:     3,
+		Description: "create the api keys bucket",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(APIKeysBucket)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "create the daily submission counts bucket",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(DailyCountsBucket)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "mark existing receipts as scored and index their fingerprints",
+		Migrate:     migrateStatusAndFingerprints,
+	},
+	{
+		Version:     6,
+		Description: "move held receipts into the review queue",
+		Migrate:     migrateHeldToReviewQueue,
+	},
+	{
+		Version:     7,
+		Description: "create the processing queue and ledger buckets",
+		Migrate: func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{QueueBucket, InflightBucket, LedgerBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     8,
+		Description: "create the webhook subscription and delivery buckets",
+		Migrate: func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{WebhooksBucket, DeliveriesBucket, PendingBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     9,
+		Description: "create the feed bucket of processed receipts",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(FeedBucket)
+			return err
+		},
+	},
+	{
+		Version:     10,
+		Description: "index receipts by account",
+		Migrate:     migrateAccountReceipts,
+	},
+	{
+		Version:     11,
+		Description: "create the retailer registry buckets",
+		Migrate: func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{RetailersBucket, RetailerNamesBucket} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     12,
+		Description: "create the campaigns bucket",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(CampaignsBucket)
+			return err
+		},
+	},
+	{
+		Version:     13,
+		Description: "create the product catalog bucket",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(ProductsBucket)
+			return err
+		},
+	},
+	{
+		Version:     14,
+		Description: "create the account tiers bucket",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(AccountTiersBucket)
+			return err
+		},
+	},
+	{
+		Version:     15,
+		Description: "create the custom rules bucket",
+		Migrate: func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(CustomRulesBucket)
+			return err
+		},
+	},
+	{
+		Version:     16,
+		Description: "rebuild the fingerprint index with the canonical retailer names",
+		Migrate:     migrateCanonicalFingerprints,
+	},
+}
+
+// ReviewQueueKey orders the review queue by submission time, oldest first
+func ReviewQueueKey(createdAt time.Time, id string) []byte {
+	return TimeKey(createdAt, id)
+}
+
+// TimeKey orders receipts by submission time, oldest first
+func TimeKey(createdAt time.Time, id string) []byte {
+	return []byte(createdAt.UTC().Format("2006-01-02T15:04:05.000000000Z") + "|" + id)
+}
+
+// SchemaVersion returns the schema version recorded in the database, 0 for a database without one.
+func SchemaVersion(db *bolt.DB) (int, error) {
+	var version int
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+	return version, err
+}
+
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	bucket := tx.Bucket(MetaBucket)
+	if bucket == nil {
+		return 0, nil
+	}
+	data := bucket.Get(schemaVersionKey)
+	if data == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(data))
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	bucket, err := tx.CreateBucketIfNotExists(MetaBucket)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(schemaVersionKey, []byte(strconv.Itoa(version)))
+}
+
+// Migrate applies the migrations newer than the recorded schema version and returns the ones it applied.
+// Each migration commits together with its version bump. With dryRun, all pending migrations are
+// executed in a single transaction that is rolled back, so failures surface without changing the database.
+func Migrate(db *bolt.DB, migrations []Migration, dryRun bool) ([]Migration, error) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			return nil, fmt.Errorf("migration %d is out of order", migrations[i].Version)
+		}
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range migrations {
+		if migration.Version > current {
+			pending = append(pending, migration)
+		}
+	}
+	if len(migrations) > 0 && current > migrations[len(migrations)-1].Version {
+		return nil, fmt.Errorf("database schema version %d is newer than this binary supports", current)
+	}
+
+	if dryRun {
+		err := db.Update(func(tx *bolt.Tx) error {
+			for _, migration := range pending {
+				if err := applyMigration(tx, migration); err != nil {
+					return err
+				}
+			}
+			return errDryRun
+		})
+		if !errors.Is(err, errDryRun) {
+			return nil, err
+		}
+		return pending, nil
+	}
+
+	var applied []Migration
+	for _, migration := range pending {
+		err := db.Update(func(tx *bolt.Tx) error {
+			return applyMigration(tx, migration)
+		})
+		if err != nil {
+			return applied, err
+		}
+		log.Printf("applied migration %d: %s\n", migration.Version, migration.Description)
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+func applyMigration(tx *bolt.Tx, migration Migration) error {
+	if err := migration.Migrate(tx); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+	}
+	return setSchemaVersion(tx, migration.Version)
+}
+
+// migratePointsToRecords converts the decimal strings in the points bucket into
+// JSON receipt records in the receipts bucket and drops the points bucket.
+func migratePointsToRecords(tx *bolt.Tx) error {
+	receipts, err := tx.CreateBucketIfNotExists(ReceiptsBucket)
+	if err != nil {
+		return err
+	}
+	points := tx.Bucket([]byte("points"))
+	if points == nil {
+		return nil
+	}
+	err = points.ForEach(func(k, v []byte) error {
+		value, err := strconv.Atoi(string(v))
+		if err != nil {
+			return fmt.Errorf("points for %s: %w", k, err)
+		}
+		data, err := json.Marshal(model.ReceiptRecord{ID: string(k), Points: value})
+		if err != nil {
+			return err
+		}
+		return receipts.Put(k, data)
+	})
+	if err != nil {
+		return err
+	}
+	return tx.DeleteBucket([]byte("points"))
+}
+
+// migrateStatusAndFingerprints sets the scored status on records stored before
+// statuses existed and backfills the fingerprint index used by fraud scoring.
+func migrateStatusAndFingerprints(tx *bolt.Tx) error {
+	fingerprints, err := tx.CreateBucketIfNotExists(FingerprintBucket)
+	if err != nil {
+		return err
+	}
+	receipts := tx.Bucket(ReceiptsBucket)
+	// Bolt does not allow modifying a bucket while iterating it, collect the updates first
+	updates := map[string][]byte{}
+	err = receipts.ForEach(func(k, v []byte) error {
+		var record model.ReceiptRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("receipt %s: %w", k, err)
+		}
+		if record.Receipt != nil {
+			key := []byte(fingerprint(record.Receipt.Retailer, record.Receipt))
+			if fingerprints.Get(key) == nil {
+				if err := fingerprints.Put(key, k); err != nil {
+					return err
+				}
+			}
+		}
+		if record.Status != "" {
+			return nil
+		}
+		record.Status = model.StatusScored
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		updates[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, data := range updates {
+		if err := receipts.Put([]byte(k), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateHeldToReviewQueue renames the held status to pending_review and queues those receipts for review
+func migrateHeldToReviewQueue(tx *bolt.Tx) error {
+	queue, err := tx.CreateBucketIfNotExists(ReviewQueueBucket)
+	if err != nil {
+		return err
+	}
+	receipts := tx.Bucket(ReceiptsBucket)
+	updates := map[string][]byte{}
+	err = receipts.ForEach(func(k, v []byte) error {
+		var record model.ReceiptRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("receipt %s: %w", k, err)
+		}
+		if record.Status != "held" {
+			return nil
+		}
+		record.Status = model.StatusPendingReview
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		updates[string(k)] = data
+		return queue.Put(ReviewQueueKey(record.CreatedAt, record.ID), k)
+	})
+	if err != nil {
+		return err
+	}
+	for k, data := range updates {
+		if err := receipts.Put([]byte(k), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAccountReceipts indexes the existing receipts credited to an account
+func migrateAccountReceipts(tx *bolt.Tx) error {
+	index, err := tx.CreateBucketIfNotExists(AccountReceiptsBucket)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(ReceiptsBucket).ForEach(func(k, v []byte) error {
+		var record model.ReceiptRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("receipt %s: %w", k, err)
+		}
+		if record.AccountID == "" {
+			return nil
+		}
+		receipts, err := index.CreateBucketIfNotExists([]byte(record.AccountID))
+		if err != nil {
+			return err
+		}
+		return receipts.Put(TimeKey(record.CreatedAt, record.ID), k)
+	})
+}
+
+// migrateCanonicalFingerprints indexes the stored receipts again by the fingerprint of their canonical
+// retailer name, the first receipt submitted keeps a fingerprint. Receipts stored before the registry
+// are matched to it by their exact name or alias, the fuzzy matching on ingest is not repeated.
+func migrateCanonicalFingerprints(tx *bolt.Tx) error {
+	if err := tx.DeleteBucket(FingerprintBucket); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	fingerprints, err := tx.CreateBucket(FingerprintBucket)
+	if err != nil {
+		return err
+	}
+	var records []model.ReceiptRecord
+	err = tx.Bucket(ReceiptsBucket).ForEach(func(k, v []byte) error {
+		var record model.ReceiptRecord
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("receipt %s: %w", k, err)
+		}
+		if record.Receipt != nil {
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+	for _, record := range records {
+		retailer := record.Receipt.Retailer
+		if record.Receipt.CanonicalRetailer != nil {
+			retailer = record.Receipt.CanonicalRetailer.Name
+		} else if name, err := registryName(tx, retailer); err != nil {
+			return err
+		} else if name != "" {
+			retailer = name
+		}
+		key := []byte(fingerprint(retailer, record.Receipt))
+		if fingerprints.Get(key) != nil {
+			continue
+		}
+		if err := fingerprints.Put(key, []byte(record.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registryName is the canonical name of the registry retailer with the exact name or alias, empty when none has it
+func registryName(tx *bolt.Tx, name string) (string, error) {
+	id := tx.Bucket(RetailerNamesBucket).Get([]byte(registryKey(name)))
+	if id == nil {
+		return "", nil
+	}
+	data := tx.Bucket(RetailersBucket).Get(id)
+	if data == nil {
+		return "", nil
+	}
+	var retailer model.Retailer
+	if err := json.Unmarshal(data, &retailer); err != nil {
+		return "", fmt.Errorf("retailer %s: %w", id, err)
+	}
+	return retailer.Name, nil
+}
+
+// registryKey is the normalized name the registry indexes, copied from the service as it was when
+// migration 16 was written.
+func registryKey(name string) string {
+	abbreviations := map[string]string{
+		"mkt": "market", "mkts": "markets", "mrkt": "market", "co": "company", "corp": "corporation",
+		"intl": "international", "ctr": "center", "and": "", "the": "", "inc": "", "llc": "", "ltd": "",
+	}
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var key strings.Builder
+	for _, word := range words {
+		if expanded, ok := abbreviations[word]; ok {
+			word = expanded
+		}
+		key.WriteString(word)
+	}
+	return key.String()
+}
+
+// fingerprint hashes the receipt like Receipt.Fingerprint did with the retailer name. Migration 5
+// hashes the name sent and migration 16 the canonical one, neither follows later changes to Receipt.Fingerprint.
+func fingerprint(retailer string, receipt *model.Receipt) string {
+	retailer = strings.Join(strings.Fields(strings.ToLower(retailer)), " ")
+	sum := sha256.Sum256([]byte(retailer + "|" + receipt.PurchaseDate + "|" + receipt.PurchaseTime + "|" + receipt.Total))
+	return hex.EncodeToString(sum[:])
+}
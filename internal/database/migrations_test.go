@@ -0,0 +1,198 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openLegacyDatabase creates a database in the format used before migrations existed
+func openLegacyDatabase(t *testing.T, points map[string]string) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "receipts.db"), 0600, nil)
+	assert.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("points"))
+		if err != nil {
+			return err
+		}
+		for id, value := range points {
+			if err := bucket.Put([]byte(id), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return db
+}
+
+func TestMigrateLegacyPoints(t *testing.T) {
+	db := openLegacyDatabase(t, map[string]string{"a": "28", "b": "109"})
+	defer db.Close()
+
+	applied, err := Migrate(db, Migrations, false)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(Migrations))
+
+	version, err := SchemaVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, Migrations[len(Migrations)-1].Version, version)
+
+	db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("points")))
+		var record model.ReceiptRecord
+		assert.NoError(t, json.Unmarshal(tx.Bucket(ReceiptsBucket).Get([]byte("b")), &record))
+		assert.Equal(t, "b", record.ID)
+		assert.Equal(t, 109, record.Points)
+		assert.Equal(t, model.StatusScored, record.Status)
+		return nil
+	})
+
+	// Running again is a no-op
+	applied, err = Migrate(db, Migrations, false)
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	db := openLegacyDatabase(t, map[string]string{"a": "28"})
+	defer db.Close()
+
+	pending, err := Migrate(db, Migrations, true)
+	assert.NoError(t, err)
+	assert.Len(t, pending, len(Migrations))
+
+	version, err := SchemaVersion(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, []byte("28"), tx.Bucket([]byte("points")).Get([]byte("a")))
+		assert.Nil(t, tx.Bucket(ReceiptsBucket))
+		return nil
+	})
+}
+
+func TestMigrateStopsAtFailure(t *testing.T) {
+	db := openLegacyDatabase(t, map[string]string{"a": "not a number"})
+	defer db.Close()
+
+	_, err := Migrate(db, Migrations, true)
+	assert.Error(t, err)
+
+	applied, err := Migrate(db, Migrations, false)
+	assert.Error(t, err)
+	assert.Len(t, applied, 1)
+
+	// The failed migration rolled back, only the first one is recorded
+	version, _ := SchemaVersion(db)
+	assert.Equal(t, 1, version)
+	db.View(func(tx *bolt.Tx) error {
+		assert.NotNil(t, tx.Bucket([]byte("points")))
+		return nil
+	})
+}
+
+func TestMigrateRejectsBadOrdering(t *testing.T) {
+	db := openLegacyDatabase(t, nil)
+	defer db.Close()
+
+	noop := func(tx *bolt.Tx) error { return nil }
+	_, err := Migrate(db, []Migration{{Version: 2, Migrate: noop}, {Version: 1, Migrate: noop}}, false)
+	assert.Error(t, err)
+
+	failing := func(tx *bolt.Tx) error { return errors.New("boom") }
+	_, err = Migrate(db, []Migration{{Version: 1, Migrate: noop}, {Version: 2, Migrate: failing}}, false)
+	assert.Error(t, err)
+
+	// A database migrated by a newer binary is refused
+	_, err = Migrate(db, []Migration{{Version: 0, Migrate: noop}}, false)
+	assert.Error(t, err)
+}
+
+func TestMigrateHeldToReviewQueue(t *testing.T) {
+	db := openLegacyDatabase(t, nil)
+	defer db.Close()
+
+	// Bring the database to the version that still used the held status
+	_, err := Migrate(db, Migrations[:5], false)
+	assert.NoError(t, err)
+	held, _ := json.Marshal(model.ReceiptRecord{ID: "a", Points: 10, Status: "held"})
+	scored, _ := json.Marshal(model.ReceiptRecord{ID: "b", Points: 10, Status: model.StatusScored})
+	db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket(ReceiptsBucket).Put([]byte("a"), held)
+		return tx.Bucket(ReceiptsBucket).Put([]byte("b"), scored)
+	})
+
+	_, err = Migrate(db, Migrations, false)
+	assert.NoError(t, err)
+	db.View(func(tx *bolt.Tx) error {
+		var record model.ReceiptRecord
+		assert.NoError(t, json.Unmarshal(tx.Bucket(ReceiptsBucket).Get([]byte("a")), &record))
+		assert.Equal(t, model.StatusPendingReview, record.Status)
+		assert.Equal(t, 1, tx.Bucket(ReviewQueueBucket).Stats().KeyN)
+		return nil
+	})
+}
+
+func TestMigrateAccountReceipts(t *testing.T) {
+	db := openLegacyDatabase(t, nil)
+	defer db.Close()
+
+	_, err := Migrate(db, Migrations[:9], false)
+	assert.NoError(t, err)
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	owned, _ := json.Marshal(model.ReceiptRecord{ID: "a", AccountID: "alice", CreatedAt: createdAt})
+	anonymous, _ := json.Marshal(model.ReceiptRecord{ID: "b"})
+	db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket(ReceiptsBucket).Put([]byte("a"), owned)
+		return tx.Bucket(ReceiptsBucket).Put([]byte("b"), anonymous)
+	})
+
+	_, err = Migrate(db, Migrations, false)
+	assert.NoError(t, err)
+	db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(AccountReceiptsBucket)
+		assert.Equal(t, []byte("a"), index.Bucket([]byte("alice")).Get(TimeKey(createdAt, "a")))
+		assert.Equal(t, 1, index.Stats().BucketN-1)
+		return nil
+	})
+}
+
+func TestMigrateCanonicalFingerprints(t *testing.T) {
+	db := openLegacyDatabase(t, nil)
+	defer db.Close()
+
+	_, err := Migrate(db, Migrations[:15], false)
+	assert.NoError(t, err)
+	legacy := model.Receipt{Retailer: "M & M CORNER MKT", PurchaseDate: "2022-03-20", PurchaseTime: "14:33", Total: "9.00"}
+	older, _ := json.Marshal(model.ReceiptRecord{ID: "a", Receipt: &legacy, CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	newer, _ := json.Marshal(model.ReceiptRecord{ID: "b", Receipt: &legacy, CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)})
+	retailer, _ := json.Marshal(model.Retailer{ID: "mm-corner-market", Name: "M&M Corner Market"})
+	db.Update(func(tx *bolt.Tx) error {
+		tx.Bucket(ReceiptsBucket).Put([]byte("b"), newer)
+		tx.Bucket(ReceiptsBucket).Put([]byte("a"), older)
+		tx.Bucket(FingerprintBucket).Put([]byte(fingerprint(legacy.Retailer, &legacy)), []byte("a"))
+		tx.Bucket(RetailersBucket).Put([]byte("mm-corner-market"), retailer)
+		return tx.Bucket(RetailerNamesBucket).Put([]byte("mmcornermarket"), []byte("mm-corner-market"))
+	})
+
+	_, err = Migrate(db, Migrations, false)
+	assert.NoError(t, err)
+	// A resubmission matched to the registry has the fingerprint of the first receipt
+	resubmitted := legacy
+	resubmitted.Retailer = "M&M Corner Market"
+	resubmitted.CanonicalRetailer = &model.RetailerMatch{RetailerID: "mm-corner-market", Name: "M&M Corner Market", Match: model.RetailerMatchName}
+	db.View(func(tx *bolt.Tx) error {
+		fingerprints := tx.Bucket(FingerprintBucket)
+		assert.Equal(t, []byte("a"), fingerprints.Get([]byte(resubmitted.Fingerprint())))
+		assert.Equal(t, 1, fingerprints.Stats().KeyN)
+		return nil
+	})
+}
@@ -0,0 +1,70 @@
+package expr
+
+// node is a node of the syntax tree. The type checker sets the type of every node.
+type node interface {
+	position() int
+	typeOf() Type
+}
+
+// base holds the position and checked type shared by the nodes
+type base struct {
+	pos int
+	typ Type
+}
+
+func (b *base) position() int { return b.pos }
+func (b *base) typeOf() Type  { return b.typ }
+
+// literal is a number, string or boolean constant
+type literal struct {
+	base
+	value interface{}
+}
+
+// ident is a variable, like total
+type ident struct {
+	base
+	name string
+}
+
+// member is a field of a record variable, like retailer.canonical
+type member struct {
+	base
+	record *ident
+	field  string
+}
+
+// call is a call of a built-in function, like hour(purchase)
+type call struct {
+	base
+	name string
+	args []node
+	fn   *builtin
+}
+
+// unary is a negation, ! or -
+type unary struct {
+	base
+	op string
+	x  node
+}
+
+// binary is an arithmetic, comparison or logical operation
+type binary struct {
+	base
+	op   string
+	x, y node
+}
+
+// inRange tests whether a number lies within a range including both ends, like hour(purchase) in 14..16
+type inRange struct {
+	base
+	x, low, high node
+}
+
+// inList tests whether a value is one of a list, like retailer.canonical in ["target", "walmart"]
+type inList struct {
+	base
+	x     node
+	items []node
+}
@@ -0,0 +1,168 @@
+package expr
+
+import "fmt"
+
+// Type is the type of an expression
+type Type string
+
+// Types of the language
+const (
+	Number Type = "number"
+	String Type = "string"
+	Bool   Type = "bool"
+	Time   Type = "time"
+	// Record is the type of variables with fields, like retailer, which are not values themselves
+	Record Type = "record"
+)
+
+// Error is a compile or evaluation error at a byte offset of the source.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos+1, e.Msg)
+}
+
+func errorf(n node, format string, args ...interface{}) error {
+	return &Error{Pos: n.position(), Msg: fmt.Sprintf(format, args...)}
+}
+
+// check sets the type of every node of the tree, rejecting unknown names and mismatched operands
+func check(n node) error {
+	switch n := n.(type) {
+	case *literal:
+		switch n.value.(type) {
+		case float64:
+			n.typ = Number
+		case string:
+			n.typ = String
+		case bool:
+			n.typ = Bool
+		}
+	case *ident:
+		typ, ok := variables[n.name]
+		if !ok {
+			return errorf(n, "unknown variable %s", n.name)
+		}
+		n.typ = typ
+	case *member:
+		if err := check(n.record); err != nil {
+			return err
+		}
+		if n.record.typ != Record {
+			return errorf(n, "%s is a %s and has no fields", n.record.name, n.record.typ)
+		}
+		typ, ok := variables[n.record.name+"."+n.field]
+		if !ok {
+			return errorf(n, "%s has no field %s", n.record.name, n.field)
+		}
+		n.typ = typ
+	case *call:
+		fn, ok := builtins[n.name]
+		if !ok {
+			return errorf(n, "unknown function %s", n.name)
+		}
+		if len(n.args) != len(fn.params) {
+			return errorf(n, "%s takes %d arguments, not %d", n.name, len(fn.params), len(n.args))
+		}
+		for i, arg := range n.args {
+			if err := checkValue(arg); err != nil {
+				return err
+			}
+			if arg.typeOf() != fn.params[i] {
+				return errorf(arg, "argument %d of %s must be a %s, not a %s", i+1, n.name, fn.params[i], arg.typeOf())
+			}
+		}
+		n.fn = fn
+		n.typ = fn.result
+	case *unary:
+		if err := checkValue(n.x); err != nil {
+			return err
+		}
+		want := Number
+		if n.op == "!" {
+			want = Bool
+		}
+		if n.x.typeOf() != want {
+			return errorf(n, "%s needs a %s, not a %s", n.op, want, n.x.typeOf())
+		}
+		n.typ = want
+	case *binary:
+		return checkBinary(n)
+	case *inRange:
+		for _, operand := range []node{n.x, n.low, n.high} {
+			if err := checkValue(operand); err != nil {
+				return err
+			}
+			if operand.typeOf() != Number {
+				return errorf(operand, "ranges are of numbers, not a %s", operand.typeOf())
+			}
+		}
+		n.typ = Bool
+	case *inList:
+		if err := checkValue(n.x); err != nil {
+			return err
+		}
+		for _, item := range n.items {
+			if err := checkValue(item); err != nil {
+				return err
+			}
+			if item.typeOf() != n.x.typeOf() {
+				return errorf(item, "cannot look for a %s in a list with a %s", n.x.typeOf(), item.typeOf())
+			}
+		}
+		n.typ = Bool
+	}
+	return nil
+}
+
+// checkValue checks an operand, which must have a value so cannot be a record
+func checkValue(n node) error {
+	if err := check(n); err != nil {
+		return err
+	}
+	if n.typeOf() == Record {
+		return errorf(n, "%s is a record, use one of its fields", n.(*ident).name)
+	}
+	return nil
+}
+
+func checkBinary(n *binary) error {
+	if err := checkValue(n.x); err != nil {
+		return err
+	}
+	if err := checkValue(n.y); err != nil {
+		return err
+	}
+	x, y := n.x.typeOf(), n.y.typeOf()
+	if x != y {
+		return errorf(n, "cannot use %s on a %s and a %s", n.op, x, y)
+	}
+	switch n.op {
+	case "&&", "||":
+		if x != Bool {
+			return errorf(n, "%s needs bools, not %ss", n.op, x)
+		}
+		n.typ = Bool
+	case "==", "!=":
+		n.typ = Bool
+	case "<", "<=", ">", ">=":
+		if x == Bool {
+			return errorf(n, "cannot order bools with %s", n.op)
+		}
+		n.typ = Bool
+	case "+":
+		if x != Number && x != String {
+			return errorf(n, "+ needs numbers or strings, not %ss", x)
+		}
+		n.typ = x
+	default:
+		if x != Number {
+			return errorf(n, "%s needs numbers, not %ss", n.op, x)
+		}
+		n.typ = Number
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Program is a compiled expression, safe for concurrent use.
+type Program struct {
+	Source string
+	Type   Type
+	root   node
+}
+
+// Compile parses and type checks an expression, which must evaluate to the wanted type.
+// Errors are an *Error locating the problem in the source.
+func Compile(source string, want Type) (*Program, error) {
+	root, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkValue(root); err != nil {
+		return nil, err
+	}
+	if root.typeOf() != want {
+		return nil, &Error{Pos: 0, Msg: fmt.Sprintf("expression is a %s, it must be a %s", root.typeOf(), want)}
+	}
+	return &Program{Source: source, Type: want, root: root}, nil
+}
+
+// Eval evaluates the program against the receipt of the environment. It only reads the
+// environment, the errors it returns are runtime errors like a division by zero.
+func (p *Program) Eval(env *Env) (interface{}, error) {
+	return eval(p.root, env)
+}
+
+// Bool evaluates a program of type Bool.
+func (p *Program) Bool(env *Env) (bool, error) {
+	value, err := p.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+// Number evaluates a program of type Number, failing for infinite results.
+func (p *Program) Number(env *Env) (float64, error) {
+	value, err := p.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	number := value.(float64)
+	if math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, &Error{Pos: 0, Msg: "result is not a finite number"}
+	}
+	return number, nil
+}
+
+func eval(n node, env *Env) (interface{}, error) {
+	switch n := n.(type) {
+	case *literal:
+		return n.value, nil
+	case *ident:
+		return env.values[n.name], nil
+	case *member:
+		return env.values[n.record.name+"."+n.field], nil
+	case *call:
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			value, err := eval(arg, env)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = value
+		}
+		return n.fn.fn(env, args), nil
+	case *unary:
+		x, err := eval(n.x, env)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			return !x.(bool), nil
+		}
+		return -x.(float64), nil
+	case *binary:
+		return evalBinary(n, env)
+	case *inRange:
+		values := make([]float64, 3)
+		for i, operand := range []node{n.x, n.low, n.high} {
+			value, err := eval(operand, env)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value.(float64)
+		}
+		return values[1] <= values[0] && values[0] <= values[2], nil
+	case *inList:
+		x, err := eval(n.x, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range n.items {
+			value, err := eval(item, env)
+			if err != nil {
+				return nil, err
+			}
+			if equal(x, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return nil, errorf(n, "cannot evaluate %T", n)
+}
+
+func evalBinary(n *binary, env *Env) (interface{}, error) {
+	x, err := eval(n.x, env)
+	if err != nil {
+		return nil, err
+	}
+	// The logical operators only evaluate their right operand when it decides the result
+	switch n.op {
+	case "&&":
+		if !x.(bool) {
+			return false, nil
+		}
+		return eval(n.y, env)
+	case "||":
+		if x.(bool) {
+			return true, nil
+		}
+		return eval(n.y, env)
+	}
+	y, err := eval(n.y, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(x, y), nil
+	case "!=":
+		return !equal(x, y), nil
+	case "<":
+		return compare(x, y) < 0, nil
+	case "<=":
+		return compare(x, y) <= 0, nil
+	case ">":
+		return compare(x, y) > 0, nil
+	case ">=":
+		return compare(x, y) >= 0, nil
+	case "+":
+		if s, ok := x.(string); ok {
+			return s + y.(string), nil
+		}
+		return x.(float64) + y.(float64), nil
+	}
+
+	a, b := x.(float64), y.(float64)
+	switch n.op {
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/", "%":
+		if b == 0 {
+			return nil, errorf(n, "division by zero")
+		}
+		if n.op == "%" {
+			return math.Mod(a, b), nil
+		}
+		return a / b, nil
+	}
+	return nil, errorf(n, "unknown operator %s", n.op)
+}
+
+// equal compares two values of the same type
+func equal(x, y interface{}) bool {
+	if t, ok := x.(time.Time); ok {
+		return t.Equal(y.(time.Time))
+	}
+	return x == y
+}
+
+// compare orders two numbers, strings or times of the same type
+func compare(x, y interface{}) int {
+	switch x := x.(type) {
+	case float64:
+		switch b := y.(float64); {
+		case x < b:
+			return -1
+		case x > b:
+			return 1
+		}
+	case string:
+		return strings.Compare(x, y.(string))
+	case time.Time:
+		return x.Compare(y.(time.Time))
+	}
+	return 0
+}
@@ -0,0 +1,141 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReceipt() *model.Receipt {
+	return &model.Receipt{
+		Retailer:          "TARGET #1234",
+		PurchaseDate:      "2024-06-08",
+		PurchaseTime:      "15:30",
+		TimeZone:          "America/Chicago",
+		PurchaseOffset:    "-05:00",
+		Total:             "35.35",
+		CanonicalRetailer: &model.RetailerMatch{RetailerID: "target", Name: "Target", Match: model.RetailerMatchFuzzy},
+		Store:             &model.Store{City: "Chicago", Region: "IL", Country: "US"},
+		Items: []model.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49", Quantity: 2, Product: &model.ProductMatch{ProductID: "mtd-12", Name: "Mountain Dew 12 pack", Matcher: model.MatchExact}},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "22.37"},
+		},
+	}
+}
+
+func TestEval(t *testing.T) {
+	env, err := NewEnv(testReceipt())
+	assert.NoError(t, err)
+
+	tests := []struct {
+		source string
+		want   interface{}
+	}{
+		{`retailer.canonical == "target" && total >= 25.00 && hour(purchase) in 14..16`, true},
+		{`retailer.name`, "TARGET #1234"},
+		{`lower(retailer.name) + "!"`, "target #1234!"},
+		{`startsWith(retailer.name, "TARGET") && !contains(retailer.name, "Walmart")`, true},
+		{`store.region in ["IL", "WI"] && store.id == ""`, true},
+		{`total * 2`, 70.7},
+		{`floor(total / 10) * 5`, 15.0},
+		{`min(total, 20) + max(1, 2) - abs(-1)`, 21.0},
+		{`-total + 1 < 0`, true},
+		{`7 % 4`, 3.0},
+		{`1 + 2 * 3`, 7.0},
+		{`(1 + 2) * 3`, 9.0},
+		{`itemCount`, 3.0},
+		{`weekday(purchase) == 6 && day(purchase) == 8 && month(purchase) == 6 && year(purchase) == 2024`, true},
+		{`minute(purchase) in 0..29`, false},
+		{`hasItem("doritos") && !hasItem("pepsi")`, true},
+		{`hasProduct("mtd-12") && productUnits("mtd-12") == 2 && productUnits("pepsi") == 0`, true},
+		{`purchase == purchase && "a" < "b"`, true},
+		{`"say \"hi\""`, `say "hi"`},
+		// Short circuits skip the division by zero
+		{`false && 1 / 0 == 1`, false},
+		{`true || 1 / 0 == 1`, true},
+	}
+	for _, test := range tests {
+		root, err := parse(test.source)
+		if !assert.NoError(t, err, test.source) {
+			continue
+		}
+		assert.NoError(t, checkValue(root), test.source)
+		value, err := eval(root, env)
+		assert.NoError(t, err, test.source)
+		if number, ok := test.want.(float64); ok {
+			assert.InDelta(t, number, value, 1e-9, test.source)
+		} else {
+			assert.Equal(t, test.want, value, test.source)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   Type
+		err    string
+	}{
+		{`total >`, Bool, "column 8: unexpected end of expression"},
+		{`total >= 25 25`, Bool, `column 13: unexpected "25"`},
+		{`(total >= 25`, Bool, `column 13: expected ")", found end of expression`},
+		{`total # 2`, Number, `column 7: unexpected character "#"`},
+		{`"open`, String, "column 1: string is not terminated"},
+		{`"\q"`, String, `column 2: unknown escape \q`},
+		{`retailer.`, String, "column 10: expected a field name, found end of expression"},
+		{`totl > 1`, Bool, "column 1: unknown variable totl"},
+		{`retailer.id == "target"`, Bool, "column 1: retailer has no field id"},
+		{`total.cents`, Number, "column 1: total is a number and has no fields"},
+		{`retailer == "target"`, Bool, "column 1: retailer is a record, use one of its fields"},
+		{`now()`, Time, "column 1: unknown function now"},
+		{`hour(purchase, 1)`, Number, "column 1: hour takes 1 arguments, not 2"},
+		{`hour(total)`, Number, "column 6: argument 1 of hour must be a time, not a number"},
+		{`total == "25"`, Bool, "column 7: cannot use == on a number and a string"},
+		{`total && true`, Bool, "column 7: cannot use && on a number and a bool"},
+		{`true < false`, Bool, "column 6: cannot order bools with <"},
+		{`"a" * "b"`, String, "column 5: * needs numbers, not strings"},
+		{`!total`, Bool, "column 1: ! needs a bool, not a number"},
+		{`retailer.name in 1..2`, Bool, "column 1: ranges are of numbers, not a string"},
+		{`total in ["25"]`, Bool, "column 11: cannot look for a number in a list with a string"},
+		{`total in 1`, Bool, `column 11: expected "..", found end of expression`},
+		{`total`, Bool, "column 1: expression is a number, it must be a bool"},
+		{strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100), Number, "column 65: expression is nested deeper than 64 levels"},
+		{strings.Repeat("1+", MaxLength), Number, "column 4097: expression is longer than 4096 bytes"},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.source, test.want)
+		var compileErr *Error
+		if assert.ErrorAs(t, err, &compileErr, test.source) {
+			assert.Equal(t, test.err, err.Error(), test.source)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	env, err := NewEnv(testReceipt())
+	assert.NoError(t, err)
+
+	program, err := Compile(`total / (itemCount - 3)`, Number)
+	assert.NoError(t, err)
+	_, err = program.Number(env)
+	assert.EqualError(t, err, "column 7: division by zero")
+
+	program, err = Compile(`total % 0 > 1`, Bool)
+	assert.NoError(t, err)
+	_, err = program.Bool(env)
+	assert.EqualError(t, err, "column 7: division by zero")
+
+	program, err = Compile(`total * 10000`, Number)
+	assert.NoError(t, err)
+	points, err := program.Number(env)
+	assert.NoError(t, err)
+	assert.InDelta(t, 353500, points, 1e-6)
+
+	// Receipts the rules cannot read have no environment
+	receipt := testReceipt()
+	receipt.Total = "abc"
+	_, err = NewEnv(receipt)
+	assert.Error(t, err)
+}
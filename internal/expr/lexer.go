@@ -0,0 +1,131 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind is the kind of a lexical token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+// token is a lexical token, pos is its byte offset in the source
+type token struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(t.value.(string))
+	}
+	return strconv.Quote(t.text)
+}
+
+// operators lists the operators and punctuation, longest first so "<=" is not read as "<"
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "..", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+// lex splits the source into tokens, ending with a tokenEOF
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for pos := 0; pos < len(source); {
+		c := source[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			pos++
+		case c >= '0' && c <= '9':
+			end := pos
+			for end < len(source) && source[end] >= '0' && source[end] <= '9' {
+				end++
+			}
+			// A dot followed by a digit is a fraction, "14..16" is a range of integers
+			if end+1 < len(source) && source[end] == '.' && source[end+1] >= '0' && source[end+1] <= '9' {
+				end++
+				for end < len(source) && source[end] >= '0' && source[end] <= '9' {
+					end++
+				}
+			}
+			value, err := strconv.ParseFloat(source[pos:end], 64)
+			if err != nil {
+				return nil, &Error{Pos: pos, Msg: fmt.Sprintf("invalid number %q", source[pos:end])}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[pos:end], value: value, pos: pos})
+			pos = end
+		case c == '"':
+			value, end, err := lexString(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: source[pos:end], value: value, pos: pos})
+			pos = end
+		case isLetter(c):
+			end := pos
+			for end < len(source) && (isLetter(source[end]) || source[end] >= '0' && source[end] <= '9') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[pos:end], pos: pos})
+			pos = end
+		default:
+			operator := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[pos:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, &Error{Pos: pos, Msg: fmt.Sprintf("unexpected character %q", source[pos:pos+1])}
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: pos})
+			pos += len(operator)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// lexString reads the double quoted string starting at pos, with the escapes \" \\ \n and \t
+func lexString(source string, pos int) (string, int, error) {
+	var value strings.Builder
+	for end := pos + 1; end < len(source); end++ {
+		switch source[end] {
+		case '"':
+			return value.String(), end + 1, nil
+		case '\\':
+			end++
+			if end == len(source) {
+				break
+			}
+			switch source[end] {
+			case '"', '\\':
+				value.WriteByte(source[end])
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			default:
+				return "", 0, &Error{Pos: end - 1, Msg: fmt.Sprintf("unknown escape \\%c", source[end])}
+			}
+		default:
+			value.WriteByte(source[end])
+		}
+	}
+	return "", 0, &Error{Pos: pos, Msg: "string is not terminated"}
+}
+
+// isLetter reports whether c can start an identifier, identifiers are ASCII
+func isLetter(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
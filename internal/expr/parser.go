@@ -0,0 +1,245 @@
+package expr
+
+import "fmt"
+
+// Bounds keeping expressions small enough to check and evaluate cheaply
+const (
+	// MaxLength is the longest expression source in bytes
+	MaxLength = 4096
+	// maxDepth is the deepest nesting of the syntax tree
+	maxDepth = 64
+)
+
+// parser builds the syntax tree by recursive descent, from the loosest binding operator to the tightest:
+//
+//	or      = and { "||" and }
+//	and     = compare { "&&" compare }
+//	compare = sum [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) sum | "in" ( sum ".." sum | "[" list "]" ) ]
+//	sum     = product { ( "+" | "-" ) product }
+//	product = unary { ( "*" | "/" | "%" ) unary }
+//	unary   = ( "!" | "-" ) unary | primary
+//	primary = number | string | "true" | "false" | ident [ "." ident ] | ident "(" list ")" | "(" or ")"
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+func parse(source string) (node, error) {
+	if len(source) > MaxLength {
+		return nil, &Error{Pos: MaxLength, Msg: fmt.Sprintf("expression is longer than %d bytes", MaxLength)}
+	}
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+	}
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+// accept consumes the next token when it is the operator or keyword
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenOperator || t.kind == tokenIdent) && t.text == text {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		return &Error{Pos: t.pos, Msg: fmt.Sprintf("expected %q, found %s", text, t)}
+	}
+	return nil
+}
+
+// enter guards against expressions nested deeper than maxDepth
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return &Error{Pos: p.peek().pos, Msg: fmt.Sprintf("expression is nested deeper than %d levels", maxDepth)}
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+// binaryLevel parses operands joined by the operators, associating to the left
+func (p *parser) binaryLevel(operand func() (node, error), ops ...string) (node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		matched := ""
+		for _, op := range ops {
+			if t.kind == tokenOperator && t.text == op {
+				matched = op
+			}
+		}
+		if matched == "" {
+			return x, nil
+		}
+		p.next++
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{base: base{pos: t.pos}, op: matched, x: x, y: y}
+	}
+}
+
+func (p *parser) or() (node, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	return p.binaryLevel(p.and, "||")
+}
+
+func (p *parser) and() (node, error) {
+	return p.binaryLevel(p.compare, "&&")
+}
+
+func (p *parser) compare() (node, error) {
+	x, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokenOperator && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		p.next++
+		y, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return &binary{base: base{pos: t.pos}, op: t.text, x: x, y: y}, nil
+	case t.kind == tokenIdent && t.text == "in":
+		p.next++
+		if p.accept("[") {
+			items, err := p.list("]")
+			if err != nil {
+				return nil, err
+			}
+			return &inList{base: base{pos: t.pos}, x: x, items: items}, nil
+		}
+		low, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(".."); err != nil {
+			return nil, err
+		}
+		high, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		return &inRange{base: base{pos: t.pos}, x: x, low: low, high: high}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) sum() (node, error) {
+	return p.binaryLevel(p.product, "+", "-")
+}
+
+func (p *parser) product() (node, error) {
+	return p.binaryLevel(p.unary, "*", "/", "%")
+}
+
+func (p *parser) unary() (node, error) {
+	t := p.peek()
+	if t.kind == tokenOperator && (t.text == "!" || t.text == "-") {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		p.next++
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{base: base{pos: t.pos}, op: t.text, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.peek()
+	p.next++
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return &literal{base: base{pos: t.pos}, value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &literal{base: base{pos: t.pos}, value: t.text == "true"}, nil
+		case "in":
+			return nil, &Error{Pos: t.pos, Msg: `unexpected "in"`}
+		}
+		if p.accept("(") {
+			args, err := p.list(")")
+			if err != nil {
+				return nil, err
+			}
+			return &call{base: base{pos: t.pos}, name: t.text, args: args}, nil
+		}
+		variable := &ident{base: base{pos: t.pos}, name: t.text}
+		if p.accept(".") {
+			field := p.peek()
+			if field.kind != tokenIdent {
+				return nil, &Error{Pos: field.pos, Msg: fmt.Sprintf("expected a field name, found %s", field)}
+			}
+			p.next++
+			return &member{base: base{pos: t.pos}, record: variable, field: field.text}, nil
+		}
+		return variable, nil
+	case tokenOperator:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+}
+
+// list parses expressions separated by commas up to the closing operator
+func (p *parser) list(closing string) ([]node, error) {
+	var items []node
+	if p.accept(closing) {
+		return items, nil
+	}
+	for {
+		item, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.accept(closing) {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+)
+
+// variables are the receipt fields expressions can read, with their types. Fields of
+// records are named record.field.
+var variables = map[string]Type{
+	"retailer": Record,
+	// retailer.name is the retailer as printed on the receipt
+	"retailer.name": String,
+	// retailer.canonical is the ID of the registry retailer, empty when the retailer is not in the registry
+	"retailer.canonical": String,
+	"total":              Number,
+	// purchase is the purchase date and time on the store's clock
+	"purchase": Time,
+	// itemCount is the number of items bought, counting quantities
+	"itemCount":        Number,
+	"store":            Record,
+	"store.id":         String,
+	"store.city":       String,
+	"store.region":     String,
+	"store.postalCode": String,
+	"store.country":    String,
+}
+
+// Env is the receipt an expression is evaluated against.
+type Env struct {
+	receipt *model.Receipt
+	values  map[string]interface{}
+}
+
+// NewEnv reads the variables of the receipt, which must have a valid total and purchase time.
+func NewEnv(receipt *model.Receipt) (*Env, error) {
+	total, err := strconv.ParseFloat(receipt.Total, 64)
+	if err != nil {
+		return nil, fmt.Errorf("total %q is not a number", receipt.Total)
+	}
+	purchase, err := receipt.LocalPurchaseTime()
+	if err != nil {
+		return nil, err
+	}
+	canonical := ""
+	if receipt.CanonicalRetailer != nil {
+		canonical = receipt.CanonicalRetailer.RetailerID
+	}
+	store := receipt.Store
+	if store == nil {
+		store = &model.Store{}
+	}
+	return &Env{receipt: receipt, values: map[string]interface{}{
+		"retailer.name":      receipt.Retailer,
+		"retailer.canonical": canonical,
+		"total":              total,
+		"purchase":           purchase,
+		"itemCount":          float64(receipt.ItemCount()),
+		"store.id":           store.ID,
+		"store.city":         store.City,
+		"store.region":       store.Region,
+		"store.postalCode":   store.PostalCode,
+		"store.country":      store.Country,
+	}}, nil
+}
+
+// builtin is a function expressions can call. Functions are pure, they only read their arguments and the receipt.
+type builtin struct {
+	params []Type
+	result Type
+	fn     func(env *Env, args []interface{}) interface{}
+}
+
+// builtins are the functions of the language
+var builtins = map[string]*builtin{
+	"hour":    timePart(func(t time.Time) int { return t.Hour() }),
+	"minute":  timePart(func(t time.Time) int { return t.Minute() }),
+	"day":     timePart(func(t time.Time) int { return t.Day() }),
+	"month":   timePart(func(t time.Time) int { return int(t.Month()) }),
+	"year":    timePart(func(t time.Time) int { return t.Year() }),
+	"weekday": timePart(func(t time.Time) int { return int(t.Weekday()) }),
+
+	"lower":      stringFunction(strings.ToLower),
+	"upper":      stringFunction(strings.ToUpper),
+	"contains":   stringTest(strings.Contains),
+	"startsWith": stringTest(strings.HasPrefix),
+	"endsWith":   stringTest(strings.HasSuffix),
+
+	"round": numberFunction(math.Round),
+	"floor": numberFunction(math.Floor),
+	"ceil":  numberFunction(math.Ceil),
+	"abs":   numberFunction(math.Abs),
+	"min": {params: []Type{Number, Number}, result: Number, fn: func(env *Env, args []interface{}) interface{} {
+		return math.Min(args[0].(float64), args[1].(float64))
+	}},
+	"max": {params: []Type{Number, Number}, result: Number, fn: func(env *Env, args []interface{}) interface{} {
+		return math.Max(args[0].(float64), args[1].(float64))
+	}},
+
+	// hasItem tests whether an item's description contains the text, ignoring case
+	"hasItem": {params: []Type{String}, result: Bool, fn: func(env *Env, args []interface{}) interface{} {
+		text := strings.ToLower(args[0].(string))
+		for _, item := range env.receipt.Items {
+			if strings.Contains(strings.ToLower(item.ShortDescription), text) {
+				return true
+			}
+		}
+		return false
+	}},
+	// hasProduct tests whether an item matched the catalog product with the ID
+	"hasProduct": {params: []Type{String}, result: Bool, fn: func(env *Env, args []interface{}) interface{} {
+		return productUnits(env.receipt, args[0].(string)) > 0
+	}},
+	// productUnits counts the units bought of the catalog product with the ID
+	"productUnits": {params: []Type{String}, result: Number, fn: func(env *Env, args []interface{}) interface{} {
+		return float64(productUnits(env.receipt, args[0].(string)))
+	}},
+}
+
+func productUnits(receipt *model.Receipt, id string) int {
+	units := 0
+	for i := range receipt.Items {
+		if product := receipt.Items[i].Product; product != nil && product.ProductID == id {
+			units += receipt.Items[i].Count()
+		}
+	}
+	return units
+}
+
+func timePart(part func(time.Time) int) *builtin {
+	return &builtin{params: []Type{Time}, result: Number, fn: func(env *Env, args []interface{}) interface{} {
+		return float64(part(args[0].(time.Time)))
+	}}
+}
+
+func stringFunction(f func(string) string) *builtin {
+	return &builtin{params: []Type{String}, result: String, fn: func(env *Env, args []interface{}) interface{} {
+		return f(args[0].(string))
+	}}
+}
+
+func stringTest(test func(s, substr string) bool) *builtin {
+	return &builtin{params: []Type{String, String}, result: Bool, fn: func(env *Env, args []interface{}) interface{} {
+		return test(args[0].(string), args[1].(string))
+	}}
+}
+
+func numberFunction(f func(float64) float64) *builtin {
+	return &builtin{params: []Type{Number}, result: Number, fn: func(env *Env, args []interface{}) interface{} {
+		return f(args[0].(float64))
+	}}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds of the days query parameter of GET /accounts/:id/expiring
+const (
+	defaultExpiringDays = 30
+	maxExpiringDays     = 366
+)
+
+// ExpiringPointsResponse is the response of GET /accounts/:id/expiring
+type ExpiringPointsResponse struct {
+	AccountID string `json:"accountId"`
+	Balance   int    `json:"balance"`
+	// ExpiringBy is the end of the window the points expire in
+	ExpiringBy time.Time `json:"expiringBy"`
+	// Points is the sum of the lots
+	Points int              `json:"points"`
+	Lots   []model.PointLot `json:"lots"`
+}
+
+// RedemptionRequest is the payload of POST /admin/accounts/:id/redemptions
+type RedemptionRequest struct {
+	Points int `json:"points" binding:"required,min=1"`
+}
+
+// RedemptionResponse is the response of POST /admin/accounts/:id/redemptions
+type RedemptionResponse struct {
+	Entry   model.LedgerEntry `json:"entry"`
+	Balance int               `json:"balance"`
+}
+
+// getExpiringPoints lists the account's unspent points expiring within the next days.
+// Users authenticated by a token can only see their own account.
+func (rs *ReceiptServer) getExpiringPoints(c *gin.Context) {
+	id := c.Params.ByName("id")
+	if account := c.GetString(accountKey); account != "" && account != id {
+		handleError(c, http.StatusNotFound, CodeNotFound, "account not found")
+		return
+	}
+	days := defaultExpiringDays
+	if value := c.Query("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > maxExpiringDays {
+			handleValidationError(c, &FieldError{In: "query", Field: "days", Message: "must be a number of days from 1 to 366"})
+			return
+		}
+	}
+
+	by := time.Now().UTC().AddDate(0, 0, days)
+	lots, err := service.ListExpiringPoints(id, rs.Processor.Policy.ExpiryMonths, by, rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list expiring points")
+		return
+	}
+	balance, err := service.GetBalance(id, rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to get the balance")
+		return
+	}
+	response := ExpiringPointsResponse{AccountID: id, Balance: balance, ExpiringBy: by, Lots: lots}
+	for _, lot := range lots {
+		response.Points += lot.Points
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// redeemPoints spends points of the account, its oldest points first
+func (rs *ReceiptServer) redeemPoints(c *gin.Context) {
+	var request RedemptionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	entry, balance, err := service.RedeemPoints(c.Params.ByName("id"), request.Points, rs.DB)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRedemption):
+			handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		case errors.Is(err, service.ErrInsufficientPoints):
+			handleError(c, http.StatusConflict, CodeInsufficientPoints, err.Error())
+		default:
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to redeem the points")
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, RedemptionResponse{Entry: *entry, Balance: balance})
+}
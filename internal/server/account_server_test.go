@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPointsExpiryAndRedemption(t *testing.T) {
+	server := newTestServer(t, service.Policy{ExpiryMonths: 12})
+	tokenFor := enableBearerTokens(t, server)
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+
+	request := func(method, path, authorization, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("POST", "/receipts/process", tokenFor("alice"), "", simpleReceiptJSON).Code)
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	// Points earned now expire in a year
+	var expiring ExpiringPointsResponse
+	w := request("GET", "/accounts/alice/expiring", tokenFor("alice"), "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expiring))
+	assert.Equal(t, 31, expiring.Balance)
+	assert.Equal(t, 0, expiring.Points)
+	assert.Empty(t, expiring.Lots)
+
+	w = request("GET", "/accounts/alice/expiring?days=366", tokenFor("alice"), "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expiring))
+	assert.Equal(t, 31, expiring.Points)
+	assert.Len(t, expiring.Lots, 1)
+
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/accounts/alice/expiring?days=0", tokenFor("alice"), "", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/accounts/alice/expiring", tokenFor("bob"), "", "").Code)
+
+	// Redemptions need an admin key and cannot overdraw the account
+	assert.Equal(t, http.StatusForbidden, request("POST", "/admin/accounts/alice/redemptions", tokenFor("alice"), "", `{"points": 10}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/accounts/alice/redemptions", "", adminKey, `{"points": 0}`).Code)
+	w = request("POST", "/admin/accounts/alice/redemptions", "", adminKey, `{"points": 50}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), CodeInsufficientPoints)
+
+	var redemption RedemptionResponse
+	w = request("POST", "/admin/accounts/alice/redemptions", "", adminKey, `{"points": 20}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &redemption))
+	assert.Equal(t, 11, redemption.Balance)
+	assert.Equal(t, model.LedgerRedemption, redemption.Entry.Type)
+	assert.Equal(t, -20, redemption.Entry.Points)
+
+	w = request("GET", "/accounts/alice/expiring?days=366", "", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expiring))
+	assert.Equal(t, 11, expiring.Points)
+}
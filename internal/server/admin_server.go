@@ -0,0 +1,160 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// getBackup streams a consistent hot backup of the database as a file download
+func (rs *ReceiptServer) getBackup(c *gin.Context) {
+	filename := fmt.Sprintf("receipts-%s.db", time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	if _, err := database.Backup(rs.DB, c.Writer); err != nil {
+		// Headers are already sent at this point, all we can do is log and abort
+		log.Printf("backup failed: %v\n", err)
+		c.Abort()
+	}
+}
+
+// CreateAPIKeyRequest is the payload of POST /admin/keys
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// CreateAPIKeyResponse returns the plaintext key once, it is only stored hashed
+type CreateAPIKeyResponse struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+func (rs *ReceiptServer) createAPIKey(c *gin.Context) {
+	var request CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	plaintext, key, err := service.CreateAPIKey(request.Name, request.Scopes, rs.DB)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidScope) {
+			handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		} else {
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to create the api key")
+		}
+		return
+	}
+
+	key.SecretHash = ""
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: *key, Key: plaintext})
+}
+
+func (rs *ReceiptServer) listAPIKeys(c *gin.Context) {
+	keys, err := service.ListAPIKeys(rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list api keys")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (rs *ReceiptServer) revokeAPIKey(c *gin.Context) {
+	err := service.RevokeAPIKey(c.Params.ByName("id"), rs.DB)
+	if err != nil {
+		if errors.Is(err, service.ErrIdNotFound) {
+			handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+		} else {
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to revoke the api key")
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ReviewRequest is the optional payload of the review decision endpoints
+type ReviewRequest struct {
+	Notes string `json:"notes"`
+}
+
+func (rs *ReceiptServer) listReviews(c *gin.Context) {
+	records, err := service.ListPendingReviews(rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list the review queue")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reviews": records})
+}
+
+func (rs *ReceiptServer) approveReview(c *gin.Context) {
+	rs.reviewReceipt(c, true)
+}
+
+func (rs *ReceiptServer) rejectReview(c *gin.Context) {
+	rs.reviewReceipt(c, false)
+}
+
+// reviewReceipt records the decision of the authenticated admin on a pending receipt
+func (rs *ReceiptServer) reviewReceipt(c *gin.Context, approve bool) {
+	var request ReviewRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			handleValidationError(c, err)
+			return
+		}
+	}
+
+	record, err := service.ReviewReceipt(c.Params.ByName("id"), approve, c.GetString(clientKey), request.Notes, rs.Processor.Policy.Caps, rs.DB)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrIdNotFound):
+			handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+		case errors.Is(err, service.ErrNotPendingReview):
+			handleError(c, http.StatusConflict, CodeInvalidState, err.Error())
+		default:
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to review the receipt")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// reverseReceipt takes back the points of a scored receipt on behalf of the authenticated admin
+func (rs *ReceiptServer) reverseReceipt(c *gin.Context) {
+	var request ReviewRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			handleValidationError(c, err)
+			return
+		}
+	}
+
+	record, err := service.ReverseReceipt(c.Params.ByName("id"), c.GetString(clientKey), request.Notes, rs.DB)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrIdNotFound):
+			handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+		case errors.Is(err, service.ErrNotScored):
+			handleError(c, http.StatusConflict, CodeInvalidState, err.Error())
+		default:
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to reverse the receipt")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewQueue(t *testing.T) {
+	server := newTestServer(t, service.Policy{HoldThreshold: service.DefaultHoldThreshold})
+	db := server.DB
+
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+	admin, err := service.AuthenticateAPIKey(adminKey, db)
+	assert.NoError(t, err)
+
+	// Resubmitting the same receipt gets both copies held for review
+	assert.Equal(t, http.StatusOK, submit(server, submitKey, simpleReceiptJSON).Code)
+	first := decodeResponse(submit(server, submitKey, simpleReceiptJSON), t).ID
+	second := decodeResponse(submit(server, submitKey, simpleReceiptJSON), t).ID
+	_, err = server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/reviews", nil)
+	req.Header.Set(APIKeyHeader, adminKey)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var queue struct {
+		Reviews []model.ReceiptRecord `json:"reviews"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &queue))
+	assert.Len(t, queue.Reviews, 2)
+	assert.Equal(t, first, queue.Reviews[0].ID)
+	assert.Equal(t, model.StatusPendingReview, queue.Reviews[0].Status)
+
+	review := func(id, decision, body string) *httptest.ResponseRecorder {
+		return adminRequest(t, server, "POST", "/admin/reviews/"+id+"/"+decision, adminKey, body)
+	}
+
+	w = review(first, "approve", `{"notes": "customer sent a photo"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var approved model.ReceiptRecord
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &approved))
+	assert.Equal(t, model.StatusScored, approved.Status)
+	assert.Equal(t, model.DecisionApproved, approved.Review.Decision)
+	assert.Equal(t, admin.ID, approved.Review.Reviewer)
+	assert.Equal(t, "customer sent a photo", approved.Review.Notes)
+	points, _ := service.GetPoints(first, db)
+	assert.Equal(t, approved.Points, points)
+
+	assert.Equal(t, http.StatusOK, review(second, "reject", "").Code)
+	points, _ = service.GetPoints(second, db)
+	assert.Equal(t, 0, points)
+
+	// Decisions are final and the queue is drained
+	assert.Equal(t, http.StatusConflict, review(first, "reject", "").Code)
+	assert.Equal(t, http.StatusNotFound, review("unknown", "approve", "").Code)
+	pending, err := service.ListPendingReviews(db)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
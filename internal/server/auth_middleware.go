@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the request header carrying the client's API key
+const APIKeyHeader = "X-API-Key"
+
+// Gin context keys set by authorize
+const (
+	// clientKey holds the ID of the authenticated API key
+	clientKey = "client"
+	// accountKey holds the loyalty account of a user authenticated with a bearer token
+	accountKey = "account"
+)
+
+// userScopes are the scopes granted to users authenticated with a bearer token
+var userScopes = map[string]bool{
+	model.ScopeSubmit: true,
+	model.ScopeRead:   true,
+}
+
+// authorize authenticates the request with a bearer token or an API key and
+// rejects it unless the credential grants scope
+func (rs *ReceiptServer) authorize(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && rs.JWT != nil {
+			rs.authorizeToken(c, token, scope)
+			return
+		}
+
+		plaintext := c.GetHeader(APIKeyHeader)
+		if plaintext == "" {
+			c.Header("WWW-Authenticate", "ApiKey header="+APIKeyHeader)
+			handleError(c, http.StatusUnauthorized, CodeUnauthorized, "missing api key")
+			c.Abort()
+			return
+		}
+
+		key, err := service.AuthenticateAPIKey(plaintext, rs.DB)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidAPIKey) {
+				handleError(c, http.StatusUnauthorized, CodeUnauthorized, err.Error())
+			} else {
+				log.Println(err)
+				handleError(c, http.StatusInternalServerError, CodeInternal, "failed to authenticate the request")
+			}
+			c.Abort()
+			return
+		}
+
+		if !key.HasScope(scope) {
+			handleError(c, http.StatusForbidden, CodeForbidden, "api key is missing the "+scope+" scope")
+			c.Abort()
+			return
+		}
+
+		c.Set(clientKey, key.ID)
+		c.Next()
+	}
+}
+
+// authorizeToken validates a user's bearer token and binds the request to the account in its sub claim
+func (rs *ReceiptServer) authorizeToken(c *gin.Context, token, scope string) {
+	account, err := rs.JWT.Verify(token)
+	if err != nil {
+		log.Println(err)
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		handleError(c, http.StatusUnauthorized, CodeUnauthorized, "invalid bearer token")
+		c.Abort()
+		return
+	}
+
+	if !userScopes[scope] {
+		handleError(c, http.StatusForbidden, CodeForbidden, "bearer tokens are missing the "+scope+" scope")
+		c.Abort()
+		return
+	}
+
+	c.Set(accountKey, account)
+	c.Next()
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/auth"
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const simpleReceiptJSON = `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-02",
+	"purchaseTime": "13:13",
+	"total": "1.25",
+	"items": [
+		{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}
+	]
+}`
+
+func TestAuthorize(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	readKey := newAPIKey(t, server, model.ScopeRead)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		status int
+	}{
+		{"missing key", "POST", "/receipts/process", "", http.StatusUnauthorized},
+		{"malformed key", "POST", "/receipts/process", "garbage", http.StatusUnauthorized},
+		{"wrong secret", "POST", "/receipts/process", submitKey + "x", http.StatusUnauthorized},
+		{"read key cannot submit", "POST", "/receipts/process", readKey, http.StatusForbidden},
+		{"submit key cannot read", "GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab/points", submitKey, http.StatusForbidden},
+		{"submit key cannot back up", "GET", "/admin/backup", submitKey, http.StatusForbidden},
+		{"read key can read", "GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab/points", readKey, http.StatusNotFound},
+		{"submit key can submit", "POST", "/receipts/process", submitKey, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(test.method, test.path, bytes.NewBufferString(simpleReceiptJSON))
+			req.Header.Set("Content-Type", "application/json")
+			if test.key != "" {
+				req.Header.Set(APIKeyHeader, test.key)
+			}
+			server.ServeHTTP(w, req)
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestProcessReceiptRecordsClient(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	db := server.DB
+
+	key := newAPIKey(t, server, model.ScopeSubmit)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(simpleReceiptJSON))
+	req.Header.Set(APIKeyHeader, key)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	record, err := service.GetReceipt(decodeResponse(w, t).ID, db)
+	assert.NoError(t, err)
+	stored, err := service.AuthenticateAPIKey(key, db)
+	assert.NoError(t, err)
+	assert.Equal(t, stored.ID, record.ClientID)
+}
+
+func TestAPIKeyAdministration(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+
+	// Unknown scopes are rejected
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/keys", bytes.NewBufferString(`{"name": "pos", "scopes": ["everything"]}`))
+	req.Header.Set(APIKeyHeader, adminKey)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/keys", bytes.NewBufferString(`{"name": "pos", "scopes": ["submit"]}`))
+	req.Header.Set(APIKeyHeader, adminKey)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Key)
+	assert.Empty(t, created.SecretHash)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/admin/keys", nil)
+	req.Header.Set(APIKeyHeader, adminKey)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), created.ID)
+	assert.NotContains(t, w.Body.String(), "secretHash")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/admin/keys/"+created.ID, nil)
+	req.Header.Set(APIKeyHeader, adminKey)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// The revoked key no longer authenticates
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(simpleReceiptJSON))
+	req.Header.Set(APIKeyHeader, created.Key)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/admin/keys/unknown", nil)
+	req.Header.Set(APIKeyHeader, adminKey)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// enableBearerTokens configures the server to accept tokens signed by a test key and
+// returns a function issuing Authorization headers for an account
+func enableBearerTokens(t *testing.T, server *ReceiptServer) func(account string) string {
+	t.Helper()
+	signingKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "EC", "kid": "app", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(signingKey.X.Bytes()),
+		"y": base64.RawURLEncoding.EncodeToString(signingKey.Y.Bytes()),
+	}}})
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwksPath, jwks, 0600))
+	verifier, err := auth.NewVerifier(jwksPath, "", "")
+	assert.NoError(t, err)
+	server.JWT = verifier
+
+	return func(account string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+			Subject:   account,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		})
+		token.Header["kid"] = "app"
+		signed, err := token.SignedString(signingKey)
+		assert.NoError(t, err)
+		return "Bearer " + signed
+	}
+}
+
+func TestBearerTokenOwnership(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	db := server.DB
+	tokenFor := enableBearerTokens(t, server)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(simpleReceiptJSON))
+	req.Header.Set("Authorization", tokenFor("alice"))
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	id := decodeResponse(w, t).ID
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	record, err := service.GetReceipt(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", record.AccountID)
+
+	// The owner can read the points, another user cannot tell the receipt exists
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/receipts/"+id+"/points", nil)
+	req.Header.Set("Authorization", tokenFor("alice"))
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/receipts/"+id+"/points", nil)
+	req.Header.Set("Authorization", tokenFor("bob"))
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Users never get admin access
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/admin/keys", nil)
+	req.Header.Set("Authorization", tokenFor("alice"))
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/receipts/"+id+"/points", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// CampaignRequest is the payload of POST /admin/campaigns and PUT /admin/campaigns/:id
+type CampaignRequest struct {
+	Name        string    `json:"name" binding:"required"`
+	RetailerIDs []string  `json:"retailerIds"`
+	StartsAt    time.Time `json:"startsAt" binding:"required"`
+	EndsAt      time.Time `json:"endsAt" binding:"required"`
+	MinTotal    string    `json:"minTotal" binding:"omitempty,numeric"`
+	Multiplier  float64   `json:"multiplier"`
+	Bonus       int       `json:"bonus"`
+	Stacking    string    `json:"stacking"`
+}
+
+func (request *CampaignRequest) campaign() *model.Campaign {
+	return &model.Campaign{
+		Name:        request.Name,
+		RetailerIDs: request.RetailerIDs,
+		StartsAt:    request.StartsAt,
+		EndsAt:      request.EndsAt,
+		MinTotal:    request.MinTotal,
+		Multiplier:  request.Multiplier,
+		Bonus:       request.Bonus,
+		Stacking:    request.Stacking,
+	}
+}
+
+func (rs *ReceiptServer) createCampaign(c *gin.Context) {
+	var request CampaignRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	campaign := request.campaign()
+	if err := service.CreateCampaign(campaign, rs.DB); err != nil {
+		handleCampaignError(c, err, "failed to create the campaign")
+		return
+	}
+	c.JSON(http.StatusCreated, campaign)
+}
+
+func (rs *ReceiptServer) listCampaigns(c *gin.Context) {
+	campaigns, err := service.ListCampaigns(rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list campaigns")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
+}
+
+func (rs *ReceiptServer) getCampaign(c *gin.Context) {
+	campaign, err := service.GetCampaign(c.Params.ByName("id"), rs.DB)
+	if err != nil {
+		handleCampaignError(c, err, "failed to get the campaign")
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+func (rs *ReceiptServer) updateCampaign(c *gin.Context) {
+	var request CampaignRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	campaign := request.campaign()
+	if err := service.UpdateCampaign(c.Params.ByName("id"), campaign, rs.DB); err != nil {
+		handleCampaignError(c, err, "failed to update the campaign")
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+func (rs *ReceiptServer) deleteCampaign(c *gin.Context) {
+	if err := service.DeleteCampaign(c.Params.ByName("id"), rs.DB); err != nil {
+		handleCampaignError(c, err, "failed to delete the campaign")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func handleCampaignError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrIdNotFound):
+		handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidCampaign):
+		handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	default:
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, message)
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaigns(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+
+	body := `{"name": "2x points at Target this weekend", "retailerIds": ["target"], "startsAt": "2022-01-01T00:00:00-05:00", "endsAt": "2022-01-03T00:00:00-05:00", "multiplier": 2}`
+	assert.Equal(t, http.StatusForbidden, adminRequest(t, server, "POST", "/admin/campaigns", submitKey, body).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "POST", "/admin/campaigns", adminKey, `{"name": "Nothing", "startsAt": "2022-01-01T00:00:00Z", "endsAt": "2022-01-03T00:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "POST", "/admin/campaigns", adminKey, `{"name": "Half", "startsAt": "2022-01-01T00:00:00Z", "endsAt": "2022-01-03T00:00:00Z", "multiplier": 0.5}`).Code)
+
+	w := adminRequest(t, server, "POST", "/admin/campaigns", adminKey, body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var campaign model.Campaign
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &campaign))
+	assert.Equal(t, model.StackingStack, campaign.Stacking)
+	assert.Equal(t, http.StatusCreated, adminRequest(t, server, "POST", "/admin/retailers", adminKey, `{"name": "Target"}`).Code)
+
+	// 31 points doubled by the campaign
+	id := decodeResponse(submit(server, submitKey, simpleReceiptJSON), t).ID
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+	record, err := service.GetReceipt(id, server.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 62, record.Points)
+	last := record.Breakdown.Rules[len(record.Breakdown.Rules)-1]
+	assert.Equal(t, model.RuleAward{Rule: model.RuleCampaign, Description: campaign.Name, Points: 31, CampaignID: campaign.ID}, last)
+
+	w = adminRequest(t, server, "PUT", "/admin/campaigns/"+campaign.ID, adminKey, `{"name": "+5 points at Target", "retailerIds": ["target"], "startsAt": "2022-01-01T00:00:00Z", "endsAt": "2022-01-03T00:00:00Z", "bonus": 5}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"bonus":5`)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "PUT", "/admin/campaigns/unknown", adminKey, body).Code)
+
+	w = adminRequest(t, server, "GET", "/admin/campaigns", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), campaign.ID)
+	assert.Equal(t, http.StatusOK, adminRequest(t, server, "GET", "/admin/campaigns/"+campaign.ID, adminKey, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, server, "DELETE", "/admin/campaigns/"+campaign.ID, adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "GET", "/admin/campaigns/"+campaign.ID, adminKey, "").Code)
+}
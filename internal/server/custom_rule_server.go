@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// CustomRuleRequest is the payload of POST /admin/rules and PUT /admin/rules/:id
+type CustomRuleRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Condition string `json:"condition"`
+	Points    string `json:"points" binding:"required"`
+}
+
+func (request *CustomRuleRequest) rule() *model.CustomRule {
+	return &model.CustomRule{Name: request.Name, Condition: request.Condition, Points: request.Points}
+}
+
+func (rs *ReceiptServer) createCustomRule(c *gin.Context) {
+	var request CustomRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	rule := request.rule()
+	if err := service.CreateCustomRule(rule, rs.DB); err != nil {
+		handleCustomRuleError(c, err, "failed to create the rule")
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (rs *ReceiptServer) listCustomRules(c *gin.Context) {
+	rules, err := service.ListCustomRules(rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list rules")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (rs *ReceiptServer) getCustomRule(c *gin.Context) {
+	rule, err := service.GetCustomRule(c.Params.ByName("id"), rs.DB)
+	if err != nil {
+		handleCustomRuleError(c, err, "failed to get the rule")
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (rs *ReceiptServer) updateCustomRule(c *gin.Context) {
+	var request CustomRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	rule := request.rule()
+	if err := service.UpdateCustomRule(c.Params.ByName("id"), rule, rs.DB); err != nil {
+		handleCustomRuleError(c, err, "failed to update the rule")
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+func (rs *ReceiptServer) deleteCustomRule(c *gin.Context) {
+	if err := service.DeleteCustomRule(c.Params.ByName("id"), rs.DB); err != nil {
+		handleCustomRuleError(c, err, "failed to delete the rule")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func handleCustomRuleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrIdNotFound):
+		handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidRule):
+		handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	default:
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, message)
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomRules(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+
+	body := `{"name": "Target lunch bonus", "condition": "retailer.canonical == \"target\" && hour(purchase) in 12..13", "points": "floor(total) + 10"}`
+	assert.Equal(t, http.StatusForbidden, adminRequest(t, server, "POST", "/admin/rules", submitKey, body).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "POST", "/admin/rules", adminKey, `{"name": "No points"}`).Code)
+
+	// Compile errors point at the problem
+	w := adminRequest(t, server, "POST", "/admin/rules", adminKey, `{"name": "Typo", "condition": "total >= 25 &&", "points": "10"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "condition: column 15: unexpected end of expression")
+
+	w = adminRequest(t, server, "POST", "/admin/rules", adminKey, body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var rule model.CustomRule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+	assert.Equal(t, http.StatusCreated, adminRequest(t, server, "POST", "/admin/retailers", adminKey, `{"name": "Target"}`).Code)
+
+	// 31 points and 11 for the rule
+	id := decodeResponse(submit(server, submitKey, simpleReceiptJSON), t).ID
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+	record, err := service.GetReceipt(id, server.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, record.Points)
+	last := record.Breakdown.Rules[len(record.Breakdown.Rules)-1]
+	assert.Equal(t, model.RuleAward{Rule: model.RuleCustom, Description: rule.Name, Points: 11, RuleID: rule.ID}, last)
+
+	w = adminRequest(t, server, "PUT", "/admin/rules/"+rule.ID, adminKey, `{"name": "Flat bonus", "points": "5"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"points":"5"`)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "PUT", "/admin/rules/"+rule.ID, adminKey, `{"name": "Flat bonus", "points": "\"5\""}`).Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "PUT", "/admin/rules/unknown", adminKey, body).Code)
+
+	w = adminRequest(t, server, "GET", "/admin/rules", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), rule.ID)
+	assert.Equal(t, http.StatusOK, adminRequest(t, server, "GET", "/admin/rules/"+rule.ID, adminKey, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, server, "DELETE", "/admin/rules/"+rule.ID, adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "GET", "/admin/rules/"+rule.ID, adminKey, "").Code)
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+)
+
+// maxGraphQLLimit caps the limit argument of list fields
+const maxGraphQLLimit = 100
+
+// GraphQLRequest is the payload of POST /graphql
+type GraphQLRequest struct {
+	Query         string                 `json:"query" form:"query" binding:"required"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables" form:"-"`
+}
+
+// graphQLAccountKey holds the account of a user authenticated with a bearer token in the resolver context
+type graphQLAccountKey struct{}
+
+func (rs *ReceiptServer) graphQL(c *gin.Context) {
+	var request GraphQLRequest
+	var err error
+	if c.Request.Method == http.MethodGet {
+		// GET requests carry the query and its JSON encoded variables in the query string
+		err = c.ShouldBindQuery(&request)
+		if variables := c.Query("variables"); err == nil && variables != "" {
+			err = json.Unmarshal([]byte(variables), &request.Variables)
+		}
+	} else {
+		err = c.ShouldBindJSON(&request)
+	}
+	if err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         rs.schema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        context.WithValue(c.Request.Context(), graphQLAccountKey{}, c.GetString(accountKey)),
+	})
+	c.JSON(http.StatusOK, result)
+}
+
+// visibleTo reports whether the caller may see the account's data, users authenticated
+// by a token only see their own account and API keys see all of them
+func visibleTo(ctx context.Context, account string) bool {
+	user, _ := ctx.Value(graphQLAccountKey{}).(string)
+	return user == "" || user == account
+}
+
+// limitArg reads the limit argument of a list field, capped at maxGraphQLLimit
+func limitArg(p graphql.ResolveParams) int {
+	limit, _ := p.Args["limit"].(int)
+	return max(0, min(limit, maxGraphQLLimit))
+}
+
+// newGraphQLSchema builds the schema over receipts and accounts, its resolvers read from rs.DB
+func (rs *ReceiptServer) newGraphQLSchema() (graphql.Schema, error) {
+	itemType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.Fields{
+			"shortDescription": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"price":            &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	ruleAwardType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "RuleAward",
+		Description: "Points awarded by a single rule",
+		Fields: graphql.Fields{
+			"rule":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"description": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"points":      &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	breakdownType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Breakdown",
+		Description: "How a receipt's points were calculated",
+		Fields: graphql.Fields{
+			"rules": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ruleAwardType)))},
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	// receiptField resolves a field of the submitted receipt from the stored record
+	receiptField := func(get func(*model.Receipt) interface{}) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			record := p.Source.(*model.ReceiptRecord)
+			if record.Receipt == nil {
+				return nil, nil
+			}
+			return get(record.Receipt), nil
+		}
+	}
+
+	receiptType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Receipt",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"status":          &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"riskScore":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"rejectionReason": &graphql.Field{Type: graphql.String},
+			"accountId":       &graphql.Field{Type: graphql.String},
+			"createdAt":       &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"processedAt":     &graphql.Field{Type: graphql.DateTime},
+			"points": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Credited points, held and rejected receipts have none",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*model.ReceiptRecord).CreditedPoints(), nil
+				},
+			},
+			"retailer":     &graphql.Field{Type: graphql.String, Resolve: receiptField(func(r *model.Receipt) interface{} { return r.Retailer })},
+			"purchaseDate": &graphql.Field{Type: graphql.String, Resolve: receiptField(func(r *model.Receipt) interface{} { return r.PurchaseDate })},
+			"purchaseTime": &graphql.Field{Type: graphql.String, Resolve: receiptField(func(r *model.Receipt) interface{} { return r.PurchaseTime })},
+			"total":        &graphql.Field{Type: graphql.String, Resolve: receiptField(func(r *model.Receipt) interface{} { return r.Total })},
+			"items": &graphql.Field{
+				Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemType))),
+				Resolve: receiptField(func(r *model.Receipt) interface{} { return r.Items }),
+			},
+			"breakdown": &graphql.Field{
+				Type:        breakdownType,
+				Description: "How the points were calculated, null until the receipt is scored",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					record := p.Source.(*model.ReceiptRecord)
+					if record.Breakdown != nil {
+						return record.Breakdown, nil
+					}
+					// Receipts scored before breakdowns were stored, and before campaigns existed, are recalculated
+					if record.Receipt != nil && record.Processed() && record.Status != model.StatusRejected {
+						breakdown := service.CalculateBreakdown(record.Receipt, nil)
+						return &breakdown, nil
+					}
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	ledgerEntryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "LedgerEntry",
+		Fields: graphql.Fields{
+			"seq":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"type":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"receiptId": &graphql.Field{Type: graphql.ID},
+			"points":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"tierBonus": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	})
+
+	tierChangeType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "TierChange",
+		Description: "An enrollment, promotion or demotion",
+		Fields: graphql.Fields{
+			"from": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Previous tier, null for the enrollment",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if from := p.Source.(model.TierChange).From; from != "" {
+						return from, nil
+					}
+					return nil, nil
+				},
+			},
+			"to":             &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"reason":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"trailingPoints": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"changedAt":      &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	})
+
+	accountTierType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "AccountTier",
+		Description: "Membership tier reached with the points of the trailing 12 months",
+		Fields: graphql.Fields{
+			"tier":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"trailingPoints": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"since":          &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"evaluatedAt":    &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"history": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tierChangeType))),
+				Description: "Tier changes, oldest first",
+			},
+		},
+	})
+
+	accountType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Account",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+			"balance": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Sum of the account's ledger",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return service.GetBalance(p.Source.(string), rs.DB)
+				},
+			},
+			"tier": &graphql.Field{
+				Type:        accountTierType,
+				Description: "Membership tier and its history, null until the account earns points with tiers enabled",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					status, err := service.GetAccountTier(p.Source.(string), rs.DB)
+					if status == nil || err != nil {
+						return nil, err
+					}
+					return status, nil
+				},
+			},
+			"receipts": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(receiptType))),
+				Description: "Most recently submitted receipts, newest first",
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 10},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					records, err := service.ListAccountReceipts(p.Source.(string), limitArg(p), rs.DB)
+					if err != nil {
+						return nil, err
+					}
+					receipts := make([]*model.ReceiptRecord, len(records))
+					for i := range records {
+						receipts[i] = &records[i]
+					}
+					return receipts, nil
+				},
+			},
+			"ledger": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ledgerEntryType))),
+				Description: "Most recent ledger entries, newest first",
+				Args: graphql.FieldConfigArgument{
+					"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 20},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return service.ListLedger(p.Source.(string), limitArg(p), rs.DB)
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"receipt": &graphql.Field{
+				Type: receiptType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := p.Args["id"].(string)
+					if _, err := uuid.Parse(id); err != nil {
+						return nil, errors.New("id is not a uuid")
+					}
+					record, err := service.GetReceipt(id, rs.DB)
+					if errors.Is(err, service.ErrIdNotFound) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					if !visibleTo(p.Context, record.AccountID) {
+						return nil, nil
+					}
+					return record, nil
+				},
+			},
+			"account": &graphql.Field{
+				Type: accountType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					account := p.Args["id"].(string)
+					if !visibleTo(p.Context, account) {
+						return nil, nil
+					}
+					return account, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQL(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	tokenFor := enableBearerTokens(t, server)
+	readKey := newAPIKey(t, server, model.ScopeRead)
+
+	var ids []string
+	for _, body := range []string{simpleReceiptJSON, `{"retailer": "M&M Corner Market", "purchaseDate": "2022-03-20", "purchaseTime": "14:33", "total": "9.00",
+		"items": [{"shortDescription": "Gatorade", "price": "2.25"}, {"shortDescription": "Gatorade", "price": "2.25"}]}`} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", tokenFor("alice"))
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		ids = append(ids, decodeResponse(w, t).ID)
+	}
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	query := func(authorization, key, query string, variables map[string]interface{}) map[string]interface{} {
+		body, _ := json.Marshal(GraphQLRequest{Query: query, Variables: variables})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(body))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var result map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+
+	// A receipt with its items and breakdown in one round trip
+	result := query(tokenFor("alice"), "", `query($id: ID!) {
+		receipt(id: $id) { id status points retailer items { shortDescription price } breakdown { total rules { rule points } } }
+	}`, map[string]interface{}{"id": ids[0]})
+	assert.Nil(t, result["errors"])
+	receipt := result["data"].(map[string]interface{})["receipt"].(map[string]interface{})
+	assert.Equal(t, ids[0], receipt["id"])
+	assert.Equal(t, model.StatusScored, receipt["status"])
+	assert.Equal(t, float64(31), receipt["points"])
+	assert.Equal(t, "Target", receipt["retailer"])
+	assert.Len(t, receipt["items"], 1)
+	breakdown := receipt["breakdown"].(map[string]interface{})
+	assert.Equal(t, float64(31), breakdown["total"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"rule": model.RuleRetailerName, "points": float64(6)},
+		map[string]interface{}{"rule": model.RuleQuarterTotal, "points": float64(25)},
+	}, breakdown["rules"])
+
+	// An account with its balance and recent receipts
+	result = query(tokenFor("alice"), "", `{ account(id: "alice") { id balance tier { tier } receipts(limit: 1) { id } ledger { points } } }`, nil)
+	assert.Nil(t, result["errors"])
+	account := result["data"].(map[string]interface{})["account"].(map[string]interface{})
+	assert.Nil(t, account["tier"])
+	assert.Equal(t, float64(31+104), account["balance"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"id": ids[1]}}, account["receipts"])
+	assert.Len(t, account["ledger"], 2)
+
+	// Users cannot see other accounts, API keys see all of them
+	result = query(tokenFor("bob"), "", `query($id: ID!) { receipt(id: $id) { id } account(id: "alice") { balance } }`, map[string]interface{}{"id": ids[0]})
+	assert.Equal(t, map[string]interface{}{"receipt": nil, "account": nil}, result["data"])
+	result = query("", readKey, `{ account(id: "alice") { balance } }`, nil)
+	assert.Equal(t, float64(135), result["data"].(map[string]interface{})["account"].(map[string]interface{})["balance"])
+
+	result = query("", readKey, `{ receipt(id: "abc") { id } }`, nil)
+	assert.NotEmpty(t, result["errors"])
+	result = query("", readKey, `{ nothing }`, nil)
+	assert.NotEmpty(t, result["errors"])
+}
+
+func TestGraphQLAccountTier(t *testing.T) {
+	tiers, err := service.ParseTiers("Bronze:0:1,Silver:50:2")
+	assert.NoError(t, err)
+	server := newTestServer(t, service.Policy{Tiers: tiers})
+	tokenFor := enableBearerTokens(t, server)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(simpleReceiptJSON))
+		req.Header.Set("Authorization", tokenFor("alice"))
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		_, err := server.Processor.ProcessPending()
+		assert.NoError(t, err)
+	}
+
+	body, _ := json.Marshal(GraphQLRequest{Query: `{ account(id: "alice") { tier { tier trailingPoints history { from to reason trailingPoints } } } }`})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", tokenFor("alice"))
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Nil(t, result["errors"])
+	assert.Equal(t, map[string]interface{}{
+		"tier":           "Silver",
+		"trailingPoints": float64(62),
+		"history": []interface{}{
+			map[string]interface{}{"from": nil, "to": "Bronze", "reason": model.TierEnrollment, "trailingPoints": float64(31)},
+			map[string]interface{}{"from": "Bronze", "to": "Silver", "reason": model.TierPromotion, "trailingPoints": float64(62)},
+		},
+	}, result["data"].(map[string]interface{})["account"].(map[string]interface{})["tier"])
+}
@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/VineethKanaparthi/receipt-processor/pkg/receiptpb"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcScopes are the scopes required by each gRPC method
+var grpcScopes = map[string]string{
+	receiptpb.ReceiptService_ProcessReceipt_FullMethodName:  model.ScopeSubmit,
+	receiptpb.ReceiptService_ProcessReceipts_FullMethodName: model.ScopeSubmit,
+	receiptpb.ReceiptService_GetPoints_FullMethodName:       model.ScopeRead,
+	receiptpb.ReceiptService_GetReceipt_FullMethodName:      model.ScopeRead,
+}
+
+// identity is the authenticated caller of a gRPC method, the equivalent of the
+// client and account gin context keys
+type identity struct {
+	client  string
+	account string
+}
+
+type identityKey struct{}
+
+// GRPCServer implements the gRPC receipt service on top of a ReceiptServer
+type GRPCServer struct {
+	receiptpb.UnimplementedReceiptServiceServer
+	rs *ReceiptServer
+}
+
+// GRPC returns a gRPC server for the receipt service. It shares the database, processor,
+// authentication and rate limits of the REST API, so both can be served side by side.
+func (rs *ReceiptServer) GRPC() *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, err := rs.authorizeGRPC(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := rs.authorizeGRPC(stream.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authorizedStream{ServerStream: stream, ctx: ctx})
+		}),
+	)
+	receiptpb.RegisterReceiptServiceServer(server, &GRPCServer{rs: rs})
+	return server
+}
+
+// authorizedStream carries the caller's identity in the stream's context
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authorizedStream) Context() context.Context {
+	return stream.ctx
+}
+
+// authorizeGRPC authenticates the call with the bearer token in the authorization metadata
+// or the API key in the x-api-key metadata, the same credentials the REST API accepts
+func (rs *ReceiptServer) authorizeGRPC(ctx context.Context, method string) (context.Context, error) {
+	scope, ok := grpcScopes[method]
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "unknown method")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	if token, ok := strings.CutPrefix(first("authorization"), "Bearer "); ok && rs.JWT != nil {
+		account, err := rs.JWT.Verify(token)
+		if err != nil {
+			log.Println(err)
+			return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+		}
+		if !userScopes[scope] {
+			return nil, status.Error(codes.PermissionDenied, "bearer tokens are missing the "+scope+" scope")
+		}
+		return context.WithValue(ctx, identityKey{}, identity{account: account}), nil
+	}
+
+	plaintext := first(strings.ToLower(APIKeyHeader))
+	if plaintext == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing api key")
+	}
+	key, err := service.AuthenticateAPIKey(plaintext, rs.DB)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "failed to authenticate the request")
+	}
+	if !key.HasScope(scope) {
+		return nil, status.Error(codes.PermissionDenied, "api key is missing the "+scope+" scope")
+	}
+	return context.WithValue(ctx, identityKey{}, identity{client: key.ID}), nil
+}
+
+func callerOf(ctx context.Context) identity {
+	caller, _ := ctx.Value(identityKey{}).(identity)
+	return caller
+}
+
+func (s *GRPCServer) ProcessReceipt(ctx context.Context, req *receiptpb.ProcessReceiptRequest) (*receiptpb.ProcessReceiptResponse, error) {
+	return s.submit(ctx, req.GetReceipt())
+}
+
+func (s *GRPCServer) ProcessReceipts(stream receiptpb.ReceiptService_ProcessReceiptsServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.submit(stream.Context(), req.GetReceipt())
+		if err != nil {
+			// Rejected receipts are answered in order, only internal errors end the stream
+			switch status.Code(err) {
+			case codes.InvalidArgument, codes.ResourceExhausted:
+				resp = &receiptpb.ProcessReceiptResponse{Error: status.Convert(err).Message()}
+			default:
+				return err
+			}
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// submit validates the receipt like the REST binding does and queues it for processing
+func (s *GRPCServer) submit(ctx context.Context, pb *receiptpb.Receipt) (*receiptpb.ProcessReceiptResponse, error) {
+	caller := callerOf(ctx)
+	if limiter := s.rs.RateLimiter; limiter != nil {
+		key := "client:" + caller.client
+		if caller.account != "" {
+			key = "account:" + caller.account
+		}
+		if ok, wait := limiter.Allow(key); !ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %d seconds", int(math.Ceil(wait.Seconds())))
+		}
+	}
+
+	if pb == nil {
+		return nil, status.Error(codes.InvalidArgument, "receipt is missing")
+	}
+	receipt := receiptFromProto(pb)
+	if err := binding.Validator.ValidateStruct(receipt); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := receipt.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	id, err := s.rs.Processor.Submit(receipt, service.Submitter{ClientID: caller.client, AccountID: caller.account})
+	var limitErr *service.LimitError
+	if errors.As(err, &limitErr) {
+		return nil, status.Error(codes.ResourceExhausted, limitErr.Error())
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, "failed to process the receipt, please try again")
+	}
+	return &receiptpb.ProcessReceiptResponse{Id: id, Status: model.StatusAccepted}, nil
+}
+
+func (s *GRPCServer) GetPoints(ctx context.Context, req *receiptpb.GetPointsRequest) (*receiptpb.GetPointsResponse, error) {
+	record, err := s.loadReceipt(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if !record.Processed() {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s, status is %s", service.ErrNotProcessed, record.Status)
+	}
+	return &receiptpb.GetPointsResponse{Points: int64(record.CreditedPoints())}, nil
+}
+
+func (s *GRPCServer) GetReceipt(ctx context.Context, req *receiptpb.GetReceiptRequest) (*receiptpb.GetReceiptResponse, error) {
+	record, err := s.loadReceipt(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	resp := &receiptpb.GetReceiptResponse{
+		Id:              record.ID,
+		Status:          record.Status,
+		Points:          int64(record.CreditedPoints()),
+		RejectionReason: record.RejectionReason,
+		CreatedAt:       timestamppb.New(record.CreatedAt),
+	}
+	if record.ProcessedAt != nil {
+		resp.ProcessedAt = timestamppb.New(*record.ProcessedAt)
+	}
+	if record.Receipt != nil {
+		resp.Receipt = receiptToProto(record.Receipt)
+	}
+	return resp, nil
+}
+
+// loadReceipt looks up the receipt, hiding receipts of other accounts from token users like the REST API does
+func (s *GRPCServer) loadReceipt(ctx context.Context, id string) (*model.ReceiptRecord, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "id is not a uuid")
+	}
+	record, err := service.GetReceipt(id, s.rs.DB)
+	if err == nil {
+		if account := callerOf(ctx).account; account != "" && record.AccountID != account {
+			err = service.ErrIdNotFound
+		}
+	}
+	if errors.Is(err, service.ErrIdNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, status.Error(codes.Internal, fmt.Sprintf("failed to get the receipt %s", id))
+	}
+	return record, nil
+}
+
+// receiptFromProto adapts a receipt sent over gRPC to the model the REST API binds
+func receiptFromProto(pb *receiptpb.Receipt) *model.Receipt {
+	receipt := &model.Receipt{
+		Retailer:     pb.GetRetailer(),
+		PurchaseDate: pb.GetPurchaseDate(),
+		PurchaseTime: pb.GetPurchaseTime(),
+		Items:        make([]model.Item, 0, len(pb.GetItems())),
+		Total:        pb.GetTotal(),
+		Subtotal:     pb.GetSubtotal(),
+		Discounts:    adjustmentsFromProto(pb.GetDiscounts()),
+		Taxes:        adjustmentsFromProto(pb.GetTaxes()),
+		Tip:          pb.GetTip(),
+
+		PurchaseOffset: pb.GetPurchaseOffset(),
+		TimeZone:       pb.GetTimeZone(),
+	}
+	if store := pb.GetStore(); store != nil {
+		receipt.Store = &model.Store{
+			ID:         store.GetId(),
+			Address:    store.GetAddress(),
+			City:       store.GetCity(),
+			Region:     store.GetRegion(),
+			PostalCode: store.GetPostalCode(),
+			Country:    store.GetCountry(),
+		}
+	}
+	for _, item := range pb.GetItems() {
+		receipt.Items = append(receipt.Items, model.Item{
+			ShortDescription: item.GetShortDescription(),
+			Price:            item.GetPrice(),
+			Quantity:         int(item.GetQuantity()),
+			UnitPrice:        item.GetUnitPrice(),
+			Discount:         item.GetDiscount(),
+			SKU:              item.GetSku(),
+			UPC:              item.GetUpc(),
+		})
+	}
+	for _, payment := range pb.GetPayments() {
+		receipt.Payments = append(receipt.Payments, model.Payment{Tender: payment.GetTender(), Amount: payment.GetAmount()})
+	}
+	return receipt
+}
+
+func adjustmentsFromProto(pbs []*receiptpb.Adjustment) []model.Adjustment {
+	var adjustments []model.Adjustment
+	for _, pb := range pbs {
+		adjustments = append(adjustments, model.Adjustment{Description: pb.GetDescription(), Amount: pb.GetAmount()})
+	}
+	return adjustments
+}
+
+// receiptToProto returns the fields of a stored receipt that were sent by the client
+func receiptToProto(receipt *model.Receipt) *receiptpb.Receipt {
+	pb := &receiptpb.Receipt{
+		Retailer:     receipt.Retailer,
+		PurchaseDate: receipt.PurchaseDate,
+		PurchaseTime: receipt.PurchaseTime,
+		Total:        receipt.Total,
+		Subtotal:     receipt.Subtotal,
+		Discounts:    adjustmentsToProto(receipt.Discounts),
+		Taxes:        adjustmentsToProto(receipt.Taxes),
+		Tip:          receipt.Tip,
+
+		PurchaseOffset: receipt.PurchaseOffset,
+		TimeZone:       receipt.TimeZone,
+	}
+	if store := receipt.Store; store != nil {
+		pb.Store = &receiptpb.Store{
+			Id:         store.ID,
+			Address:    store.Address,
+			City:       store.City,
+			Region:     store.Region,
+			PostalCode: store.PostalCode,
+			Country:    store.Country,
+		}
+	}
+	for _, item := range receipt.Items {
+		pb.Items = append(pb.Items, &receiptpb.Item{
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+			Quantity:         int32(item.Quantity),
+			UnitPrice:        item.UnitPrice,
+			Discount:         item.Discount,
+			Sku:              item.SKU,
+			Upc:              item.UPC,
+		})
+	}
+	for _, payment := range receipt.Payments {
+		pb.Payments = append(pb.Payments, &receiptpb.Payment{Tender: payment.Tender, Amount: payment.Amount})
+	}
+	return pb
+}
+
+func adjustmentsToProto(adjustments []model.Adjustment) []*receiptpb.Adjustment {
+	var pbs []*receiptpb.Adjustment
+	for _, adjustment := range adjustments {
+		pbs = append(pbs, &receiptpb.Adjustment{Description: adjustment.Description, Amount: adjustment.Amount})
+	}
+	return pbs
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/VineethKanaparthi/receipt-processor/pkg/receiptpb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCClient serves the server's gRPC API in memory and returns a client for it
+func newGRPCClient(t *testing.T, server *ReceiptServer) receiptpb.ReceiptServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := server.GRPC()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial the grpc server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return receiptpb.NewReceiptServiceClient(conn)
+}
+
+var simpleReceiptProto = &receiptpb.Receipt{
+	Retailer:     "Target",
+	PurchaseDate: "2022-01-02",
+	PurchaseTime: "13:13",
+	Total:        "1.25",
+	Items:        []*receiptpb.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+}
+
+func TestGRPCReceiptService(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	client := newGRPCClient(t, server)
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+	}
+	submitCtx := withKey(newAPIKey(t, server, model.ScopeSubmit))
+	readCtx := withKey(newAPIKey(t, server, model.ScopeRead))
+
+	_, err := client.ProcessReceipt(context.Background(), &receiptpb.ProcessReceiptRequest{Receipt: simpleReceiptProto})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.ProcessReceipt(readCtx, &receiptpb.ProcessReceiptRequest{Receipt: simpleReceiptProto})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.ProcessReceipt(submitCtx, &receiptpb.ProcessReceiptRequest{Receipt: &receiptpb.Receipt{Total: "abc"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	resp, err := client.ProcessReceipt(submitCtx, &receiptpb.ProcessReceiptRequest{Receipt: simpleReceiptProto})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusAccepted, resp.Status)
+
+	_, err = client.GetPoints(readCtx, &receiptpb.GetPointsRequest{Id: resp.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	// Receipts submitted over gRPC are stored with the ones from the REST API
+	points, err := client.GetPoints(readCtx, &receiptpb.GetPointsRequest{Id: resp.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(31), points.Points)
+	stored, err := service.GetPoints(resp.Id, server.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, 31, stored)
+
+	receipt, err := client.GetReceipt(readCtx, &receiptpb.GetReceiptRequest{Id: resp.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusScored, receipt.Status)
+	assert.NotNil(t, receipt.ProcessedAt)
+
+	_, err = client.GetReceipt(readCtx, &receiptpb.GetReceiptRequest{Id: "abc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetReceipt(readCtx, &receiptpb.GetReceiptRequest{Id: "d49ae048-61cc-4236-a258-1c4b3c2362ab"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCProcessReceipts(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	client := newGRPCClient(t, server)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", newAPIKey(t, server, model.ScopeSubmit))
+
+	stream, err := client.ProcessReceipts(ctx)
+	assert.NoError(t, err)
+	requests := []*receiptpb.Receipt{simpleReceiptProto, {Total: "1.00", PurchaseTime: "25:00"}, simpleReceiptProto}
+	for _, receipt := range requests {
+		assert.NoError(t, stream.Send(&receiptpb.ProcessReceiptRequest{Receipt: receipt}))
+	}
+	assert.NoError(t, stream.CloseSend())
+
+	// Invalid receipts are answered with an error in order without ending the stream
+	var responses []*receiptpb.ProcessReceiptResponse
+	for range requests {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		responses = append(responses, resp)
+	}
+	assert.NotEmpty(t, responses[0].Id)
+	assert.Empty(t, responses[1].Id)
+	assert.Contains(t, responses[1].Error, "purchaseTime")
+	assert.NotEmpty(t, responses[2].Id)
+
+	processed, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, processed)
+}
+
+func TestGRPCItemizedReceipt(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	client := newGRPCClient(t, server)
+	key := newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+
+	itemized := &receiptpb.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []*receiptpb.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "17.47", Quantity: 3, UnitPrice: "6.49", Discount: "2.00", Sku: "MD-12", Upc: "012000161155"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+		},
+		Subtotal:  "28.00",
+		Discounts: []*receiptpb.Adjustment{{Description: "Coupon", Amount: "1.72"}},
+		Taxes:     []*receiptpb.Adjustment{{Description: "Sales tax", Amount: "2.40"}},
+		Tip:       "0.60",
+		Total:     "31.00",
+		Payments:  []*receiptpb.Payment{{Tender: "gift_card", Amount: "10.00"}, {Tender: "credit", Amount: "21.00"}},
+	}
+	resp, err := client.ProcessReceipt(ctx, &receiptpb.ProcessReceiptRequest{Receipt: itemized})
+	assert.NoError(t, err)
+	rest := decodeResponse(submit(server, key, `{
+		"retailer": "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": [
+			{"shortDescription": "Mountain Dew 12PK", "price": "17.47", "quantity": 3, "unitPrice": "6.49", "discount": "2.00", "sku": "MD-12", "upc": "012000161155"},
+			{"shortDescription": "Emils Cheese Pizza", "price": "12.25"}
+		],
+		"subtotal": "28.00",
+		"discounts": [{"description": "Coupon", "amount": "1.72"}],
+		"taxes": [{"description": "Sales tax", "amount": "2.40"}],
+		"tip": "0.60",
+		"total": "31.00",
+		"payments": [{"tender": "gift_card", "amount": "10.00"}, {"tender": "credit", "amount": "21.00"}]
+	}`), t).ID
+	_, err = server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	// The same receipt scores the same over gRPC and REST, quantities count towards the item pairs
+	points, err := client.GetPoints(ctx, &receiptpb.GetPointsRequest{Id: resp.Id})
+	assert.NoError(t, err)
+	restPoints, err := service.GetPoints(rest, server.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(restPoints), points.Points)
+
+	receipt, err := client.GetReceipt(ctx, &receiptpb.GetReceiptRequest{Id: resp.Id})
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(itemized, receipt.Receipt), receipt.Receipt.String())
+
+	// The line arithmetic is validated like on the REST API
+	invalid := proto.Clone(itemized).(*receiptpb.Receipt)
+	invalid.Items[0].UnitPrice = ""
+	_, err = client.ProcessReceipt(ctx, &receiptpb.ProcessReceiptRequest{Receipt: invalid})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCStoreTimeZone(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	client := newGRPCClient(t, server)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead))
+
+	// 20:30 UTC is 14:30 on the store's clock, within the afternoon rule
+	chicago := proto.Clone(simpleReceiptProto).(*receiptpb.Receipt)
+	chicago.PurchaseTime = "20:30"
+	chicago.PurchaseOffset = "+00:00"
+	chicago.TimeZone = "America/Chicago"
+	chicago.Store = &receiptpb.Store{Id: "1375", City: "Chicago", Region: "IL", Country: "US"}
+	resp, err := client.ProcessReceipt(ctx, &receiptpb.ProcessReceiptRequest{Receipt: chicago})
+	assert.NoError(t, err)
+	_, err = server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	points, err := client.GetPoints(ctx, &receiptpb.GetPointsRequest{Id: resp.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(41), points.Points)
+	receipt, err := client.GetReceipt(ctx, &receiptpb.GetReceiptRequest{Id: resp.Id})
+	assert.NoError(t, err)
+	assert.True(t, proto.Equal(chicago, receipt.Receipt), receipt.Receipt.String())
+
+	unknown := proto.Clone(simpleReceiptProto).(*receiptpb.Receipt)
+	unknown.TimeZone = "Mars/Olympus"
+	_, err = client.ProcessReceipt(ctx, &receiptpb.ProcessReceiptRequest{Receipt: unknown})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	receiptprocessor "github.com/VineethKanaparthi/receipt-processor"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+// openAPIKey holds the validation input of the spec operation matching the request
+const openAPIKey = "openapi"
+
+// docsPage renders the spec as a static page, it loads no scripts so it works offline
+var docsPage = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<title>{{.Title}}</title>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<style>
+		body { font-family: sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; }
+		table { border-collapse: collapse; margin: .5em 0; }
+		th, td { border: 1px solid #ccc; padding: .2em .5em; text-align: left; vertical-align: top; }
+		code.method { font-weight: bold; text-transform: uppercase; }
+	</style>
+</head>
+<body>
+	<h1>{{.Title}} {{.Version}}</h1>
+	<p>{{.Description}}</p>
+	<p>The spec is served at <a href="/openapi.yaml">/openapi.yaml</a>.</p>
+	<h2>Operations</h2>
+	{{range .Operations}}
+	<h3 id="{{.ID}}"><code class="method">{{.Method}}</code> <code>{{.Path}}</code></h3>
+	<p><strong>{{.Summary}}</strong></p>
+	{{with .Description}}<p>{{.}}</p>{{end}}
+	{{with .Parameters}}
+	<table>
+		<tr><th>Parameter</th><th>In</th><th>Type</th><th>Required</th><th>Description</th></tr>
+		{{range .}}<tr><td><code>{{.Name}}</code></td><td>{{.In}}</td><td>{{.Type}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td></tr>{{end}}
+	</table>
+	{{end}}
+	{{with .Body}}<p>Request body: {{.}}</p>{{end}}
+	<table>
+		<tr><th>Status</th><th>Description</th><th>Body</th></tr>
+		{{range .Responses}}<tr><td>{{.Status}}</td><td>{{.Description}}</td><td>{{.Type}}</td></tr>{{end}}
+	</table>
+	{{end}}
+	<h2>Schemas</h2>
+	{{range .Schemas}}
+	<h3 id="schema-{{.Name}}">{{.Name}}</h3>
+	{{with .Description}}<p>{{.}}</p>{{end}}
+	{{with .Properties}}
+	<table>
+		<tr><th>Property</th><th>Type</th><th>Required</th><th>Description</th></tr>
+		{{range .}}<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Description}}</td></tr>{{end}}
+	</table>
+	{{end}}
+	{{end}}
+</body>
+</html>
+`))
+
+// docsMethods orders the operations of a path on the docs page
+var docsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type docsOperation struct {
+	ID, Method, Path, Summary, Description string
+	Parameters                             []docsField
+	Body                                   template.HTML
+	Responses                              []docsResponse
+}
+
+type docsField struct {
+	Name, In, Description string
+	Type                  template.HTML
+	Required              bool
+}
+
+type docsResponse struct {
+	Status, Description string
+	Type                template.HTML
+}
+
+type docsSchema struct {
+	Name, Description string
+	Properties        []docsField
+}
+
+// renderDocs renders the docs page of the embedded spec
+func renderDocs() ([]byte, error) {
+	doc, err := LoadOpenAPISpec()
+	if err != nil {
+		return nil, err
+	}
+	page := struct {
+		Title, Version, Description string
+		Operations                  []docsOperation
+		Schemas                     []docsSchema
+	}{Title: doc.Info.Title, Version: doc.Info.Version, Description: doc.Info.Description}
+
+	paths := doc.Paths.Map()
+	for _, path := range sortedKeys(paths) {
+		for _, method := range docsMethods {
+			operation := paths[path].GetOperation(method)
+			if operation == nil {
+				continue
+			}
+			op := docsOperation{
+				ID:          strings.ToLower(method) + strings.NewReplacer("/", "-", "{", "", "}", "").Replace(path),
+				Method:      method,
+				Path:        path,
+				Summary:     operation.Summary,
+				Description: operation.Description,
+			}
+			for _, parameter := range append(paths[path].Parameters, operation.Parameters...) {
+				if parameter.Value == nil {
+					continue
+				}
+				op.Parameters = append(op.Parameters, docsField{
+					Name:        parameter.Value.Name,
+					In:          parameter.Value.In,
+					Description: parameter.Value.Description,
+					Type:        schemaType(parameter.Value.Schema),
+					Required:    parameter.Value.Required,
+				})
+			}
+			if body := operation.RequestBody; body != nil && body.Value != nil {
+				if content := body.Value.Content.Get("application/json"); content != nil {
+					op.Body = schemaType(content.Schema)
+				}
+			}
+			if operation.Responses != nil {
+				responses := operation.Responses.Map()
+				for _, status := range sortedKeys(responses) {
+					response := responses[status].Value
+					if response == nil {
+						continue
+					}
+					var description string
+					if response.Description != nil {
+						description = *response.Description
+					}
+					var body template.HTML
+					if content := response.Content.Get("application/json"); content != nil {
+						body = schemaType(content.Schema)
+					}
+					op.Responses = append(op.Responses, docsResponse{Status: status, Description: description, Type: body})
+				}
+			}
+			page.Operations = append(page.Operations, op)
+		}
+	}
+
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		schema := doc.Components.Schemas[name].Value
+		if schema == nil {
+			continue
+		}
+		entry := docsSchema{Name: name, Description: schema.Description}
+		for _, property := range sortedKeys(schema.Properties) {
+			field := docsField{Name: property, Type: schemaType(schema.Properties[property])}
+			if value := schema.Properties[property].Value; value != nil {
+				field.Description = value.Description
+			}
+			for _, required := range schema.Required {
+				field.Required = field.Required || required == property
+			}
+			entry.Properties = append(entry.Properties, field)
+		}
+		page.Schemas = append(page.Schemas, entry)
+	}
+
+	var out bytes.Buffer
+	err = docsPage.Execute(&out, page)
+	return out.Bytes(), err
+}
+
+// schemaType describes a schema on the docs page, linking schemas of the components to their section
+func schemaType(ref *openapi3.SchemaRef) template.HTML {
+	if ref == nil {
+		return ""
+	}
+	if name, ok := strings.CutPrefix(ref.Ref, "#/components/schemas/"); ok {
+		escaped := template.HTMLEscapeString(name)
+		return template.HTML(`<a href="#schema-` + escaped + `">` + escaped + `</a>`)
+	}
+	schema := ref.Value
+	if schema == nil {
+		return ""
+	}
+	if schema.Type == openapi3.TypeArray {
+		return "array of " + schemaType(schema.Items)
+	}
+	description := template.HTMLEscapeString(schema.Type)
+	if schema.Format != "" {
+		description += " (" + template.HTMLEscapeString(schema.Format) + ")"
+	}
+	return template.HTML(description)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LoadOpenAPISpec parses and validates the OpenAPI spec embedded in the binary
+func LoadOpenAPISpec() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(receiptprocessor.OpenAPISpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(openapi3.NewLoader().Context); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// newOpenAPIRouter matches requests to the operations of the embedded spec
+func newOpenAPIRouter() (routers.Router, error) {
+	doc, err := LoadOpenAPISpec()
+	if err != nil {
+		return nil, err
+	}
+	return gorillamux.NewRouter(doc)
+}
+
+// validationOptions reports schema violations by their JSON pointer instead of dumping the schema
+func validationOptions() *openapi3filter.Options {
+	options := &openapi3filter.Options{
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		IncludeResponseStatus: true,
+		MultiError:            true,
+	}
+	options.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+		if err.Origin != nil || err.Reason == "" {
+			return ""
+		}
+		if pointer := err.JSONPointer(); len(pointer) > 0 {
+			return "field `/" + strings.Join(pointer, "/") + "` " + err.Reason
+		}
+		return err.Reason
+	})
+	return options
+}
+
+// matchOpenAPI finds the spec operation of the request for validateRequest, and validates
+// the response against it when ValidateResponses is set. Requests the spec does not
+// describe are left to the router.
+func (rs *ReceiptServer) matchOpenAPI(c *gin.Context) {
+	route, params, err := rs.openAPI.FindRoute(c.Request)
+	if err != nil {
+		c.Next()
+		return
+	}
+	input := &openapi3filter.RequestValidationInput{
+		Request:    c.Request,
+		PathParams: params,
+		Route:      route,
+		Options:    validationOptions(),
+	}
+	c.Set(openAPIKey, input)
+
+	if !rs.ValidateResponses || !respondsWithJSON(route.Operation) {
+		c.Next()
+		return
+	}
+
+	writer := &bufferedWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+
+	err = openapi3filter.ValidateResponse(c.Request.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 writer.Status(),
+		Header:                 writer.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(writer.body.Bytes())),
+		Options:                input.Options,
+	})
+	if err != nil {
+		log.Printf("response of %s %s violates the spec: %v\n", c.Request.Method, route.Path, err)
+		c.Writer.Header().Del("Content-Type")
+		handleError(c, http.StatusInternalServerError, CodeInternal, "the response does not match the api spec")
+		return
+	}
+	c.Writer.Write(writer.body.Bytes())
+}
+
+// validateRequest rejects requests whose parameters or body do not match the spec, it runs
+// after authorize so unauthenticated requests are still answered with 401
+func (rs *ReceiptServer) validateRequest(c *gin.Context) {
+	value, ok := c.Get(openAPIKey)
+	if !ok {
+		c.Next()
+		return
+	}
+	input := value.(*openapi3filter.RequestValidationInput)
+
+	// The handlers bind bodies as JSON whatever their content type, so the spec is checked the same way
+	if input.Route.Operation.RequestBody != nil && c.Request.Body != http.NoBody && c.ContentType() == "" {
+		c.Request.Header.Set("Content-Type", gin.MIMEJSON)
+	}
+	if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+		handleValidationError(c, err)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// respondsWithJSON reports whether every successful response of the operation is JSON,
+// streams, files and pages are not buffered for validation
+func respondsWithJSON(operation *openapi3.Operation) bool {
+	for status, response := range operation.Responses.Map() {
+		if !strings.HasPrefix(status, "2") || response.Value == nil {
+			continue
+		}
+		for contentType := range response.Value.Content {
+			if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != gin.MIMEJSON {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// bufferedWriter holds the response body back until it has been validated
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (rs *ReceiptServer) getOpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", receiptprocessor.OpenAPISpec)
+}
+
+func (rs *ReceiptServer) getDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", rs.docs)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	receiptprocessor "github.com/VineethKanaparthi/receipt-processor"
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOpenAPIRoutes fails when a route is added to the server without documenting it in api.yml, or the other way around
+func TestOpenAPIRoutes(t *testing.T) {
+	doc, err := LoadOpenAPISpec()
+	if err != nil {
+		t.Fatalf("invalid openapi spec: %v", err)
+	}
+	documented := []string{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	server := NewReceiptServer()
+	served := []string{}
+	for _, route := range server.Routes() {
+		segments := strings.Split(route.Path, "/")
+		for i, segment := range segments {
+			if name, ok := strings.CutPrefix(segment, ":"); ok {
+				segments[i] = "{" + name + "}"
+			}
+		}
+		served = append(served, route.Method+" "+strings.Join(segments, "/"))
+	}
+
+	sort.Strings(documented)
+	sort.Strings(served)
+	assert.Equal(t, documented, served)
+}
+
+func TestOpenAPIValidation(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	key := newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		code    int
+		message string
+	}{
+		{"receipt without items", "POST", "/receipts/process", `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [], "total": "1.25"}`, http.StatusBadRequest, `"field":"/items"`},
+		{"receipt without total", "POST", "/receipts/process", `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Pepsi", "price": "1.25"}]}`, http.StatusBadRequest, "total"},
+		{"v1 receipt skipped by daylight saving time", "POST", "/receipts/process", `{"retailer": "Target", "purchaseDate": "2024-03-10", "purchaseTime": "02:30", "timeZone": "America/New_York", "items": [{"shortDescription": "Pepsi", "price": "1.25"}], "total": "1.25"}`, http.StatusBadRequest, "does not exist in America/New_York"},
+		{"v1 receipt with an invalid offset", "POST", "/receipts/process", `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "purchaseOffset": "5h", "items": [{"shortDescription": "Pepsi", "price": "1.25"}], "total": "1.25"}`, http.StatusBadRequest, "purchaseOffset"},
+		{"unknown stream status", "GET", "/receipts/stream?status=lost", "", http.StatusBadRequest, "value is not one of the allowed values"},
+		{"graphql without query", "POST", "/graphql", `{}`, http.StatusBadRequest, "query"},
+		{"valid receipt", "POST", "/receipts/process", simpleReceiptJSON, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(test.method, test.path, bytes.NewBufferString(test.body))
+			req.Header.Set(APIKeyHeader, key)
+			server.ServeHTTP(w, req)
+			assert.Equal(t, test.code, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), test.message)
+		})
+	}
+
+	// Invalid requests without credentials are still unauthorized rather than invalid
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", "/receipts/process", bytes.NewBufferString(`{}`)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOpenAPIDocs(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.yaml", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Equal(t, receiptprocessor.OpenAPISpec, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	// The page is rendered from the spec and loads no scripts
+	assert.Contains(t, w.Body.String(), `<code>/receipts/process</code>`)
+	assert.Contains(t, w.Body.String(), `<a href="#schema-Receipt">Receipt</a>`)
+	assert.NotContains(t, w.Body.String(), "<script")
+}
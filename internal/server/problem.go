@@ -0,0 +1,192 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ProblemContentType is the media type of error responses, see RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix prefixes the error code to form the problem type URI
+const problemTypePrefix = "urn:receipt-processor:problem:"
+
+// Error codes of problem responses. They are stable, clients should branch on them rather than on the detail.
+const (
+	// CodeInvalidRequest is a request that cannot be read, like malformed JSON
+	CodeInvalidRequest = "invalid_request"
+	// CodeValidationFailed is a request with invalid fields, they are listed in errors
+	CodeValidationFailed = "validation_failed"
+	// CodeInvalidID is an id path parameter that is not a uuid
+	CodeInvalidID        = "invalid_id"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	// CodeNotProcessed is a receipt whose points are asked for before it was processed
+	CodeNotProcessed = "not_processed"
+	// CodeInvalidState is a review decision or reversal of a receipt not in the status it requires
+	CodeInvalidState = "invalid_state"
+	// CodeConflict is a resource that already exists, like a retailer ID or alias
+	CodeConflict = "conflict"
+	// CodeInsufficientPoints is a redemption of more points than the account's balance
+	CodeInsufficientPoints = "insufficient_points"
+	// CodeRateLimited is a client submitting faster than the rate limit
+	CodeRateLimited = "rate_limited"
+	// CodeLimitExceeded is a submission over a daily cap
+	CodeLimitExceeded = "limit_exceeded"
+	CodeInternal      = "internal_error"
+)
+
+// Problem is an RFC 7807 error response, extended with a stable code, the invalid fields and the request ID
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a single invalid field of a request
+type FieldError struct {
+	// In is where the field is: body, path, query or header
+	In string `json:"in"`
+	// Field is a JSON pointer into the body, or the name of the parameter
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (err *FieldError) Error() string {
+	if err.Field == "" {
+		return err.Message
+	}
+	return fmt.Sprintf("%s `%s` %s", err.In, err.Field, err.Message)
+}
+
+func init() {
+	// Validation errors name fields by their JSON name, like the paths clients send
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// handleError writes a problem response with the stable error code and a human readable detail
+func handleError(c *gin.Context, statusCode int, code, detail string) {
+	writeProblem(c, Problem{Status: statusCode, Code: code, Detail: detail})
+}
+
+// handleValidationError writes a 400 problem response listing the invalid fields of err, which
+// comes from binding the request, validating the receipt or checking the request against the spec
+func handleValidationError(c *gin.Context, err error) {
+	fields := fieldErrors(err)
+	if len(fields) == 0 {
+		handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	detail := fields[0].Error()
+	if len(fields) > 1 {
+		detail += fmt.Sprintf(" and %d more", len(fields)-1)
+	}
+	writeProblem(c, Problem{Status: http.StatusBadRequest, Code: CodeValidationFailed, Detail: detail, Errors: fields})
+}
+
+func writeProblem(c *gin.Context, problem Problem) {
+	problem.Type = problemTypePrefix + problem.Code
+	problem.Title = http.StatusText(problem.Status)
+	problem.Instance = c.Request.URL.Path
+	problem.RequestID = c.GetString(requestIDKey)
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(problem.Status, problem)
+}
+
+// indexPattern matches the slice indexes of validator namespaces
+var indexPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// fieldErrors lists the invalid fields reported by err, it is empty when err does not report fields
+func fieldErrors(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	var receiptErr *model.ValidationError
+	var typeErr *json.UnmarshalTypeError
+	var fieldErr *FieldError
+	switch {
+	case errors.As(err, &fieldErr):
+		return []FieldError{*fieldErr}
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			// Receipt.items[0].price becomes /items/0/price
+			_, path, _ := strings.Cut(fieldErr.Namespace(), ".")
+			path = indexPattern.ReplaceAllString(path, ".$1")
+			fields = append(fields, FieldError{
+				In:      "body",
+				Field:   "/" + strings.ReplaceAll(path, ".", "/"),
+				Message: "failed the " + fieldErr.Tag() + " validation",
+			})
+		}
+		return fields
+	case errors.As(err, &receiptErr):
+		return []FieldError{{In: "body", Field: "/" + receiptErr.Field, Message: receiptErr.Message}}
+	case errors.As(err, &typeErr):
+		return []FieldError{{In: "body", Field: "/" + strings.ReplaceAll(typeErr.Field, ".", "/"), Message: "must be a " + typeErr.Value}}
+	}
+
+	var fields []FieldError
+	var walk func(err error, in, name string)
+	walk = func(err error, in, name string) {
+		switch err := err.(type) {
+		case openapi3.MultiError:
+			for _, err := range err {
+				walk(err, in, name)
+			}
+		case *openapi3filter.RequestError:
+			if err.Parameter != nil {
+				in, name = err.Parameter.In, err.Parameter.Name
+			} else if err.RequestBody != nil {
+				in = "body"
+			}
+			if err.Err == nil {
+				fields = append(fields, FieldError{In: in, Field: name, Message: err.Reason})
+				return
+			}
+			walk(err.Err, in, name)
+		case *openapi3.SchemaError:
+			field := name
+			if pointer := err.JSONPointer(); in == "body" && len(pointer) > 0 {
+				field = "/" + strings.Join(pointer, "/")
+			}
+			message := err.Reason
+			if err.Origin != nil {
+				message = err.Origin.Error()
+			}
+			fields = append(fields, FieldError{In: in, Field: field, Message: message})
+		default:
+			// Parameters that cannot be parsed, malformed bodies are not a field error
+			if in != "" && name != "" {
+				fields = append(fields, FieldError{In: in, Field: name, Message: err.Error()})
+			}
+		}
+	}
+	walk(err, "", "")
+	return fields
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProblemResponses(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	key := newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		body   string
+		status int
+		code   string
+		fields []FieldError
+	}{
+		{"missing api key", "GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab", "", "", http.StatusUnauthorized, CodeUnauthorized, nil},
+		{"missing scope", "GET", "/admin/keys", key, "", http.StatusForbidden, CodeForbidden, nil},
+		{"malformed json", "POST", "/receipts/process", key, `{"retailer":`, http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"invalid fields", "POST", "/receipts/process", key, `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Pepsi", "price": "a1.25"}], "total": 1.25}`, http.StatusBadRequest, CodeValidationFailed, []FieldError{
+			{In: "body", Field: "/items/0/price", Message: `string doesn't match the regular expression "^\d+\.\d{2}$"`},
+			{In: "body", Field: "/total", Message: `value must be a string`},
+		}},
+		{"invalid purchase time", "POST", "/receipts/process", key, `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "25:00", "items": [{"shortDescription": "Pepsi", "price": "1.25"}], "total": "1.25"}`, http.StatusBadRequest, CodeValidationFailed, []FieldError{
+			{In: "body", Field: "/purchaseTime", Message: "is not in the correct format"},
+		}},
+		{"invalid stream filter", "GET", "/receipts/stream?minPoints=many", key, "", http.StatusBadRequest, CodeValidationFailed, nil},
+		{"invalid id", "GET", "/receipts/123/points", key, "", http.StatusBadRequest, CodeInvalidID, nil},
+		{"unknown receipt", "GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab/points", key, "", http.StatusNotFound, CodeNotFound, nil},
+		{"unknown route", "GET", "/receipt", key, "", http.StatusNotFound, CodeNotFound, nil},
+		{"method not allowed", "DELETE", "/receipts/process", key, "", http.StatusMethodNotAllowed, CodeMethodNotAllowed, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(test.method, test.path, bytes.NewBufferString(test.body))
+			if test.key != "" {
+				req.Header.Set(APIKeyHeader, test.key)
+			}
+			server.ServeHTTP(w, req)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+			var problem Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, test.status, problem.Status)
+			assert.Equal(t, test.code, problem.Code)
+			assert.Equal(t, "urn:receipt-processor:problem:"+test.code, problem.Type)
+			assert.Equal(t, http.StatusText(test.status), problem.Title)
+			assert.NotEmpty(t, problem.Detail)
+			assert.Equal(t, w.Header().Get(RequestIDHeader), problem.RequestID)
+			if test.fields != nil {
+				assert.ElementsMatch(t, test.fields, problem.Errors)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+
+	// The request ID of a client or proxy is kept
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/receipts/123", nil)
+	req.Header.Set(RequestIDHeader, "trace-42")
+	server.ServeHTTP(w, req)
+	assert.Equal(t, "trace-42", w.Header().Get(RequestIDHeader))
+	assert.Contains(t, w.Body.String(), `"requestId":"trace-42"`)
+
+	// Unsafe request IDs are replaced
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/receipts/123", nil)
+	req.Header.Set(RequestIDHeader, "a b\nc")
+	server.ServeHTTP(w, req)
+	assert.NotEqual(t, "a b\nc", w.Header().Get(RequestIDHeader))
+	assert.NotEmpty(t, w.Header().Get(RequestIDHeader))
+}
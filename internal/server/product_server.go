@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// ProductRequest is the payload of POST /admin/products and PUT /admin/products/:id
+type ProductRequest struct {
+	Name     string                 `json:"name" binding:"required"`
+	Brand    string                 `json:"brand"`
+	Matchers []model.ProductMatcher `json:"matchers" binding:"required"`
+	Bonuses  []model.ProductBonus   `json:"bonuses"`
+}
+
+func (request *ProductRequest) product() *model.Product {
+	return &model.Product{Name: request.Name, Brand: request.Brand, Matchers: request.Matchers, Bonuses: request.Bonuses}
+}
+
+func (rs *ReceiptServer) createProduct(c *gin.Context) {
+	var request ProductRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	product := request.product()
+	if err := service.CreateProduct(product, rs.DB); err != nil {
+		handleProductError(c, err, "failed to create the product")
+		return
+	}
+	c.JSON(http.StatusCreated, product)
+}
+
+func (rs *ReceiptServer) listProducts(c *gin.Context) {
+	products, err := service.ListProducts(rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list products")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"products": products})
+}
+
+func (rs *ReceiptServer) getProduct(c *gin.Context) {
+	product, err := service.GetProduct(c.Params.ByName("id"), rs.DB)
+	if err != nil {
+		handleProductError(c, err, "failed to get the product")
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+func (rs *ReceiptServer) updateProduct(c *gin.Context) {
+	var request ProductRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	product := request.product()
+	if err := service.UpdateProduct(c.Params.ByName("id"), product, rs.DB); err != nil {
+		handleProductError(c, err, "failed to update the product")
+		return
+	}
+	c.JSON(http.StatusOK, product)
+}
+
+func (rs *ReceiptServer) deleteProduct(c *gin.Context) {
+	if err := service.DeleteProduct(c.Params.ByName("id"), rs.DB); err != nil {
+		handleProductError(c, err, "failed to delete the product")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func handleProductError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrIdNotFound):
+		handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidProduct):
+		handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.Is(err, service.ErrProductExists):
+		handleError(c, http.StatusConflict, CodeConflict, err.Error())
+	default:
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, message)
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducts(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+
+	body := `{"name": "Pepsi 12oz", "brand": "Pepsi", "matchers": [{"type": "prefix", "value": "pepsi"}], "bonuses": [{"points": 40, "maxUnits": 1}]}`
+	assert.Equal(t, http.StatusForbidden, adminRequest(t, server, "POST", "/admin/products", submitKey, body).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "POST", "/admin/products", adminKey, `{"name": "Fuzzy", "matchers": [{"type": "fuzzy", "value": "pepsi"}]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "POST", "/admin/products", adminKey, `{"name": "Regex", "matchers": [{"type": "regex", "value": "("}]}`).Code)
+
+	w := adminRequest(t, server, "POST", "/admin/products", adminKey, body)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var product model.Product
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &product))
+	assert.Equal(t, http.StatusConflict, adminRequest(t, server, "POST", "/admin/products", adminKey, body).Code)
+
+	// The Pepsi line matches the prefix: 31 points plus the 40 point bonus
+	id := decodeResponse(submit(server, submitKey, simpleReceiptJSON), t).ID
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+	w = adminRequest(t, server, "GET", "/v2/receipts/"+id, adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var record ReceiptV2Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &record))
+	assert.EqualValues(t, 71, record.Points)
+	if assert.Len(t, record.Receipt.Items, 1) {
+		assert.Equal(t, &model.ProductMatch{ProductID: product.ID, Name: "Pepsi 12oz", Matcher: model.MatchPrefix}, record.Receipt.Items[0].Product)
+	}
+
+	w = adminRequest(t, server, "PUT", "/admin/products/"+product.ID, adminKey, `{"name": "Pepsi", "matchers": [{"type": "sku", "value": "PEP-12"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"bonuses":[]`)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "PUT", "/admin/products/unknown", adminKey, body).Code)
+
+	w = adminRequest(t, server, "GET", "/admin/products", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), product.ID)
+	assert.Equal(t, http.StatusOK, adminRequest(t, server, "GET", "/admin/products/"+product.ID, adminKey, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, server, "DELETE", "/admin/products/"+product.ID, adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "GET", "/admin/products/"+product.ID, adminKey, "").Code)
+}
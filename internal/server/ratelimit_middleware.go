@@ -0,0 +1,36 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimit throttles requests per client identity, it runs after authorize so every request has an account or an API key
+func (rs *ReceiptServer) rateLimit(c *gin.Context) {
+	if rs.RateLimiter == nil {
+		c.Next()
+		return
+	}
+
+	key := "client:" + c.GetString(clientKey)
+	if account := c.GetString(accountKey); account != "" {
+		key = "account:" + account
+	}
+
+	if ok, wait := rs.RateLimiter.Allow(key); !ok {
+		setRetryAfter(c, wait)
+		handleError(c, http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded, please slow down")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounded up
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
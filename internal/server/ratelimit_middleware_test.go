@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/ratelimit"
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func submit(server *ReceiptServer, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBufferString(body))
+	req.Header.Set(APIKeyHeader, key)
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	server.RateLimiter = ratelimit.New(0.5, 2)
+
+	first := newAPIKey(t, server, model.ScopeSubmit)
+	second := newAPIKey(t, server, model.ScopeSubmit)
+
+	assert.Equal(t, http.StatusOK, submit(server, first, simpleReceiptJSON).Code)
+	assert.Equal(t, http.StatusOK, submit(server, first, simpleReceiptJSON).Code)
+
+	w := submit(server, first, simpleReceiptJSON)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, retryAfter)
+
+	// Other clients have their own budget
+	assert.Equal(t, http.StatusOK, submit(server, second, simpleReceiptJSON).Code)
+}
+
+func TestDailyRetailerCap(t *testing.T) {
+	server := newTestServer(t, service.Policy{Limits: service.Limits{MaxPerRetailerPerDay: 2}})
+
+	key := newAPIKey(t, server, model.ScopeSubmit)
+	otherRetailer := bytes.Replace([]byte(simpleReceiptJSON), []byte(`"Target"`), []byte(`"Walgreens"`), 1)
+
+	assert.Equal(t, http.StatusOK, submit(server, key, simpleReceiptJSON).Code)
+	assert.Equal(t, http.StatusOK, submit(server, key, simpleReceiptJSON).Code)
+
+	w := submit(server, key, simpleReceiptJSON)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, submit(server, key, string(otherRetailer)).Code)
+}
@@ -2,34 +2,186 @@ package server
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/VineethKanaparthi/receipt-processor/internal/auth"
+	"github.com/VineethKanaparthi/receipt-processor/internal/ratelimit"
 	"github.com/VineethKanaparthi/receipt-processor/internal/service"
 	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/getkin/kin-openapi/routers"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
 	bolt "go.etcd.io/bbolt"
 )
 
 type ReceiptServer struct {
 	DB *bolt.DB
+	// JWT validates user bearer tokens, bearer authentication is disabled when nil
+	JWT *auth.Verifier
+	// RateLimiter throttles receipt submissions per client, rate limiting is disabled when nil
+	RateLimiter *ratelimit.Limiter
+	// Processor queues submitted receipts and processes them in the background
+	Processor *service.Processor
+	// ValidateResponses checks every JSON response against the OpenAPI spec and replaces
+	// violations with a 500, requests are always validated
+	ValidateResponses bool
 	*gin.Engine
+
+	schema  graphql.Schema
+	openAPI routers.Router
+	// docs is the rendered docs page of the spec
+	docs []byte
 }
 
 type ReceiptResponse struct {
-	ID string `json:"id"`
+	ID     string `json:"id"`
+	Status string `json:"status,omitempty"`
+}
+
+// ReceiptStatusResponse reports where a receipt is in its processing lifecycle
+type ReceiptStatusResponse struct {
+	ID              string     `json:"id"`
+	Status          string     `json:"status"`
+	Points          int        `json:"points"`
+	RejectionReason string     `json:"rejectionReason,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	ProcessedAt     *time.Time `json:"processedAt,omitempty"`
 }
 
 // NewReceiptServer initializes the server, creates a database with dbname and sets up the router
 func NewReceiptServer() *ReceiptServer {
 	rs := &ReceiptServer{}
+	schema, err := rs.newGraphQLSchema()
+	if err != nil {
+		log.Fatalf("invalid graphql schema: %v", err)
+	}
+	rs.schema = schema
+	openAPI, err := newOpenAPIRouter()
+	if err != nil {
+		log.Fatalf("invalid openapi spec: %v", err)
+	}
+	rs.openAPI = openAPI
+	if rs.docs, err = renderDocs(); err != nil {
+		log.Fatalf("rendering the api docs failed: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(requestID, gin.Logger(), gin.CustomRecovery(func(c *gin.Context, err any) {
+		handleError(c, http.StatusInternalServerError, CodeInternal, "the request failed unexpectedly")
+	}))
+	router.Use(rs.matchOpenAPI)
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		handleError(c, http.StatusNotFound, CodeNotFound, "no route for "+c.Request.Method+" "+c.Request.URL.Path)
+	})
+	router.NoMethod(func(c *gin.Context) {
+		handleError(c, http.StatusMethodNotAllowed, CodeMethodNotAllowed, c.Request.Method+" is not allowed on "+c.Request.URL.Path)
+	})
+	// GET /openapi.yaml endpoint
+	router.GET("/openapi.yaml", rs.getOpenAPISpec)
+	// GET /docs endpoint
+	router.GET("/docs", rs.getDocs)
 
-	router := gin.Default()
 	// POST /receipts/process endpoint
-	router.POST("/receipts/process", rs.processReceipt)
+	router.POST("/receipts/process", rs.authorize(model.ScopeSubmit), rs.rateLimit, rs.validateRequest, rs.processReceipt)
+	// GET /receipts/stream endpoint
+	router.GET("/receipts/stream", rs.authorize(model.ScopeRead), rs.validateRequest, rs.streamReceipts)
 	// GET /receipts/:id/points endpoint
-	router.GET("receipts/:id/points", rs.getPoints)
+	router.GET("receipts/:id/points", rs.authorize(model.ScopeRead), rs.validateRequest, rs.getPoints)
+	// GET /receipts/:id endpoint
+	router.GET("receipts/:id", rs.authorize(model.ScopeRead), rs.validateRequest, rs.getReceipt)
+
+	// GET /accounts/:id/expiring endpoint
+	router.GET("/accounts/:id/expiring", rs.authorize(model.ScopeRead), rs.validateRequest, rs.getExpiringPoints)
+
+	v2 := router.Group("/v2")
+	// POST /v2/receipts endpoint
+	v2.POST("/receipts", rs.authorize(model.ScopeSubmit), rs.rateLimit, rs.validateRequest, rs.processReceiptV2)
+	// GET /v2/receipts/:id/points endpoint
+	v2.GET("/receipts/:id/points", rs.authorize(model.ScopeRead), rs.validateRequest, rs.getPoints)
+	// GET /v2/receipts/:id endpoint
+	v2.GET("/receipts/:id", rs.authorize(model.ScopeRead), rs.validateRequest, rs.getReceiptV2)
+
+	// GET /graphql endpoint
+	router.GET("/graphql", rs.authorize(model.ScopeRead), rs.validateRequest, rs.graphQL)
+	// POST /graphql endpoint
+	router.POST("/graphql", rs.authorize(model.ScopeRead), rs.validateRequest, rs.graphQL)
+
+	admin := router.Group("/admin", rs.authorize(model.ScopeAdmin), rs.validateRequest)
+	// GET /admin/backup endpoint
+	admin.GET("/backup", rs.getBackup)
+	// GET /admin/keys endpoint
+	admin.GET("/keys", rs.listAPIKeys)
+	// POST /admin/keys endpoint
+	admin.POST("/keys", rs.createAPIKey)
+	// DELETE /admin/keys/:id endpoint
+	admin.DELETE("/keys/:id", rs.revokeAPIKey)
+	// GET /admin/reviews endpoint
+	admin.GET("/reviews", rs.listReviews)
+	// POST /admin/reviews/:id/approve endpoint
+	admin.POST("/reviews/:id/approve", rs.approveReview)
+	// POST /admin/reviews/:id/reject endpoint
+	admin.POST("/reviews/:id/reject", rs.rejectReview)
+	// POST /admin/receipts/:id/reverse endpoint
+	admin.POST("/receipts/:id/reverse", rs.reverseReceipt)
+	// POST /admin/accounts/:id/redemptions endpoint
+	admin.POST("/accounts/:id/redemptions", rs.redeemPoints)
+	// GET /admin/retailers endpoint
+	admin.GET("/retailers", rs.listRetailers)
+	// POST /admin/retailers endpoint
+	admin.POST("/retailers", rs.createRetailer)
+	// GET /admin/retailers/match endpoint
+	admin.GET("/retailers/match", rs.matchRetailer)
+	// GET /admin/retailers/:id endpoint
+	admin.GET("/retailers/:id", rs.getRetailer)
+	// PUT /admin/retailers/:id endpoint
+	admin.PUT("/retailers/:id", rs.updateRetailer)
+	// DELETE /admin/retailers/:id endpoint
+	admin.DELETE("/retailers/:id", rs.deleteRetailer)
+	// GET /admin/campaigns endpoint
+	admin.GET("/campaigns", rs.listCampaigns)
+	// POST /admin/campaigns endpoint
+	admin.POST("/campaigns", rs.createCampaign)
+	// GET /admin/campaigns/:id endpoint
+	admin.GET("/campaigns/:id", rs.getCampaign)
+	// PUT /admin/campaigns/:id endpoint
+	admin.PUT("/campaigns/:id", rs.updateCampaign)
+	// DELETE /admin/campaigns/:id endpoint
+	admin.DELETE("/campaigns/:id", rs.deleteCampaign)
+	// GET /admin/products endpoint
+	admin.GET("/products", rs.listProducts)
+	// POST /admin/products endpoint
+	admin.POST("/products", rs.createProduct)
+	// GET /admin/products/:id endpoint
+	admin.GET("/products/:id", rs.getProduct)
+	// PUT /admin/products/:id endpoint
+	admin.PUT("/products/:id", rs.updateProduct)
+	// DELETE /admin/products/:id endpoint
+	admin.DELETE("/products/:id", rs.deleteProduct)
+	// GET /admin/rules endpoint
+	admin.GET("/rules", rs.listCustomRules)
+	// POST /admin/rules endpoint
+	admin.POST("/rules", rs.createCustomRule)
+	// GET /admin/rules/:id endpoint
+	admin.GET("/rules/:id", rs.getCustomRule)
+	// PUT /admin/rules/:id endpoint
+	admin.PUT("/rules/:id", rs.updateCustomRule)
+	// DELETE /admin/rules/:id endpoint
+	admin.DELETE("/rules/:id", rs.deleteCustomRule)
+
+	webhooks := router.Group("/webhooks", rs.authorize(model.ScopeAdmin), rs.validateRequest)
+	// POST /webhooks endpoint
+	webhooks.POST("", rs.createWebhook)
+	// GET /webhooks endpoint
+	webhooks.GET("", rs.listWebhooks)
+	// DELETE /webhooks/:id endpoint
+	webhooks.DELETE("/:id", rs.deleteWebhook)
+	// GET /webhooks/:id/deliveries endpoint
+	webhooks.GET("/:id/deliveries", rs.listDeliveries)
 
 	rs.Engine = router
 	return rs
@@ -39,49 +191,97 @@ func (rs *ReceiptServer) processReceipt(c *gin.Context) {
 	var receipt model.Receipt
 
 	if err := c.ShouldBindJSON(&receipt); err != nil {
-		handleError(c, http.StatusBadRequest, err.Error())
+		handleValidationError(c, err)
 		return
 	}
 
-	if err := receipt.Validate(); err != nil {
-		handleError(c, http.StatusBadRequest, err.Error())
+	submitter := service.Submitter{ClientID: c.GetString(clientKey), AccountID: c.GetString(accountKey)}
+	id, ok := rs.submitReceipt(c, &receipt, submitter)
+	if !ok {
 		return
 	}
 
-	id, err := service.ProcessReceipt(&receipt, rs.DB)
+	c.JSON(http.StatusOK, ReceiptResponse{ID: id, Status: model.StatusAccepted})
+}
+
+// submitReceipt validates the receipt and queues it for processing, writing the error
+// response when it is invalid or over a limit. It is shared by both API versions.
+func (rs *ReceiptServer) submitReceipt(c *gin.Context, receipt *model.Receipt, submitter service.Submitter) (string, bool) {
+	if err := receipt.Validate(); err != nil {
+		handleValidationError(c, err)
+		return "", false
+	}
+
+	id, err := rs.Processor.Submit(receipt, submitter)
+	var limitErr *service.LimitError
+	if errors.As(err, &limitErr) {
+		setRetryAfter(c, limitErr.RetryAfter)
+		handleError(c, http.StatusTooManyRequests, CodeLimitExceeded, limitErr.Error())
+		return "", false
+	}
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process the receipt, please try again"})
-		return
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to process the receipt, please try again")
+		return "", false
 	}
-
-	c.JSON(http.StatusOK, gin.H{"id": id})
+	return id, true
 }
 
 func (rs *ReceiptServer) getPoints(c *gin.Context) {
-	id := c.Params.ByName("id")
-	if _, err := uuid.Parse(id); err != nil {
-		handleError(c, http.StatusBadRequest, "id is not a uuid")
+	record, ok := rs.loadReceipt(c)
+	if !ok {
+		return
+	}
+	if !record.Processed() {
+		handleError(c, http.StatusConflict, CodeNotProcessed, fmt.Sprintf("%s, status is %s", service.ErrNotProcessed, record.Status))
 		return
 	}
 
-	points, err := service.GetPoints(id, rs.DB)
-	if err != nil {
-		handleGetPointsError(err, c)
+	c.JSON(http.StatusOK, gin.H{"points": record.CreditedPoints()})
+}
+
+func (rs *ReceiptServer) getReceipt(c *gin.Context) {
+	record, ok := rs.loadReceipt(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"points": points})
+	c.JSON(http.StatusOK, ReceiptStatusResponse{
+		ID:              record.ID,
+		Status:          record.Status,
+		Points:          record.CreditedPoints(),
+		RejectionReason: record.RejectionReason,
+		CreatedAt:       record.CreatedAt,
+		ProcessedAt:     record.ProcessedAt,
+	})
 }
 
-func handleError(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode, gin.H{"error": message})
+// loadReceipt looks up the receipt in the id path parameter, writing the error response when it
+// is invalid or not found. Users authenticated by a token can only see receipts credited to their own account.
+func (rs *ReceiptServer) loadReceipt(c *gin.Context) (*model.ReceiptRecord, bool) {
+	id := c.Params.ByName("id")
+	if _, err := uuid.Parse(id); err != nil {
+		handleError(c, http.StatusBadRequest, CodeInvalidID, "id is not a uuid")
+		return nil, false
+	}
+
+	record, err := service.GetReceipt(id, rs.DB)
+	if err == nil {
+		if account := c.GetString(accountKey); account != "" && record.AccountID != account {
+			err = service.ErrIdNotFound
+		}
+	}
+	if err != nil {
+		handleGetPointsError(err, c)
+		return nil, false
+	}
+	return record, true
 }
 
 func handleGetPointsError(err error, c *gin.Context) {
 	if errors.Is(err, service.ErrIdNotFound) {
-		handleError(c, http.StatusNotFound, err.Error())
+		handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
 	} else {
-		handleError(c, http.StatusInternalServerError, "failed to get points for the id")
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to get points for the id")
 	}
 }
@@ -5,22 +5,25 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetPoints(t *testing.T) {
-	db := database.NewBoltDatabase(":memory:")
-	server := NewReceiptServer()
-	server.DB = db
-	defer db.Close()
+	server := newTestServer(t, service.Policy{})
+	key := newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead, model.ScopeAdmin)
 	// Test /receipts/:id/points endpoint with invalid id
 	t.Run("GET /receipts/:id/points", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/receipts/123/points", nil)
+		req.Header.Set(APIKeyHeader, key)
 		server.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusBadRequest, w.Code)
@@ -30,6 +33,7 @@ func TestGetPoints(t *testing.T) {
 	t.Run("GET /receipts/:id/points", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/receipts/d49ae048-61cc-4236-a258-1c4b3c2362ab/points", nil)
+		req.Header.Set(APIKeyHeader, key)
 		server.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusNotFound, w.Code)
@@ -37,14 +41,13 @@ func TestGetPoints(t *testing.T) {
 }
 
 func TestProcessReceipt(t *testing.T) {
-	db := database.NewBoltDatabase(":memory:")
-	server := NewReceiptServer()
-	server.DB = db
-	defer db.Close()
+	server := newTestServer(t, service.Policy{})
+	key := newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead, model.ScopeAdmin)
 	// Test /receipts/process endpoint invalid json
 	t.Run("POST /receipts/process", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", nil)
+		req.Header.Set(APIKeyHeader, key)
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
 	})
@@ -78,6 +81,7 @@ func TestProcessReceipt(t *testing.T) {
 		  }`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set(APIKeyHeader, key)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusBadRequest, w.Code)
@@ -112,6 +116,7 @@ func TestProcessReceipt(t *testing.T) {
 			}`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set(APIKeyHeader, key)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
@@ -147,6 +152,7 @@ func TestProcessReceipt(t *testing.T) {
 			  }`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set(APIKeyHeader, key)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
@@ -182,6 +188,7 @@ func TestProcessReceipt(t *testing.T) {
 			  }`
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set(APIKeyHeader, key)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
@@ -217,6 +224,7 @@ func TestProcessReceipt(t *testing.T) {
 
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("POST", "/receipts/process", bytes.NewBuffer([]byte(receiptJSON)))
+		req.Header.Set(APIKeyHeader, key)
 		req.Header.Set("Content-Type", "application/json")
 		server.ServeHTTP(w, req)
 
@@ -225,19 +233,75 @@ func TestProcessReceipt(t *testing.T) {
 		// Unmarshal response to check if it contains 'id'
 		receiptResponse := decodeResponse(w, t)
 		assertUUID(receiptResponse.ID, t)
+		assert.Equal(t, model.StatusAccepted, receiptResponse.Status)
 
+		// Points are only available once a worker has processed the receipt
 		w = httptest.NewRecorder()
 		req, _ = http.NewRequest("GET", "/receipts/"+receiptResponse.ID+"/points", nil)
+		req.Header.Set(APIKeyHeader, key)
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		processed, err := server.Processor.ProcessPending()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, processed)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/receipts/"+receiptResponse.ID, nil)
+		req.Header.Set(APIKeyHeader, key)
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var status ReceiptStatusResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		assert.Equal(t, model.StatusScored, status.Status)
+		assert.NotNil(t, status.ProcessedAt)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/receipts/"+receiptResponse.ID+"/points", nil)
+		req.Header.Set(APIKeyHeader, key)
 		server.ServeHTTP(w, req)
 		assert.Equal(t, http.StatusOK, w.Code)
 		var response map[string]int
-		err := json.Unmarshal(w.Body.Bytes(), &response)
+		err = json.Unmarshal(w.Body.Bytes(), &response)
 		assertNoErrorWhileDecodingJson(err, t, w)
 		assert.Contains(t, response, "points")
 	})
 
 }
 
+// newTestServer returns a server on a fresh database. Its processor has no workers running,
+// tests call ProcessPending to run the pipeline deterministically.
+func newTestServer(t testing.TB, policy service.Policy) *ReceiptServer {
+	t.Helper()
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	t.Cleanup(func() { db.Close() })
+	server := NewReceiptServer()
+	server.DB = db
+	server.Processor = service.NewProcessor(db, policy, 1)
+	server.ValidateResponses = true
+	return server
+}
+
+// newAPIKey creates an API key with the given scopes for authorizing test requests
+func newAPIKey(t testing.TB, server *ReceiptServer, scopes ...string) string {
+	t.Helper()
+	key, _, err := service.CreateAPIKey("test", scopes, server.DB)
+	if err != nil {
+		t.Fatalf("failed to create api key: %v", err)
+	}
+	return key
+}
+
+// adminRequest sends a request with the API key, the body is JSON or empty
+func adminRequest(t testing.TB, server *ReceiptServer, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set(APIKeyHeader, key)
+	server.ServeHTTP(w, req)
+	return w
+}
+
 func decodeResponse(response *httptest.ResponseRecorder, t testing.TB) ReceiptResponse {
 	t.Helper()
 	var got ReceiptResponse
@@ -274,3 +338,90 @@ func assertStatusCode(response *httptest.ResponseRecorder, status int, t testing
 		t.Errorf("Expected response code %d, but got %d", status, response.Code)
 	}
 }
+
+func TestGetBackup(t *testing.T) {
+	dir := t.TempDir()
+	db := database.NewBoltDatabase(filepath.Join(dir, "receipts.db"))
+	server := NewReceiptServer()
+	server.DB = db
+	defer db.Close()
+	key := newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead, model.ScopeAdmin)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/backup", nil)
+	req.Header.Set(APIKeyHeader, key)
+	server.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	snapshot := filepath.Join(dir, "backup.db")
+	assert.NoError(t, os.WriteFile(snapshot, w.Body.Bytes(), 0600))
+	assert.NoError(t, database.ValidateSnapshot(snapshot))
+}
+
+func TestProcessItemizedReceipt(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	key := newAPIKey(t, server, model.ScopeSubmit)
+	itemized := func(change func(receipt map[string]interface{})) string {
+		receipt := map[string]interface{}{
+			"retailer":     "Target",
+			"purchaseDate": "2022-01-01",
+			"purchaseTime": "13:01",
+			"items": []map[string]interface{}{
+				{"shortDescription": "Mountain Dew 12PK", "price": "17.47", "quantity": 3, "unitPrice": "6.49", "discount": "2.00", "sku": "MD-12", "upc": "012000161155"},
+				{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+			},
+			"subtotal":  "28.00",
+			"discounts": []map[string]string{{"description": "Coupon", "amount": "1.72"}},
+			"taxes":     []map[string]string{{"description": "Sales tax", "amount": "2.40"}},
+			"tip":       "0.60",
+			"total":     "31.00",
+			"payments":  []map[string]string{{"tender": "gift_card", "amount": "10.00"}, {"tender": "credit", "amount": "21.00"}},
+		}
+		if change != nil {
+			change(receipt)
+		}
+		body, _ := json.Marshal(receipt)
+		return string(body)
+	}
+	item := func(receipt map[string]interface{}) map[string]interface{} {
+		return receipt["items"].([]map[string]interface{})[0]
+	}
+
+	tests := []struct {
+		name   string
+		change func(receipt map[string]interface{})
+		field  string
+	}{
+		{"valid", nil, ""},
+		{"line price", func(r map[string]interface{}) { item(r)["price"] = "19.47" }, "/items/0/price"},
+		{"check digit", func(r map[string]interface{}) { item(r)["upc"] = "012000161156" }, "/items/0/upc"},
+		{"quantity", func(r map[string]interface{}) { item(r)["quantity"] = 10000000 }, "/items/0/quantity"},
+		{"quantity without unit price", func(r map[string]interface{}) { delete(item(r), "unitPrice") }, "/items/0/unitPrice"},
+		{"subtotal", func(r map[string]interface{}) { r["subtotal"] = "29.72" }, "/subtotal"},
+		{"total", func(r map[string]interface{}) { r["total"] = "31.25"; delete(r, "payments") }, "/total"},
+		{"payments", func(r map[string]interface{}) {
+			r["payments"] = []map[string]string{{"tender": "cash", "amount": "30.00"}}
+		}, "/payments"},
+		{"tender", func(r map[string]interface{}) {
+			r["payments"] = []map[string]string{{"tender": "barter", "amount": "31.00"}}
+		}, "/payments/0/tender"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := submit(server, key, itemized(test.change))
+			if test.field == "" {
+				assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var problem Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			if assert.NotEmpty(t, problem.Errors) {
+				assert.Equal(t, test.field, problem.Errors[0].Field)
+			}
+		})
+	}
+}
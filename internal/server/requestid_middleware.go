@@ -0,0 +1,29 @@
+package server
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the request and response header carrying the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the gin context key holding the request ID
+const requestIDKey = "requestId"
+
+// requestIDPattern restricts the request IDs accepted from clients and proxies to safe log tokens
+var requestIDPattern = regexp.MustCompile(`^[\w\-.]{1,64}$`)
+
+// requestID tags the request with the ID sent by the client or a proxy, or a new one,
+// and echoes it in the response so errors can be matched with the server logs
+func requestID(c *gin.Context) {
+	id := c.GetHeader(RequestIDHeader)
+	if !requestIDPattern.MatchString(id) {
+		id = uuid.NewString()
+	}
+	c.Set(requestIDKey, id)
+	c.Header(RequestIDHeader, id)
+	c.Next()
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// RetailerRequest is the payload of POST /admin/retailers and PUT /admin/retailers/:id
+type RetailerRequest struct {
+	// ID is derived from the name when empty, it cannot be changed
+	ID      string   `json:"id"`
+	Name    string   `json:"name" binding:"required"`
+	Aliases []string `json:"aliases"`
+}
+
+func (rs *ReceiptServer) createRetailer(c *gin.Context) {
+	var request RetailerRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	retailer := &model.Retailer{ID: request.ID, Name: request.Name, Aliases: request.Aliases}
+	if err := service.CreateRetailer(retailer, rs.DB); err != nil {
+		handleRetailerError(c, err, "failed to create the retailer")
+		return
+	}
+	c.JSON(http.StatusCreated, retailer)
+}
+
+func (rs *ReceiptServer) listRetailers(c *gin.Context) {
+	retailers, err := service.ListRetailers(rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list retailers")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"retailers": retailers})
+}
+
+func (rs *ReceiptServer) getRetailer(c *gin.Context) {
+	retailer, err := service.GetRetailer(c.Params.ByName("id"), rs.DB)
+	if err != nil {
+		handleRetailerError(c, err, "failed to get the retailer")
+		return
+	}
+	c.JSON(http.StatusOK, retailer)
+}
+
+func (rs *ReceiptServer) updateRetailer(c *gin.Context) {
+	var request RetailerRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	id := c.Params.ByName("id")
+	if request.ID != "" && request.ID != id {
+		handleError(c, http.StatusBadRequest, CodeInvalidRequest, "the id of a retailer cannot be changed")
+		return
+	}
+
+	retailer, err := service.UpdateRetailer(id, request.Name, request.Aliases, rs.DB)
+	if err != nil {
+		handleRetailerError(c, err, "failed to update the retailer")
+		return
+	}
+	c.JSON(http.StatusOK, retailer)
+}
+
+func (rs *ReceiptServer) deleteRetailer(c *gin.Context) {
+	if err := service.DeleteRetailer(c.Params.ByName("id"), rs.DB); err != nil {
+		handleRetailerError(c, err, "failed to delete the retailer")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// matchRetailer shows which retailer a receipt naming the retailer would be credited to
+func (rs *ReceiptServer) matchRetailer(c *gin.Context) {
+	name := c.Query("name")
+	match, err := service.MatchRetailer(name, rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to match the retailer")
+		return
+	}
+	if match == nil {
+		handleError(c, http.StatusNotFound, CodeNotFound, "no retailer matches "+name)
+		return
+	}
+	c.JSON(http.StatusOK, match)
+}
+
+func handleRetailerError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrIdNotFound):
+		handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidRetailer):
+		handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	case errors.Is(err, service.ErrRetailerExists):
+		handleError(c, http.StatusConflict, CodeConflict, err.Error())
+	default:
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, message)
+	}
+}
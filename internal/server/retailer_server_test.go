@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetailers(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+
+	assert.Equal(t, http.StatusForbidden, adminRequest(t, server, "POST", "/admin/retailers", submitKey, `{"name": "Target"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "POST", "/admin/retailers", adminKey, `{"id": "Not A Slug", "name": "Target"}`).Code)
+
+	w := adminRequest(t, server, "POST", "/admin/retailers", adminKey, `{"id": "mm-corner-market", "name": "M&M Corner Market", "aliases": ["MM Corner"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = adminRequest(t, server, "POST", "/admin/retailers", adminKey, `{"name": "M&M Corner"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), CodeConflict)
+
+	w = adminRequest(t, server, "GET", "/admin/retailers/match?name=M+%26+M+CORNER+MKT", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"retailerId": "mm-corner-market", "name": "M&M Corner Market", "match": "name"}`, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "GET", "/admin/retailers/match?name=Walgreens", adminKey, "").Code)
+
+	// Receipts keep the retailer as sent next to the canonical one
+	id := decodeResponse(submit(server, submitKey, `{"retailer": "M & M CORNER MKT", "purchaseDate": "2022-01-02", "purchaseTime": "10:00", "items": [{"shortDescription": "Pepsi", "price": "1.25"}], "total": "1.25"}`), t).ID
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+	w = adminRequest(t, server, "GET", "/v2/receipts/"+id, adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var record ReceiptV2Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &record))
+	assert.Equal(t, "M & M CORNER MKT", record.Receipt.Retailer)
+	assert.Equal(t, &model.RetailerMatch{RetailerID: "mm-corner-market", Name: "M&M Corner Market", Match: model.RetailerMatchName}, record.Receipt.CanonicalRetailer)
+	assert.EqualValues(t, 39, record.Points)
+
+	// The canonical retailer is set on ingest, clients cannot send it
+	w = submit(server, submitKey, `{"retailer": "Target", "purchaseDate": "2022-01-02", "purchaseTime": "10:00", "items": [{"shortDescription": "Pepsi", "price": "1.25"}], "total": "1.25", "canonicalRetailer": {"retailerId": "target", "name": "Target", "match": "name"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = adminRequest(t, server, "PUT", "/admin/retailers/mm-corner-market", adminKey, `{"name": "M&M Market", "aliases": []}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"M\u0026M Market"`)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "PUT", "/admin/retailers/mm-corner-market", adminKey, `{"id": "other", "name": "M&M Market"}`).Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "PUT", "/admin/retailers/unknown", adminKey, `{"name": "Unknown"}`).Code)
+
+	w = adminRequest(t, server, "GET", "/admin/retailers", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "mm-corner-market")
+	assert.Equal(t, http.StatusOK, adminRequest(t, server, "GET", "/admin/retailers/mm-corner-market", adminKey, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, server, "DELETE", "/admin/retailers/mm-corner-market", adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "GET", "/admin/retailers/mm-corner-market", adminKey, "").Code)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// Tuning of the receipt stream
+const (
+	// streamBatch is how many stored events are read at a time while catching up
+	streamBatch = 100
+	// streamHeartbeat is how often idle streams send a comment to keep proxies from closing them
+	streamHeartbeat = 15 * time.Second
+)
+
+// feedStatuses are the statuses receipts can finish processing with
+var feedStatuses = map[string]bool{
+	model.StatusScored:        true,
+	model.StatusPendingReview: true,
+	model.StatusRejected:      true,
+}
+
+// streamReceipts pushes receipts to the client as server-sent events as they finish processing.
+// New streams start with the next event, clients resume after the last event they received with the Last-Event-ID header.
+func (rs *ReceiptServer) streamReceipts(c *gin.Context) {
+	filter, err := parseFeedFilter(c)
+	if err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	// Users authenticated by a token only see their own receipts
+	if account := c.GetString(accountKey); account != "" {
+		filter.AccountID = account
+	}
+
+	feed := rs.Processor.Feed
+	var last uint64
+	if id := c.GetHeader("Last-Event-ID"); id != "" {
+		last, err = strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			handleValidationError(c, &FieldError{In: "header", Field: "Last-Event-ID", Message: "is not a sequence number"})
+			return
+		}
+	} else if last, err = feed.Head(); err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to read the receipt feed")
+		return
+	}
+
+	updates, cancel := feed.Subscribe()
+	defer cancel()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	// Send the headers right away, a new stream may wait for its first event
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		events, next, err := feed.Since(last, filter, streamBatch)
+		if err != nil {
+			log.Printf("reading the receipt feed failed: %v\n", err)
+			return false
+		}
+		for _, event := range events {
+			c.Render(-1, sse.Event{Id: strconv.FormatUint(event.Seq, 10), Event: "receipt", Data: event})
+		}
+		if next != last {
+			// Keep reading until caught up before waiting for new events
+			last = next
+			return true
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-updates:
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		}
+		return true
+	})
+}
+
+// parseFeedFilter reads the retailer, status, account and minPoints query parameters
+func parseFeedFilter(c *gin.Context) (service.FeedFilter, error) {
+	filter := service.FeedFilter{
+		Retailer:  c.Query("retailer"),
+		Status:    c.Query("status"),
+		AccountID: c.Query("account"),
+	}
+	if filter.Status != "" && !feedStatuses[filter.Status] {
+		return filter, &FieldError{In: "query", Field: "status", Message: fmt.Sprintf("must be one of %s, %s or %s", model.StatusScored, model.StatusPendingReview, model.StatusRejected)}
+	}
+	if minPoints := c.Query("minPoints"); minPoints != "" {
+		var err error
+		filter.MinPoints, err = strconv.Atoi(minPoints)
+		if err != nil {
+			return filter, &FieldError{In: "query", Field: "minPoints", Message: "is not a number"}
+		}
+	}
+	return filter, nil
+}
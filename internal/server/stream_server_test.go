@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// streamEvent is a server-sent event read from the stream
+type streamEvent struct {
+	ID   string
+	Data model.FeedEvent
+}
+
+// openStream connects to the receipt stream and returns a channel of its events
+func openStream(t *testing.T, url, key, lastEventID string) <-chan streamEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req.Header.Set(APIKeyHeader, key)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open the stream: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan streamEvent, 10)
+	go func() {
+		defer resp.Body.Close()
+		var event streamEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id:"):
+				event.ID = line[3:]
+			case strings.HasPrefix(line, "data:"):
+				json.Unmarshal([]byte(line[5:]), &event.Data)
+				events <- event
+				event = streamEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func TestStreamReceipts(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	readKey := newAPIKey(t, server, model.ScopeRead)
+	// Closed after the streams are cancelled, it waits for open requests
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	walgreens := strings.Replace(simpleReceiptJSON, "Target", "Walgreens", 1)
+	first := decodeResponse(submit(server, submitKey, simpleReceiptJSON), t).ID
+	decodeResponse(submit(server, submitKey, walgreens), t)
+	second := decodeResponse(submit(server, submitKey, strings.Replace(simpleReceiptJSON, "13:13", "14:14", 1)), t).ID
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+
+	// A new stream starts after the stored events
+	fresh := openStream(t, ts.URL+"/receipts/stream", readKey, "")
+
+	// Stored events are replayed after the Last-Event-ID, filtered by retailer
+	events := openStream(t, ts.URL+"/receipts/stream?retailer=target", readKey, "0")
+	event := <-events
+	assert.Equal(t, "1", event.ID)
+	assert.Equal(t, first, event.Data.ReceiptID)
+	assert.Equal(t, "Target", event.Data.Retailer)
+	assert.Equal(t, model.StatusScored, event.Data.Status)
+	event = <-events
+	assert.Equal(t, "3", event.ID)
+	assert.Equal(t, second, event.Data.ReceiptID)
+
+	// New receipts are pushed as they finish processing
+	live := decodeResponse(submit(server, submitKey, strings.Replace(simpleReceiptJSON, "13:13", "15:15", 1)), t).ID
+	_, err = server.Processor.ProcessPending()
+	assert.NoError(t, err)
+	event = <-events
+	assert.Equal(t, "4", event.ID)
+	assert.Equal(t, live, event.Data.ReceiptID)
+	event = <-fresh
+	assert.Equal(t, "4", event.ID)
+
+	// Reconnecting resumes after the last event received
+	events = openStream(t, ts.URL+"/receipts/stream", readKey, "3")
+	event = <-events
+	assert.Equal(t, live, event.Data.ReceiptID)
+}
+
+func TestStreamReceiptsValidation(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	readKey := newAPIKey(t, server, model.ScopeRead)
+
+	for _, query := range []string{"?status=held", "?minPoints=many"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/receipts/stream"+query, nil)
+		req.Header.Set(APIKeyHeader, readKey)
+		server.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/receipts/stream", nil)
+	req.Header.Set(APIKeyHeader, readKey)
+	req.Header.Set("Last-Event-ID", "abc")
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/gin-gonic/gin"
+)
+
+// ReceiptV2Response is a receipt with its processing status in the v2 API
+type ReceiptV2Response struct {
+	ID              string           `json:"id"`
+	Status          string           `json:"status"`
+	Points          int              `json:"points"`
+	RejectionReason string           `json:"rejectionReason,omitempty"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	ProcessedAt     *time.Time       `json:"processedAt,omitempty"`
+	Receipt         *model.ReceiptV2 `json:"receipt,omitempty"`
+}
+
+func (rs *ReceiptServer) processReceiptV2(c *gin.Context) {
+	var receipt model.ReceiptV2
+	if err := c.ShouldBindJSON(&receipt); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	submitter := service.Submitter{ClientID: c.GetString(clientKey), AccountID: c.GetString(accountKey)}
+	if receipt.AccountID != "" {
+		// API keys submit on behalf of any account, users only to their own
+		if submitter.AccountID != "" && submitter.AccountID != receipt.AccountID {
+			handleError(c, http.StatusForbidden, CodeForbidden, "bearer tokens can only submit receipts to their own account")
+			return
+		}
+		submitter.AccountID = receipt.AccountID
+	}
+
+	id, ok := rs.submitReceipt(c, receipt.ToReceipt(), submitter)
+	if !ok {
+		return
+	}
+
+	c.Header("Location", "/v2/receipts/"+id)
+	c.JSON(http.StatusAccepted, ReceiptResponse{ID: id, Status: model.StatusAccepted})
+}
+
+func (rs *ReceiptServer) getReceiptV2(c *gin.Context) {
+	record, ok := rs.loadReceipt(c)
+	if !ok {
+		return
+	}
+
+	response := ReceiptV2Response{
+		ID:              record.ID,
+		Status:          record.Status,
+		Points:          record.CreditedPoints(),
+		RejectionReason: record.RejectionReason,
+		CreatedAt:       record.CreatedAt,
+		ProcessedAt:     record.ProcessedAt,
+	}
+	if record.Receipt != nil {
+		response.Receipt = model.ReceiptToV2(record.Receipt, record.AccountID)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+const v2ReceiptJSON = `{
+	"retailer": "Target",
+	"purchasedAt": "2022-01-02T13:13:00-05:00",
+	"totalCents": 250,
+	"items": [
+		{"description": "Pepsi - 12-oz", "quantity": 2, "unitPriceCents": 125}
+	]
+}`
+
+// v2ReceiptAsV1JSON is v2ReceiptJSON in the v1 contract
+const v2ReceiptAsV1JSON = `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-02",
+	"purchaseTime": "13:13",
+	"total": "2.50",
+	"items": [
+		{"shortDescription": "Pepsi - 12-oz", "price": "1.25"},
+		{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}
+	]
+}`
+
+// submitV2 submits a v2 receipt with a bearer token
+func submitV2(server *ReceiptServer, authorization, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v2/receipts", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", authorization)
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestReceiptsV2(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	key := newAPIKey(t, server, model.ScopeSubmit, model.ScopeRead)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set(APIKeyHeader, key)
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v2/receipts", bytes.NewBufferString(v2ReceiptJSON))
+	req.Header.Set(APIKeyHeader, key)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	v2ID := decodeResponse(w, t).ID
+	assert.Equal(t, "/v2/receipts/"+v2ID, w.Header().Get("Location"))
+	v1ID := decodeResponse(submit(server, key, v2ReceiptAsV1JSON), t).ID
+	server.Processor.ProcessPending()
+
+	// Both versions share the rules, the v2 receipt earns what its v1 equivalent does
+	var v1Points, v2Points map[string]int
+	assert.NoError(t, json.Unmarshal(get("/receipts/"+v1ID+"/points").Body.Bytes(), &v1Points))
+	assert.NoError(t, json.Unmarshal(get("/v2/receipts/"+v2ID+"/points").Body.Bytes(), &v2Points))
+	assert.Equal(t, v1Points, v2Points)
+	assert.Greater(t, v2Points["points"], 0)
+
+	// The v2 receipt round trips with its offset and quantities
+	w = get("/v2/receipts/" + v2ID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response ReceiptV2Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, model.StatusScored, response.Status)
+	assert.Equal(t, v2Points["points"], response.Points)
+	assert.Equal(t, "2022-01-02T13:13:00-05:00", response.Receipt.PurchasedAt.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, []model.ItemV2{{Description: "Pepsi - 12-oz", Quantity: 2, UnitPriceCents: 125}}, response.Receipt.Items)
+	assert.Equal(t, int64(250), response.Receipt.TotalCents)
+
+	// v1 receipts are served by v2 in UTC, and v2 receipts by v1
+	w = get("/v2/receipts/" + v1ID)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "2022-01-02T13:13:00Z", response.Receipt.PurchasedAt.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, http.StatusOK, get("/receipts/"+v2ID).Code)
+}
+
+func TestReceiptsV2Validation(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	key := newAPIKey(t, server, model.ScopeSubmit)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"purchase time without offset", `{"retailer": "Target", "purchasedAt": "2022-01-02T13:13:00", "totalCents": 125, "items": [{"description": "Pepsi", "unitPriceCents": 125}]}`},
+		{"decimal amount", `{"retailer": "Target", "purchasedAt": "2022-01-02T13:13:00Z", "totalCents": "1.25", "items": [{"description": "Pepsi", "unitPriceCents": 125}]}`},
+		{"negative quantity", `{"retailer": "Target", "purchasedAt": "2022-01-02T13:13:00Z", "totalCents": 125, "items": [{"description": "Pepsi", "quantity": -1, "unitPriceCents": 125}]}`},
+		{"no items", `{"retailer": "Target", "purchasedAt": "2022-01-02T13:13:00Z", "totalCents": 125, "items": []}`},
+		{"v1 receipt", simpleReceiptJSON},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/v2/receipts", bytes.NewBufferString(test.body))
+			req.Header.Set(APIKeyHeader, key)
+			server.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), CodeValidationFailed)
+		})
+	}
+}
+
+func TestReceiptsV2Accounts(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	bearer := enableBearerTokens(t, server)
+	key := newAPIKey(t, server, model.ScopeSubmit)
+	withAccount := func(account string) string {
+		var receipt map[string]interface{}
+		json.Unmarshal([]byte(v2ReceiptJSON), &receipt)
+		receipt["accountId"] = account
+		body, _ := json.Marshal(receipt)
+		return string(body)
+	}
+
+	// API keys submit on behalf of any account
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v2/receipts", bytes.NewBufferString(withAccount("bob")))
+	req.Header.Set(APIKeyHeader, key)
+	server.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	record, err := service.GetReceipt(decodeResponse(w, t).ID, server.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", record.AccountID)
+
+	// Users only to their own account
+	assert.Equal(t, http.StatusAccepted, submitV2(server, bearer("alice"), withAccount("alice")).Code)
+	assert.Equal(t, http.StatusForbidden, submitV2(server, bearer("alice"), withAccount("bob")).Code)
+	w = submitV2(server, bearer("alice"), v2ReceiptJSON)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	record, err = service.GetReceipt(decodeResponse(w, t).ID, server.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", record.AccountID)
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateWebhookRequest is the payload of POST /webhooks
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required"`
+	// Secret signs the payloads, one is generated when it is empty
+	Secret string `json:"secret"`
+}
+
+func (rs *ReceiptServer) createWebhook(c *gin.Context) {
+	var request CreateWebhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+
+	webhook, err := service.CreateWebhook(request.URL, request.Events, request.Secret, rs.DB)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidWebhook) {
+			handleError(c, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		} else {
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to create the webhook")
+		}
+		return
+	}
+
+	// The secret is only returned once, when the webhook is created
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func (rs *ReceiptServer) listWebhooks(c *gin.Context) {
+	webhooks, err := service.ListWebhooks(rs.DB)
+	if err != nil {
+		log.Println(err)
+		handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list webhooks")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+func (rs *ReceiptServer) deleteWebhook(c *gin.Context) {
+	err := service.DeleteWebhook(c.Params.ByName("id"), rs.DB)
+	if err != nil {
+		if errors.Is(err, service.ErrIdNotFound) {
+			handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+		} else {
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to delete the webhook")
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (rs *ReceiptServer) listDeliveries(c *gin.Context) {
+	deliveries, err := service.ListDeliveries(c.Params.ByName("id"), rs.DB)
+	if err != nil {
+		if errors.Is(err, service.ErrIdNotFound) {
+			handleError(c, http.StatusNotFound, CodeNotFound, err.Error())
+		} else {
+			log.Println(err)
+			handleError(c, http.StatusInternalServerError, CodeInternal, "failed to list the deliveries")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/service"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks(t *testing.T) {
+	server := newTestServer(t, service.Policy{})
+	submitKey := newAPIKey(t, server, model.ScopeSubmit)
+	adminKey := newAPIKey(t, server, model.ScopeAdmin)
+
+	events := make(chan model.Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event model.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+	}))
+	defer receiver.Close()
+
+	assert.Equal(t, http.StatusForbidden, adminRequest(t, server, "POST", "/webhooks", submitKey, `{"url": "`+receiver.URL+`", "events": ["receipt.scored"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, server, "POST", "/webhooks", adminKey, `{"url": "`+receiver.URL+`", "events": ["receipt.lost"]}`).Code)
+
+	w := adminRequest(t, server, "POST", "/webhooks", adminKey, `{"url": "`+receiver.URL+`", "events": ["receipt.scored"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var webhook model.Webhook
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &webhook))
+	assert.NotEmpty(t, webhook.Secret)
+
+	// Secrets are only shown when the webhook is created
+	w = adminRequest(t, server, "GET", "/webhooks", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), webhook.ID)
+	assert.NotContains(t, w.Body.String(), webhook.Secret)
+
+	id := decodeResponse(submit(server, submitKey, simpleReceiptJSON), t).ID
+	_, err := server.Processor.ProcessPending()
+	assert.NoError(t, err)
+	_, err = service.NewDispatcher(server.DB).DeliverDue(time.Now().UTC())
+	assert.NoError(t, err)
+	event := <-events
+	assert.Equal(t, model.EventReceiptScored, event.Type)
+	assert.Equal(t, id, event.Data.ReceiptID)
+
+	w = adminRequest(t, server, "GET", "/webhooks/"+webhook.ID+"/deliveries", adminKey, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var log struct {
+		Deliveries []model.Delivery `json:"deliveries"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &log))
+	assert.Len(t, log.Deliveries, 1)
+	assert.Equal(t, model.DeliveryDelivered, log.Deliveries[0].Status)
+
+	// Only scored receipts can be reversed
+	w = adminRequest(t, server, "POST", "/admin/receipts/"+id+"/reverse", adminKey, `{"notes": "chargeback"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusConflict, adminRequest(t, server, "POST", "/admin/receipts/"+id+"/reverse", adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "POST", "/admin/receipts/unknown/reverse", adminKey, "").Code)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, server, "DELETE", "/webhooks/"+webhook.ID, adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "DELETE", "/webhooks/"+webhook.ID, adminKey, "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, server, "GET", "/webhooks/unknown/deliveries", adminKey, "").Code)
+}
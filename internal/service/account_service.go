@@ -0,0 +1,40 @@
+package service
+
+import (
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ListAccountReceipts returns up to limit receipts submitted for the account, newest first.
+func ListAccountReceipts(account string, limit int, db *bolt.DB) ([]model.ReceiptRecord, error) {
+	records := []model.ReceiptRecord{}
+	err := db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(database.AccountReceiptsBucket).Bucket([]byte(account))
+		if index == nil {
+			return nil
+		}
+		cursor := index.Cursor()
+		for k, v := cursor.Last(); k != nil && len(records) < limit; k, v = cursor.Prev() {
+			record, err := getRecord(tx, string(v))
+			if err != nil {
+				return err
+			}
+			records = append(records, *record)
+		}
+		return nil
+	})
+	return records, err
+}
+
+// indexAccountReceipt adds a receipt to its account's receipts
+func indexAccountReceipt(tx *bolt.Tx, record *model.ReceiptRecord) error {
+	if record.AccountID == "" {
+		return nil
+	}
+	index, err := tx.Bucket(database.AccountReceiptsBucket).CreateBucketIfNotExists([]byte(record.AccountID))
+	if err != nil {
+		return err
+	}
+	return index.Put(database.TimeKey(record.CreatedAt, record.ID), []byte(record.ID))
+}
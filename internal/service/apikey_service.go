@@ -0,0 +1,153 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidAPIKey is an error indicating that the API key is unknown, malformed or revoked.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ErrInvalidScope is an error indicating that a requested scope does not exist.
+var ErrInvalidScope = errors.New("invalid scope")
+
+// validScopes lists the scopes that can be granted to a key
+var validScopes = map[string]bool{
+	model.ScopeSubmit: true,
+	model.ScopeRead:   true,
+	model.ScopeAdmin:  true,
+}
+
+// CreateAPIKey generates a new key with the given scopes and stores its hash.
+// The returned plaintext key is of the form "<id>.<secret>" and cannot be recovered later.
+func CreateAPIKey(name string, scopes []string, db *bolt.DB) (string, *model.APIKey, error) {
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return "", nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &model.APIKey{
+		ID:         uuid.New().String(),
+		Name:       name,
+		Scopes:     scopes,
+		SecretHash: hashSecret(encoded),
+		CreatedAt:  time.Now().UTC(),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		return putAPIKey(tx, key)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return key.ID + "." + encoded, key, nil
+}
+
+// AuthenticateAPIKey returns the stored key matching the plaintext key if it has not been revoked.
+func AuthenticateAPIKey(plaintext string, db *bolt.DB) (*model.APIKey, error) {
+	id, secret, ok := strings.Cut(plaintext, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := getAPIKey(id, db)
+	if err != nil {
+		if errors.Is(err, ErrIdNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// RevokeAPIKey marks the key as revoked, revoked keys are kept for auditing.
+func RevokeAPIKey(id string, db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(database.APIKeysBucket).Get([]byte(id))
+		if data == nil {
+			return ErrIdNotFound
+		}
+		var key model.APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return err
+		}
+		if key.RevokedAt == nil {
+			now := time.Now().UTC()
+			key.RevokedAt = &now
+		}
+		return putAPIKey(tx, &key)
+	})
+}
+
+// ListAPIKeys returns all keys, including revoked ones, without their secret hashes.
+func ListAPIKeys(db *bolt.DB) ([]model.APIKey, error) {
+	keys := []model.APIKey{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.APIKeysBucket).ForEach(func(k, v []byte) error {
+			var key model.APIKey
+			if err := json.Unmarshal(v, &key); err != nil {
+				return err
+			}
+			key.SecretHash = ""
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func getAPIKey(id string, db *bolt.DB) (*model.APIKey, error) {
+	var key model.APIKey
+	err := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(database.APIKeysBucket).Get([]byte(id))
+		if data == nil {
+			return ErrIdNotFound
+		}
+		return json.Unmarshal(data, &key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func putAPIKey(tx *bolt.Tx, key *model.APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(database.APIKeysBucket).Put([]byte(key.ID), data)
+}
+
+// hashSecret hashes the random part of a key, the secrets are high entropy so a fast hash is sufficient
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
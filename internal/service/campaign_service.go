@@ -0,0 +1,226 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidCampaign is an error indicating that a campaign has an invalid window, award or stacking mode.
+var ErrInvalidCampaign = errors.New("invalid campaign")
+
+// CreateCampaign validates and stores a new campaign.
+func CreateCampaign(campaign *model.Campaign, db *bolt.DB) error {
+	if err := validateCampaign(campaign); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	campaign.ID = uuid.New().String()
+	campaign.CreatedAt = now
+	campaign.UpdatedAt = now
+	return db.Update(func(tx *bolt.Tx) error {
+		return putCampaign(tx, campaign)
+	})
+}
+
+// GetCampaign returns the campaign with the ID.
+func GetCampaign(id string, db *bolt.DB) (*model.Campaign, error) {
+	var campaign *model.Campaign
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		campaign, err = getCampaign(tx, id)
+		return err
+	})
+	return campaign, err
+}
+
+// ListCampaigns returns every campaign, past ones included.
+func ListCampaigns(db *bolt.DB) ([]model.Campaign, error) {
+	var campaigns []model.Campaign
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		campaigns, err = listCampaigns(tx)
+		return err
+	})
+	return campaigns, err
+}
+
+// UpdateCampaign replaces the campaign with the ID, receipts already scored keep their points.
+func UpdateCampaign(id string, campaign *model.Campaign, db *bolt.DB) error {
+	if err := validateCampaign(campaign); err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		existing, err := getCampaign(tx, id)
+		if err != nil {
+			return err
+		}
+		campaign.ID = id
+		campaign.CreatedAt = existing.CreatedAt
+		campaign.UpdatedAt = time.Now().UTC()
+		return putCampaign(tx, campaign)
+	})
+}
+
+// DeleteCampaign ends the campaign, receipts already scored keep their points.
+func DeleteCampaign(id string, db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(database.CampaignsBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrIdNotFound
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return touchRuleset(tx)
+	})
+}
+
+func validateCampaign(campaign *model.Campaign) error {
+	if campaign.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCampaign)
+	}
+	if !campaign.EndsAt.After(campaign.StartsAt) {
+		return fmt.Errorf("%w: endsAt must be after startsAt", ErrInvalidCampaign)
+	}
+	if campaign.Multiplier != 0 && campaign.Multiplier < 1 {
+		return fmt.Errorf("%w: multiplier must be at least 1", ErrInvalidCampaign)
+	}
+	if campaign.Bonus < 0 {
+		return fmt.Errorf("%w: bonus must not be negative", ErrInvalidCampaign)
+	}
+	if campaign.Multiplier <= 1 && campaign.Bonus == 0 {
+		return fmt.Errorf("%w: a multiplier above 1 or a bonus is required", ErrInvalidCampaign)
+	}
+	if campaign.MinTotal != "" {
+		if _, err := strconv.ParseFloat(campaign.MinTotal, 64); err != nil {
+			return fmt.Errorf("%w: minTotal must be an amount like 50.00", ErrInvalidCampaign)
+		}
+	}
+	switch campaign.Stacking {
+	case "":
+		campaign.Stacking = model.StackingStack
+	case model.StackingStack, model.StackingExclusive:
+	default:
+		return fmt.Errorf("%w: stacking must be stack or exclusive", ErrInvalidCampaign)
+	}
+	if campaign.RetailerIDs == nil {
+		campaign.RetailerIDs = []string{}
+	}
+	return nil
+}
+
+func listCampaigns(tx *bolt.Tx) ([]model.Campaign, error) {
+	campaigns := []model.Campaign{}
+	err := tx.Bucket(database.CampaignsBucket).ForEach(func(k, v []byte) error {
+		var campaign model.Campaign
+		if err := json.Unmarshal(v, &campaign); err != nil {
+			return err
+		}
+		campaigns = append(campaigns, campaign)
+		return nil
+	})
+	return campaigns, err
+}
+
+func getCampaign(tx *bolt.Tx, id string) (*model.Campaign, error) {
+	data := tx.Bucket(database.CampaignsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrIdNotFound
+	}
+	var campaign model.Campaign
+	if err := json.Unmarshal(data, &campaign); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func putCampaign(tx *bolt.Tx, campaign *model.Campaign) error {
+	data, err := json.Marshal(campaign)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(database.CampaignsBucket).Put([]byte(campaign.ID), data); err != nil {
+		return err
+	}
+	return touchRuleset(tx)
+}
+
+// applyCampaigns awards the campaigns the receipt qualifies for. Multipliers apply to the points of
+// the base rules, so stacked campaigns add up rather than compound. An exclusive campaign combines
+// with no other: the receipt gets the best exclusive campaign or the stackable ones, whichever is worth more.
+func applyCampaigns(campaigns []model.Campaign, receipt *model.Receipt, breakdown *model.Breakdown) {
+	base := breakdown.Total
+	var stacked []model.RuleAward
+	var exclusive *model.RuleAward
+	stackedPoints := 0
+	for i := range campaigns {
+		campaign := &campaigns[i]
+		if !qualifies(campaign, receipt) {
+			continue
+		}
+		award := model.RuleAward{
+			Rule:        model.RuleCampaign,
+			Description: campaign.Name,
+			Points:      campaignPoints(campaign, base),
+			CampaignID:  campaign.ID,
+		}
+		if campaign.Stacking == model.StackingExclusive {
+			if exclusive == nil || award.Points > exclusive.Points {
+				exclusive = &award
+			}
+			continue
+		}
+		stacked = append(stacked, award)
+		stackedPoints += award.Points
+	}
+
+	if exclusive != nil && exclusive.Points > stackedPoints {
+		stacked = []model.RuleAward{*exclusive}
+	}
+	for _, award := range stacked {
+		breakdown.Rules = append(breakdown.Rules, award)
+		breakdown.Total += award.Points
+		log.Printf("Points after campaign %s: %d\n", award.CampaignID, breakdown.Total)
+	}
+}
+
+// qualifies reports whether the receipt is from a retailer of the campaign, purchased within its window and spending enough
+func qualifies(campaign *model.Campaign, receipt *model.Receipt) bool {
+	if len(campaign.RetailerIDs) > 0 {
+		if receipt.CanonicalRetailer == nil {
+			return false
+		}
+		found := false
+		for _, id := range campaign.RetailerIDs {
+			found = found || id == receipt.CanonicalRetailer.RetailerID
+		}
+		if !found {
+			return false
+		}
+	}
+
+	purchasedAt, err := receipt.PurchasedAt()
+	if err != nil || purchasedAt.Before(campaign.StartsAt) || !purchasedAt.Before(campaign.EndsAt) {
+		return false
+	}
+	return campaign.MinTotal == "" || model.ParseCents(receipt.Total) >= model.ParseCents(campaign.MinTotal)
+}
+
+// campaignPoints is the bonus plus the extra points of the multiplier on the base points, rounded
+func campaignPoints(campaign *model.Campaign, base int) int {
+	points := campaign.Bonus
+	if campaign.Multiplier > 1 {
+		points += int(math.Round(float64(base) * (campaign.Multiplier - 1)))
+	}
+	return points
+}
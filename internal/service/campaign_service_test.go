@@ -0,0 +1,111 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyCampaigns(t *testing.T) {
+	weekend := func(campaign model.Campaign) model.Campaign {
+		campaign.StartsAt = time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)
+		campaign.EndsAt = time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+		if campaign.Stacking == "" {
+			campaign.Stacking = model.StackingStack
+		}
+		return campaign
+	}
+	double := weekend(model.Campaign{ID: "double", Name: "2x points at Target this weekend", RetailerIDs: []string{"target"}, Multiplier: 2})
+	spend := weekend(model.Campaign{ID: "spend", Name: "+100 points for spending $50 at Walgreens", RetailerIDs: []string{"walgreens"}, MinTotal: "50.00", Bonus: 100})
+	everyone := weekend(model.Campaign{ID: "everyone", Name: "+10 points everywhere", Bonus: 10})
+	exclusive := weekend(model.Campaign{ID: "exclusive", Name: "+50 points, no other offers", Bonus: 50, Stacking: model.StackingExclusive})
+	smallExclusive := exclusive
+	smallExclusive.Bonus = 30
+	bigSpend := spend
+	bigSpend.RetailerIDs = []string{"target"}
+	bigSpend.MinTotal = "1.25"
+	nextWeek := double
+	nextWeek.StartsAt = nextWeek.StartsAt.AddDate(0, 0, 7)
+	nextWeek.EndsAt = nextWeek.EndsAt.AddDate(0, 0, 7)
+
+	// 6 points for the retailer name and 25 for the total
+	receipt := model.Receipt{
+		Retailer:          "TARGET",
+		PurchaseDate:      "2024-06-08",
+		PurchaseTime:      "10:00",
+		Items:             []model.Item{{ShortDescription: "Pepsi", Price: "1.25"}},
+		Total:             "1.25",
+		CanonicalRetailer: &model.RetailerMatch{RetailerID: "target", Name: "Target", Match: model.RetailerMatchName},
+	}
+
+	tests := []struct {
+		name      string
+		campaigns []model.Campaign
+		points    int
+		applied   []string
+	}{
+		{"no campaigns", nil, 31, nil},
+		{"multiplier", []model.Campaign{double}, 62, []string{"double"}},
+		{"other retailer", []model.Campaign{spend}, 31, nil},
+		{"outside the window", []model.Campaign{nextWeek}, 31, nil},
+		{"minimum total", []model.Campaign{bigSpend}, 131, []string{"spend"}},
+		{"stacked campaigns add up", []model.Campaign{double, everyone}, 72, []string{"double", "everyone"}},
+		{"exclusive worth more", []model.Campaign{everyone, exclusive}, 81, []string{"exclusive"}},
+		{"stacked worth more", []model.Campaign{double, everyone, smallExclusive}, 72, []string{"double", "everyone"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breakdown := CalculateBreakdown(&receipt, &Ruleset{Campaigns: test.campaigns})
+			assert.Equal(t, test.points, breakdown.Total)
+			var applied []string
+			for _, award := range breakdown.Rules {
+				if award.Rule == model.RuleCampaign {
+					applied = append(applied, award.CampaignID)
+				}
+			}
+			assert.Equal(t, test.applied, applied)
+		})
+	}
+
+	// Receipts without a registry retailer only get campaigns for every retailer
+	unmatched := receipt
+	unmatched.CanonicalRetailer = nil
+	assert.Equal(t, 41, CalculatePoints(&unmatched, &Ruleset{Campaigns: []model.Campaign{double, everyone}}))
+}
+
+func TestCampaigns(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	start := time.Date(2024, 6, 8, 0, 0, 0, 0, time.UTC)
+	assert.ErrorIs(t, CreateCampaign(&model.Campaign{Name: "Backwards", StartsAt: start, EndsAt: start, Bonus: 10}, db), ErrInvalidCampaign)
+	assert.ErrorIs(t, CreateCampaign(&model.Campaign{Name: "Nothing", StartsAt: start, EndsAt: start.Add(time.Hour)}, db), ErrInvalidCampaign)
+	assert.ErrorIs(t, CreateCampaign(&model.Campaign{Name: "Half", StartsAt: start, EndsAt: start.Add(time.Hour), Multiplier: 0.5}, db), ErrInvalidCampaign)
+	assert.ErrorIs(t, CreateCampaign(&model.Campaign{Name: "Stacking", StartsAt: start, EndsAt: start.Add(time.Hour), Bonus: 10, Stacking: "sometimes"}, db), ErrInvalidCampaign)
+
+	campaign := &model.Campaign{Name: "Weekend", StartsAt: start, EndsAt: start.AddDate(0, 0, 2), Multiplier: 2}
+	assert.NoError(t, CreateCampaign(campaign, db))
+	assert.Equal(t, model.StackingStack, campaign.Stacking)
+	assert.Equal(t, []string{}, campaign.RetailerIDs)
+
+	update := &model.Campaign{Name: "Long weekend", StartsAt: start, EndsAt: start.AddDate(0, 0, 3), Multiplier: 2}
+	assert.NoError(t, UpdateCampaign(campaign.ID, update, db))
+	assert.Equal(t, campaign.CreatedAt, update.CreatedAt)
+	assert.ErrorIs(t, UpdateCampaign("unknown", update, db), ErrIdNotFound)
+
+	ruleset, err := LoadRuleset(db)
+	assert.NoError(t, err)
+	if assert.Len(t, ruleset.Campaigns, 1) {
+		assert.Equal(t, "Long weekend", ruleset.Campaigns[0].Name)
+	}
+
+	assert.NoError(t, DeleteCampaign(campaign.ID, db))
+	assert.ErrorIs(t, DeleteCampaign(campaign.ID, db), ErrIdNotFound)
+	campaigns, err := ListCampaigns(db)
+	assert.NoError(t, err)
+	assert.Empty(t, campaigns)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidCaps is an error indicating that a cap configuration cannot be used.
+var ErrInvalidCaps = errors.New("invalid caps")
+
+// Caps bound the points receipts earn, a zero value disables a cap.
+type Caps struct {
+	// PerRule caps the points each rule awards a receipt, by rule name
+	PerRule map[string]int
+	// PerReceipt caps the points of a receipt
+	PerReceipt int
+	// PerAccountPerDay caps the points an account earns per UTC day
+	PerAccountPerDay int
+}
+
+// cappableRules are the rules per rule caps can bound
+var cappableRules = map[string]bool{
+	model.RuleRetailerName:    true,
+	model.RuleRoundTotal:      true,
+	model.RuleQuarterTotal:    true,
+	model.RuleItemPairs:       true,
+	model.RuleItemDescription: true,
+	model.RuleOddDay:          true,
+	model.RuleAfternoon:       true,
+	model.RuleCampaign:        true,
+	model.RuleProductBonus:    true,
+	model.RuleCustom:          true,
+}
+
+// ParseRuleCaps reads per rule caps written as rule=points separated by commas, like "item_description=100,campaign=500".
+func ParseRuleCaps(spec string) (map[string]int, error) {
+	caps := map[string]int{}
+	if spec == "" {
+		return caps, nil
+	}
+	for _, field := range strings.Split(spec, ",") {
+		rule, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not rule=points", ErrInvalidCaps, field)
+		}
+		if !cappableRules[rule] {
+			return nil, fmt.Errorf("%w: %q is not a rule that can be capped", ErrInvalidCaps, rule)
+		}
+		points, err := strconv.Atoi(value)
+		if err != nil || points <= 0 {
+			return nil, fmt.Errorf("%w: the cap of %s is not a positive number of points", ErrInvalidCaps, rule)
+		}
+		caps[rule] = points
+	}
+	return caps, nil
+}
+
+// capRules takes back the points each rule awarded over its cap, summing the awards of rules awarding
+// several like campaigns. They apply before the tier bonus, which multiplies the capped points.
+func capRules(caps Caps, breakdown *model.Breakdown) {
+	if len(caps.PerRule) == 0 {
+		return
+	}
+	points := map[string]int{}
+	var order []string
+	for _, award := range breakdown.Rules {
+		if _, ok := points[award.Rule]; !ok {
+			order = append(order, award.Rule)
+		}
+		points[award.Rule] += award.Points
+	}
+	for _, rule := range order {
+		limit, ok := caps.PerRule[rule]
+		if !ok || points[rule] <= limit {
+			continue
+		}
+		addCap(breakdown, model.CapPerRule, rule, fmt.Sprintf("%s capped at %d points per receipt", rule, limit), limit-points[rule])
+	}
+}
+
+// capTotal takes back the points of the receipt over the per receipt cap, then those over what is left
+// of the account's daily cap. They apply after every rule and the tier bonus.
+func capTotal(tx *bolt.Tx, account string, caps Caps, breakdown *model.Breakdown, now time.Time) error {
+	if caps.PerReceipt > 0 && breakdown.Total > caps.PerReceipt {
+		addCap(breakdown, model.CapPerReceipt, "", fmt.Sprintf("capped at %d points per receipt", caps.PerReceipt), caps.PerReceipt-breakdown.Total)
+	}
+	if account == "" || caps.PerAccountPerDay <= 0 {
+		return nil
+	}
+	earned, err := earnedOn(tx, account, now)
+	if err != nil {
+		return err
+	}
+	if left := max(0, caps.PerAccountPerDay-earned); breakdown.Total > left {
+		description := fmt.Sprintf("capped at %d points per account per day, %d earned today", caps.PerAccountPerDay, earned)
+		addCap(breakdown, model.CapPerAccountPerDay, "", description, left-breakdown.Total)
+	}
+	return nil
+}
+
+// addCap records the points a cap took back
+func addCap(breakdown *model.Breakdown, kind, rule, description string, points int) {
+	breakdown.Rules = append(breakdown.Rules, model.RuleAward{
+		Rule:        model.RuleCap,
+		Description: description,
+		Points:      points,
+		Cap:         kind,
+		CappedRule:  rule,
+	})
+	breakdown.Total += points
+	log.Printf("Points after %s cap: %d\n", kind, breakdown.Total)
+}
+
+// earnedOn sums the points credited to the account on the UTC day of now
+func earnedOn(tx *bolt.Tx, account string, now time.Time) (int, error) {
+	ledger := tx.Bucket(database.LedgerBucket).Bucket([]byte(account))
+	if ledger == nil {
+		return 0, nil
+	}
+	today := now.UTC().Format(dayLayout)
+	earned := 0
+	err := ledger.ForEach(func(k, v []byte) error {
+		var entry model.LedgerEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		if entry.Type == model.LedgerEarn && entry.CreatedAt.UTC().Format(dayLayout) == today {
+			earned += entry.Points
+		}
+		return nil
+	})
+	return earned, err
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestParseRuleCaps(t *testing.T) {
+	caps, err := ParseRuleCaps("item_description=100, campaign=500")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{model.RuleItemDescription: 100, model.RuleCampaign: 500}, caps)
+	caps, err = ParseRuleCaps("")
+	assert.NoError(t, err)
+	assert.Empty(t, caps)
+
+	for _, spec := range []string{"item_description", "item_description=x", "item_description=0", "tier_bonus=10", "unknown=10"} {
+		_, err := ParseRuleCaps(spec)
+		assert.ErrorIs(t, err, ErrInvalidCaps, spec)
+	}
+}
+
+func TestCaps(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	caps := Caps{PerRule: map[string]int{model.RuleItemDescription: 100}, PerReceipt: 150, PerAccountPerDay: 200}
+	processor := NewProcessor(db, Policy{Caps: caps}, 1)
+
+	// 6 points for the retailer name, 75 for the round total and 200 for the item description
+	submit := func(account string) *model.ReceiptRecord {
+		receipt := model.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-01-02",
+			PurchaseTime: "13:13",
+			Items:        []model.Item{{ShortDescription: "Emils Cheese Pizza", Price: "1000.00"}},
+			Total:        "1000.00",
+		}
+		id, err := processor.Submit(&receipt, Submitter{AccountID: account})
+		assert.NoError(t, err)
+		_, err = processor.ProcessPending()
+		assert.NoError(t, err)
+		record, err := GetReceipt(id, db)
+		assert.NoError(t, err)
+		return record
+	}
+	capAwards := func(record *model.ReceiptRecord) []model.RuleAward {
+		var awards []model.RuleAward
+		for _, award := range record.Breakdown.Rules {
+			if award.Rule == model.RuleCap {
+				awards = append(awards, award)
+			}
+		}
+		return awards
+	}
+
+	record := submit("alice")
+	assert.Equal(t, 150, record.Points)
+	assert.Equal(t, []model.RuleAward{
+		{Rule: model.RuleCap, Description: "item_description capped at 100 points per receipt", Points: -100, Cap: model.CapPerRule, CappedRule: model.RuleItemDescription},
+		{Rule: model.RuleCap, Description: "capped at 150 points per receipt", Points: -31, Cap: model.CapPerReceipt},
+	}, capAwards(record))
+
+	// The daily cap leaves 50 points for the second receipt and none for the third
+	record = submit("alice")
+	assert.Equal(t, 50, record.Points)
+	assert.Equal(t, model.RuleAward{Rule: model.RuleCap, Description: "capped at 200 points per account per day, 150 earned today", Points: -100, Cap: model.CapPerAccountPerDay},
+		capAwards(record)[2])
+	assert.Equal(t, 0, submit("alice").Points)
+
+	// Other accounts and receipts without an account are not affected by alice's cap
+	assert.Equal(t, 150, submit("bob").Points)
+	assert.Equal(t, 150, submit("").Points)
+	balance, err := GetBalance("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, balance)
+}
+
+func TestCapsOnApproval(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	caps := Caps{PerAccountPerDay: 200}
+
+	// Three receipts of 150 points were held, each within the cap when it was processed
+	var ids []string
+	for i := 0; i < 3; i++ {
+		record := model.ReceiptRecord{
+			ID:        uuid.New().String(),
+			Status:    model.StatusPendingReview,
+			AccountID: "alice",
+			Points:    150,
+			Breakdown: &model.Breakdown{Rules: []model.RuleAward{}, Total: 150},
+			CreatedAt: time.Now().UTC(),
+		}
+		db.Update(func(tx *bolt.Tx) error {
+			if err := putRecord(tx, &record); err != nil {
+				return err
+			}
+			return enqueueReview(tx, &record)
+		})
+		ids = append(ids, record.ID)
+	}
+
+	// Approving them credits no more than the cap
+	var points []int
+	for _, id := range ids {
+		record, err := ReviewReceipt(id, true, "carol", "", caps, db)
+		assert.NoError(t, err)
+		points = append(points, record.Points)
+	}
+	assert.Equal(t, []int{150, 50, 0}, points)
+	balance, err := GetBalance("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, balance)
+}
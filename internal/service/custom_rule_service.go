@@ -0,0 +1,206 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	"github.com/VineethKanaparthi/receipt-processor/internal/expr"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidRule is an error indicating that a custom rule has no name or its expressions do not compile.
+var ErrInvalidRule = errors.New("invalid rule")
+
+// CompiledRule is a custom rule with its expressions compiled.
+type CompiledRule struct {
+	Rule model.CustomRule
+	// Condition is nil for rules every receipt meets
+	Condition *expr.Program
+	Points    *expr.Program
+}
+
+// CompileRule compiles the expressions of a custom rule, failing with ErrInvalidRule and the
+// column of the first problem.
+func CompileRule(rule model.CustomRule) (*CompiledRule, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidRule)
+	}
+	compiled := &CompiledRule{Rule: rule}
+	var err error
+	if rule.Condition != "" {
+		if compiled.Condition, err = expr.Compile(rule.Condition, expr.Bool); err != nil {
+			return nil, fmt.Errorf("%w: condition: %v", ErrInvalidRule, err)
+		}
+	}
+	if compiled.Points, err = expr.Compile(rule.Points, expr.Number); err != nil {
+		return nil, fmt.Errorf("%w: points: %v", ErrInvalidRule, err)
+	}
+	return compiled, nil
+}
+
+// CreateCustomRule compiles and stores a new custom rule.
+func CreateCustomRule(rule *model.CustomRule, db *bolt.DB) error {
+	if _, err := CompileRule(*rule); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	rule.ID = uuid.New().String()
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	return db.Update(func(tx *bolt.Tx) error {
+		return putCustomRule(tx, rule)
+	})
+}
+
+// GetCustomRule returns the custom rule with the ID.
+func GetCustomRule(id string, db *bolt.DB) (*model.CustomRule, error) {
+	var rule *model.CustomRule
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		rule, err = getCustomRule(tx, id)
+		return err
+	})
+	return rule, err
+}
+
+// ListCustomRules returns every custom rule.
+func ListCustomRules(db *bolt.DB) ([]model.CustomRule, error) {
+	rules := []model.CustomRule{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.CustomRulesBucket).ForEach(func(k, v []byte) error {
+			var rule model.CustomRule
+			if err := json.Unmarshal(v, &rule); err != nil {
+				return err
+			}
+			rules = append(rules, rule)
+			return nil
+		})
+	})
+	return rules, err
+}
+
+// UpdateCustomRule replaces the custom rule with the ID, receipts already scored keep their points.
+func UpdateCustomRule(id string, rule *model.CustomRule, db *bolt.DB) error {
+	if _, err := CompileRule(*rule); err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		existing, err := getCustomRule(tx, id)
+		if err != nil {
+			return err
+		}
+		rule.ID = id
+		rule.CreatedAt = existing.CreatedAt
+		rule.UpdatedAt = time.Now().UTC()
+		return putCustomRule(tx, rule)
+	})
+}
+
+// DeleteCustomRule removes the custom rule, receipts already scored keep their points.
+func DeleteCustomRule(id string, db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(database.CustomRulesBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrIdNotFound
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return touchRuleset(tx)
+	})
+}
+
+func getCustomRule(tx *bolt.Tx, id string) (*model.CustomRule, error) {
+	data := tx.Bucket(database.CustomRulesBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrIdNotFound
+	}
+	var rule model.CustomRule
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func putCustomRule(tx *bolt.Tx, rule *model.CustomRule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(database.CustomRulesBucket).Put([]byte(rule.ID), data); err != nil {
+		return err
+	}
+	return touchRuleset(tx)
+}
+
+// loadCustomRules compiles the stored custom rules. Rules were compiled when they were stored, one
+// that no longer compiles fails the load instead of being left out of the points.
+func loadCustomRules(tx *bolt.Tx) ([]CompiledRule, error) {
+	var rules []CompiledRule
+	err := tx.Bucket(database.CustomRulesBucket).ForEach(func(k, v []byte) error {
+		var rule model.CustomRule
+		if err := json.Unmarshal(v, &rule); err != nil {
+			return err
+		}
+		compiled, err := CompileRule(rule)
+		if err != nil {
+			return fmt.Errorf("custom rule %s: %w", rule.ID, err)
+		}
+		rules = append(rules, *compiled)
+		return nil
+	})
+	return rules, err
+}
+
+// applyCustomRules awards the points of the custom rules whose condition the receipt meets.
+// A rule failing on the receipt, like dividing by zero or awarding negative points, awards nothing.
+func applyCustomRules(rules []CompiledRule, receipt *model.Receipt, breakdown *model.Breakdown) {
+	if len(rules) == 0 {
+		return
+	}
+	env, err := expr.NewEnv(receipt)
+	if err != nil {
+		log.Printf("skipping custom rules: %v\n", err)
+		return
+	}
+	for _, rule := range rules {
+		if rule.Condition != nil {
+			met, err := rule.Condition.Bool(env)
+			if err != nil {
+				log.Printf("custom rule %s condition: %v\n", rule.Rule.ID, err)
+				continue
+			}
+			if !met {
+				continue
+			}
+		}
+		value, err := rule.Points.Number(env)
+		if err != nil {
+			log.Printf("custom rule %s points: %v\n", rule.Rule.ID, err)
+			continue
+		}
+		if value < 0 || value > math.MaxInt32 {
+			log.Printf("custom rule %s awards %g points, not a number from 0 to %d\n", rule.Rule.ID, value, math.MaxInt32)
+			continue
+		}
+		points := int(math.Round(value))
+		if points == 0 {
+			continue
+		}
+		breakdown.Rules = append(breakdown.Rules, model.RuleAward{
+			Rule:        model.RuleCustom,
+			Description: rule.Rule.Name,
+			Points:      points,
+			RuleID:      rule.Rule.ID,
+		})
+		breakdown.Total += points
+		log.Printf("Points after custom rule %s: %d\n", rule.Rule.ID, breakdown.Total)
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestApplyCustomRules(t *testing.T) {
+	compile := func(rule model.CustomRule) CompiledRule {
+		compiled, err := CompileRule(rule)
+		assert.NoError(t, err)
+		return *compiled
+	}
+	afternoon := compile(model.CustomRule{ID: "afternoon", Name: "Target afternoon bonus",
+		Condition: `retailer.canonical == "target" && total >= 25.00 && hour(purchase) in 14..16`, Points: "50"})
+	perDollar := compile(model.CustomRule{ID: "per-dollar", Name: "2 points per dollar", Points: "floor(total) * 2"})
+	walmart := compile(model.CustomRule{ID: "walmart", Name: "Walmart bonus", Condition: `retailer.canonical == "walmart"`, Points: "100"})
+	failing := compile(model.CustomRule{ID: "failing", Name: "Divides by zero", Points: "total / (itemCount - 1)"})
+	negative := compile(model.CustomRule{ID: "negative", Name: "Takes points", Points: "-10"})
+
+	// 6 points for the retailer name, 25 for the total and 10 for the afternoon
+	receipt := model.Receipt{
+		Retailer:          "TARGET",
+		PurchaseDate:      "2024-06-08",
+		PurchaseTime:      "15:00",
+		Items:             []model.Item{{ShortDescription: "Pepsi", Price: "25.25"}},
+		Total:             "25.25",
+		CanonicalRetailer: &model.RetailerMatch{RetailerID: "target", Name: "Target", Match: model.RetailerMatchName},
+	}
+	breakdown := CalculateBreakdown(&receipt, &Ruleset{Rules: []CompiledRule{afternoon, perDollar, walmart, failing, negative}})
+	assert.Equal(t, 41+50+50, breakdown.Total)
+	assert.Equal(t, []model.RuleAward{
+		{Rule: model.RuleCustom, Description: "Target afternoon bonus", Points: 50, RuleID: "afternoon"},
+		{Rule: model.RuleCustom, Description: "2 points per dollar", Points: 50, RuleID: "per-dollar"},
+	}, breakdown.Rules[len(breakdown.Rules)-2:])
+
+	receipt.PurchaseTime = "17:00"
+	breakdown = CalculateBreakdown(&receipt, &Ruleset{Rules: []CompiledRule{afternoon}})
+	assert.Equal(t, 31, breakdown.Total)
+}
+
+func TestCustomRules(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	for _, rule := range []model.CustomRule{
+		{Points: "50"},
+		{Name: "No points"},
+		{Name: "Typo", Condition: `retailer.canonicl == "target"`, Points: "50"},
+		{Name: "Not a condition", Condition: `total`, Points: "50"},
+		{Name: "Not points", Points: `total > 1`},
+	} {
+		assert.ErrorIs(t, CreateCustomRule(&rule, db), ErrInvalidRule, rule.Name)
+	}
+	err := CreateCustomRule(&model.CustomRule{Name: "Typo", Condition: `retailer.canonicl == "target"`, Points: "50"}, db)
+	assert.EqualError(t, err, "invalid rule: condition: column 1: retailer has no field canonicl")
+
+	rule := model.CustomRule{Name: "Big baskets", Condition: "itemCount >= 10", Points: "25"}
+	assert.NoError(t, CreateCustomRule(&rule, db))
+	assert.NotEmpty(t, rule.ID)
+
+	rule.Points = "itemCount * 5"
+	assert.NoError(t, UpdateCustomRule(rule.ID, &rule, db))
+	stored, err := GetCustomRule(rule.ID, db)
+	assert.NoError(t, err)
+	assert.Equal(t, "itemCount * 5", stored.Points)
+	assert.ErrorIs(t, UpdateCustomRule("missing", &rule, db), ErrIdNotFound)
+
+	ruleset, err := LoadRuleset(db)
+	assert.NoError(t, err)
+	assert.Len(t, ruleset.Rules, 1)
+
+	rules, err := ListCustomRules(db)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.NoError(t, DeleteCustomRule(rule.ID, db))
+	assert.ErrorIs(t, DeleteCustomRule(rule.ID, db), ErrIdNotFound)
+}
+
+func TestRulesetCompiledOnce(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	cache := &rulesCache{}
+	load := func() (*Ruleset, error) {
+		var ruleset *Ruleset
+		err := db.View(func(tx *bolt.Tx) error {
+			var err error
+			ruleset, err = cache.loadRuleset(tx)
+			return err
+		})
+		return ruleset, err
+	}
+
+	first, err := load()
+	assert.NoError(t, err)
+	again, err := load()
+	assert.NoError(t, err)
+	assert.Same(t, first, again)
+
+	// Another database has its own cache
+	other := database.NewBoltDatabase(filepath.Join(t.TempDir(), "other.db"))
+	defer other.Close()
+	assert.NoError(t, CreateCustomRule(&model.CustomRule{Name: "Other", Points: "5"}, other))
+	ruleset, err := LoadRuleset(other)
+	assert.NoError(t, err)
+	assert.Len(t, ruleset.Rules, 1)
+	again, err = load()
+	assert.NoError(t, err)
+	assert.Same(t, first, again)
+
+	rule := model.CustomRule{Name: "Big baskets", Condition: "itemCount >= 10", Points: "25"}
+	assert.NoError(t, CreateCustomRule(&rule, db))
+	created, err := load()
+	assert.NoError(t, err)
+	assert.NotSame(t, first, created)
+	assert.Len(t, created.Rules, 1)
+
+	assert.NoError(t, DeleteCustomRule(rule.ID, db))
+	deleted, err := load()
+	assert.NoError(t, err)
+	assert.Empty(t, deleted.Rules)
+
+	// A stored rule that no longer compiles fails the load instead of being skipped
+	err = db.Update(func(tx *bolt.Tx) error {
+		return putCustomRule(tx, &model.CustomRule{ID: "broken", Name: "Broken", Points: "total *"})
+	})
+	assert.NoError(t, err)
+	_, err = load()
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
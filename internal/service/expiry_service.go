@@ -0,0 +1,222 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidRedemption is an error indicating that a redemption is not for a positive number of points.
+var ErrInvalidRedemption = errors.New("invalid redemption")
+
+// ErrInsufficientPoints is an error indicating that an account's balance does not cover a redemption.
+var ErrInsufficientPoints = errors.New("insufficient points")
+
+// RedeemPoints spends points of the account, its oldest points first, and returns the ledger entry
+// of the redemption and the remaining balance.
+func RedeemPoints(account string, points int, db *bolt.DB) (*model.LedgerEntry, int, error) {
+	if points <= 0 {
+		return nil, 0, fmt.Errorf("%w: points must be positive", ErrInvalidRedemption)
+	}
+	entry := model.LedgerEntry{Type: model.LedgerRedemption, Points: -points, CreatedAt: time.Now().UTC()}
+	var balance int
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		balance, err = accountBalance(tx, account)
+		if err != nil {
+			return err
+		}
+		if balance < points {
+			return fmt.Errorf("%w: the balance of %s is %d", ErrInsufficientPoints, account, balance)
+		}
+		balance -= points
+		return appendLedgerEntry(tx, account, &entry)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &entry, balance, nil
+}
+
+// ListExpiringPoints returns the unspent points of the account that expire by the time given,
+// oldest first. Points expire the given number of months after they were earned, never when it is zero.
+func ListExpiringPoints(account string, months int, by time.Time, db *bolt.DB) ([]model.PointLot, error) {
+	expiring := []model.PointLot{}
+	if months <= 0 {
+		return expiring, nil
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		lots, err := pointLots(tx, account, months)
+		for _, lot := range lots {
+			if !lot.ExpiresAt.After(by) {
+				expiring = append(expiring, lot)
+			}
+		}
+		return err
+	})
+	return expiring, err
+}
+
+// unspentPoints returns the points of the receipt the account has not spent and that did not expire
+func unspentPoints(tx *bolt.Tx, account, receiptID string) (int, error) {
+	// The expiry months only set the lots' ExpiresAt
+	lots, err := pointLots(tx, account, 0)
+	points := 0
+	for _, lot := range lots {
+		if lot.ReceiptID == receiptID {
+			points += lot.Points
+		}
+	}
+	return points, err
+}
+
+// pointLots replays the account's ledger into the unspent points of each receipt. Reversals and
+// expiries debit the points of their receipt, redemptions and whatever a debit exceeds its receipt
+// by are taken from the oldest points.
+func pointLots(tx *bolt.Tx, account string, months int) ([]model.PointLot, error) {
+	ledger := tx.Bucket(database.LedgerBucket).Bucket([]byte(account))
+	if ledger == nil {
+		return nil, nil
+	}
+	var lots []model.PointLot
+	err := ledger.ForEach(func(k, v []byte) error {
+		var entry model.LedgerEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		if entry.Points > 0 {
+			lots = append(lots, model.PointLot{
+				ReceiptID: entry.ReceiptID,
+				Points:    entry.Points,
+				EarnedAt:  entry.CreatedAt,
+				ExpiresAt: entry.CreatedAt.AddDate(0, months, 0),
+			})
+			return nil
+		}
+		debit := -entry.Points
+		spend := func(lot *model.PointLot) {
+			spent := min(debit, lot.Points)
+			lot.Points -= spent
+			debit -= spent
+		}
+		if entry.ReceiptID != "" {
+			for i := range lots {
+				if lots[i].ReceiptID == entry.ReceiptID {
+					spend(&lots[i])
+				}
+			}
+		}
+		for i := range lots {
+			spend(&lots[i])
+		}
+		return nil
+	})
+
+	unspent := lots[:0]
+	for _, lot := range lots {
+		if lot.Points > 0 {
+			unspent = append(unspent, lot)
+		}
+	}
+	return unspent, err
+}
+
+// ExpiryJob writes expiry entries to the ledgers for the points left unspent past their expiry.
+type ExpiryJob struct {
+	DB *bolt.DB
+	// Months is how long points can be spent after they were earned
+	Months int
+	// Interval is how often expired points are looked for
+	Interval time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewExpiryJob returns a job expiring points hourly, call Start to run it.
+func NewExpiryJob(db *bolt.DB, months int) *ExpiryJob {
+	return &ExpiryJob{DB: db, Months: months, Interval: time.Hour}
+}
+
+// Start expires points in the background until Stop is called.
+func (j *ExpiryJob) Start() {
+	j.done = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := time.NewTicker(j.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.done:
+				return
+			case <-ticker.C:
+				if _, err := j.ExpireDue(time.Now().UTC()); err != nil {
+					log.Printf("expiring points failed: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop waits for the current round of expiries to finish.
+func (j *ExpiryJob) Stop() {
+	close(j.done)
+	j.wg.Wait()
+}
+
+// ExpireDue debits every account for its unspent points expired by now and returns how many points expired.
+func (j *ExpiryJob) ExpireDue(now time.Time) (int, error) {
+	var accounts []string
+	err := j.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		accounts, err = ledgerAccounts(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, account := range accounts {
+		// Only an account whose transaction committed counts toward the points expired
+		accountExpired := 0
+		err = j.DB.Update(func(tx *bolt.Tx) error {
+			lots, err := pointLots(tx, account, j.Months)
+			if err != nil {
+				return err
+			}
+			for _, lot := range lots {
+				if lot.ExpiresAt.After(now) {
+					continue
+				}
+				err := appendLedgerEntry(tx, account, &model.LedgerEntry{
+					Type:      model.LedgerExpiry,
+					ReceiptID: lot.ReceiptID,
+					Points:    -lot.Points,
+					CreatedAt: now,
+				})
+				if err != nil {
+					return err
+				}
+				accountExpired += lot.Points
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+		expired += accountExpired
+	}
+	if expired > 0 {
+		log.Printf("expired %d points\n", expired)
+	}
+	return expired, err
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestExpiry(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 12, 0, 0, 0, time.UTC)
+	}
+
+	// 180 points earned, 120 of them spent and the receipt of 30 reversed
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, entry := range []model.LedgerEntry{
+			{Type: model.LedgerEarn, ReceiptID: "r1", Points: 100, CreatedAt: day(time.January, 10)},
+			{Type: model.LedgerEarn, ReceiptID: "r2", Points: 50, CreatedAt: day(time.March, 10)},
+			{Type: model.LedgerEarn, ReceiptID: "r3", Points: 30, CreatedAt: day(time.June, 10)},
+			{Type: model.LedgerRedemption, Points: -120, CreatedAt: day(time.July, 1)},
+			{Type: model.LedgerReversal, ReceiptID: "r3", Points: -30, CreatedAt: day(time.July, 2)},
+		} {
+			if err := appendLedgerEntry(tx, "alice", &entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// The redemption spent r1 and 20 points of r2
+	expiring, err := ListExpiringPoints("alice", 12, day(time.December, 31).AddDate(1, 0, 0), db)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.PointLot{
+		{ReceiptID: "r2", Points: 30, EarnedAt: day(time.March, 10), ExpiresAt: day(time.March, 10).AddDate(1, 0, 0)},
+	}, expiring)
+	expiring, err = ListExpiringPoints("alice", 12, day(time.March, 9).AddDate(1, 0, 0), db)
+	assert.NoError(t, err)
+	assert.Empty(t, expiring)
+	expiring, err = ListExpiringPoints("alice", 0, day(time.December, 31).AddDate(10, 0, 0), db)
+	assert.NoError(t, err)
+	assert.Empty(t, expiring)
+
+	// The job expires the rest of r2 once, then nothing is left
+	job := NewExpiryJob(db, 12)
+	expired, err := job.ExpireDue(day(time.March, 9).AddDate(1, 0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, expired)
+	expired, err = job.ExpireDue(day(time.April, 1).AddDate(1, 0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, 30, expired)
+	expired, err = job.ExpireDue(day(time.April, 2).AddDate(1, 0, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, expired)
+
+	entries, err := ListLedger("alice", 1, db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.LedgerExpiry, entries[0].Type)
+	assert.Equal(t, "r2", entries[0].ReceiptID)
+	assert.Equal(t, -30, entries[0].Points)
+	balance, err := GetBalance("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, balance)
+}
+
+func TestReverseExpiredReceipt(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	processor := NewProcessor(db, Policy{ExpiryMonths: 12}, 1)
+
+	// 109 and 31 points
+	pepsi := model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "13:13", Total: "1.25",
+		Items: []model.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}}}
+	var ids []string
+	for _, receipt := range []model.Receipt{gatoradeReceipt, pepsi} {
+		id, err := processor.Submit(&receipt, Submitter{AccountID: "alice"})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	_, err := processor.ProcessPending()
+	assert.NoError(t, err)
+
+	// The points of the first receipt expire, then it is reversed
+	db.Update(func(tx *bolt.Tx) error {
+		return appendLedgerEntry(tx, "alice", &model.LedgerEntry{Type: model.LedgerExpiry, ReceiptID: ids[0], Points: -109, CreatedAt: time.Now().UTC()})
+	})
+	_, err = ReverseReceipt(ids[0], "carol", "duplicate", db)
+	assert.NoError(t, err)
+
+	// Nothing is left to take back, the other receipt keeps its points
+	entries, err := ListLedger("alice", 1, db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.LedgerReversal, entries[0].Type)
+	assert.Equal(t, 0, entries[0].Points)
+	balance, err := GetBalance("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 31, balance)
+
+	// The unspent points of the other receipt are taken back in full
+	_, err = ReverseReceipt(ids[1], "carol", "duplicate", db)
+	assert.NoError(t, err)
+	balance, err = GetBalance("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, balance)
+}
+
+func TestRedeemPoints(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	err := db.Update(func(tx *bolt.Tx) error {
+		return creditAccount(tx, &model.ReceiptRecord{ID: "r1", AccountID: "alice", Points: 100}, time.Now().UTC())
+	})
+	assert.NoError(t, err)
+
+	_, _, err = RedeemPoints("alice", 0, db)
+	assert.ErrorIs(t, err, ErrInvalidRedemption)
+	_, _, err = RedeemPoints("alice", 101, db)
+	assert.ErrorIs(t, err, ErrInsufficientPoints)
+	_, _, err = RedeemPoints("bob", 1, db)
+	assert.ErrorIs(t, err, ErrInsufficientPoints)
+
+	entry, balance, err := RedeemPoints("alice", 60, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, balance)
+	assert.Equal(t, model.LedgerRedemption, entry.Type)
+	assert.Equal(t, -60, entry.Points)
+	assert.Equal(t, uint64(2), entry.Seq)
+
+	expiring, err := ListExpiringPoints("alice", 12, time.Now().UTC().AddDate(2, 0, 0), db)
+	assert.NoError(t, err)
+	assert.Len(t, expiring, 1)
+	assert.Equal(t, 40, expiring[0].Points)
+}
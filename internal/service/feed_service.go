@@ -0,0 +1,146 @@
+package service
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// feedRetention is how many of the most recent events the feed keeps for resuming streams
+const feedRetention = 10000
+
+// FeedFilter selects the events a feed subscriber receives, zero values match everything.
+type FeedFilter struct {
+	Retailer  string
+	Status    string
+	AccountID string
+	MinPoints int
+}
+
+// Matches reports whether the event passes the filter.
+func (filter FeedFilter) Matches(event *model.FeedEvent) bool {
+	if filter.Retailer != "" && normalizeRetailerKey(filter.Retailer) != normalizeRetailerKey(event.Retailer) {
+		return false
+	}
+	if filter.Status != "" && filter.Status != event.Status {
+		return false
+	}
+	if filter.AccountID != "" && filter.AccountID != event.AccountID {
+		return false
+	}
+	return event.Points >= filter.MinPoints
+}
+
+// Feed is the live feed of processed receipts. Events are stored with a sequence number,
+// so subscribers that reconnect can resume after the last event they received.
+type Feed struct {
+	DB *bolt.DB
+
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+// NewFeed returns a feed over the events stored in the database.
+func NewFeed(db *bolt.DB) *Feed {
+	return &Feed{DB: db, subscribers: map[chan struct{}]struct{}{}}
+}
+
+// Subscribe returns a channel that is signalled when new events are published
+// and a function to cancel the subscription.
+func (feed *Feed) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	feed.mu.Lock()
+	feed.subscribers[ch] = struct{}{}
+	feed.mu.Unlock()
+	return ch, func() {
+		feed.mu.Lock()
+		delete(feed.subscribers, ch)
+		feed.mu.Unlock()
+	}
+}
+
+// publish wakes every subscriber without blocking on slow ones, they catch up with Since
+func (feed *Feed) publish() {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	for ch := range feed.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Head returns the sequence number of the latest event, new subscribers start after it
+func (feed *Feed) Head() (uint64, error) {
+	var seq uint64
+	err := feed.DB.View(func(tx *bolt.Tx) error {
+		seq = tx.Bucket(database.FeedBucket).Sequence()
+		return nil
+	})
+	return seq, err
+}
+
+// Since scans up to limit events after the sequence number and returns those matching the filter,
+// oldest first, with the sequence number of the last event scanned to continue from.
+func (feed *Feed) Since(seq uint64, filter FeedFilter, limit int) ([]model.FeedEvent, uint64, error) {
+	events := []model.FeedEvent{}
+	err := feed.DB.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(database.FeedBucket).Cursor()
+		scanned := 0
+		for k, v := cursor.Seek(queueKey(seq + 1)); k != nil && scanned < limit; k, v = cursor.Next() {
+			var event model.FeedEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			scanned++
+			seq = event.Seq
+			if filter.Matches(&event) {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	return events, seq, err
+}
+
+// appendFeedEvent stores the outcome of processing the receipt on the feed and drops
+// the oldest events beyond the retention
+func appendFeedEvent(tx *bolt.Tx, record *model.ReceiptRecord, now time.Time) error {
+	bucket := tx.Bucket(database.FeedBucket)
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	event := model.FeedEvent{
+		Seq:       seq,
+		ReceiptID: record.ID,
+		Points:    record.CreditedPoints(),
+		Status:    record.Status,
+		AccountID: record.AccountID,
+		CreatedAt: now,
+	}
+	if record.Receipt != nil {
+		event.Retailer = record.Receipt.RetailerName()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put(queueKey(seq), data); err != nil {
+		return err
+	}
+
+	cursor := bucket.Cursor()
+	for k, _ := cursor.First(); k != nil && binary.BigEndian.Uint64(k)+feedRetention <= seq; k, _ = cursor.First() {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultHoldThreshold is the risk score at which receipts are held by default
+const DefaultHoldThreshold = 70
+
+// Weights of the fraud heuristics, a receipt's risk score is their sum capped at 100
+const (
+	riskDuplicate      = 60
+	riskSameItems      = 30
+	riskFuturePurchase = 80
+	riskStalePurchase  = 30
+	riskTotalMismatch  = 30
+	riskTunedTotal     = 30
+)
+
+// maxPurchaseAge is how old a purchase can be before it is considered suspicious
+const maxPurchaseAge = 90 * 24 * time.Hour
+
+// Risk is the outcome of scoring a receipt for fraud, Score ranges from 0 to 100.
+type Risk struct {
+	Score   int
+	Reasons []string
+}
+
+func (risk *Risk) add(weight int, reason string) {
+	risk.Score = min(risk.Score+weight, 100)
+	risk.Reasons = append(risk.Reasons, reason)
+}
+
+// assessRisk scores a receipt against the stored history and its own consistency
+func assessRisk(tx *bolt.Tx, receipt *model.Receipt, now time.Time) (Risk, error) {
+	var risk Risk
+
+	// Resubmissions of the same purchase, possibly with the items shuffled
+	if id := tx.Bucket(database.FingerprintBucket).Get([]byte(receipt.Fingerprint())); id != nil {
+		risk.add(riskDuplicate, fmt.Sprintf("same retailer, purchase date, time and total as receipt %s", id))
+		original, err := getRecord(tx, string(id))
+		if err != nil && !errors.Is(err, ErrIdNotFound) {
+			return risk, err
+		}
+		if original != nil && original.Receipt != nil && sameItems(original.Receipt.Items, receipt.Items) {
+			risk.add(riskSameItems, fmt.Sprintf("same items as receipt %s", id))
+		}
+	}
+
+	// Purchases that cannot have happened yet or are too old to be claimed. Receipts
+	// without a time zone or offset are read in UTC, a day of slack covers stores ahead of it.
+	if receipt.PurchaseDate != "" {
+		purchaseDate, err := receipt.PurchasedAt()
+		if receipt.PurchaseTime == "" {
+			purchaseDate, err = time.Parse("2006-01-02", receipt.PurchaseDate)
+		}
+		if err == nil {
+			if purchaseDate.After(now.Add(24 * time.Hour)) {
+				risk.add(riskFuturePurchase, "purchase date is in the future")
+			} else if now.Sub(purchaseDate) > maxPurchaseAge {
+				risk.add(riskStalePurchase, "purchase date is more than 90 days old")
+			}
+		}
+	}
+
+	// Totals edited to hit the round dollar and quarter rules no longer add up
+	total, err := strconv.ParseFloat(receipt.Total, 64)
+	if err == nil && len(receipt.Items) > 0 && toCents(total) != receipt.ExpectedTotalCents() {
+		risk.add(riskTotalMismatch, "total does not match the item prices, discounts, taxes and tip")
+		if math.Mod(total, 0.25) == 0 {
+			risk.add(riskTunedTotal, "total is a multiple of 0.25 that does not match the items")
+		}
+	}
+
+	return risk, nil
+}
+
+// indexFingerprint remembers the first receipt seen with the receipt's fingerprint
+func indexFingerprint(tx *bolt.Tx, receipt *model.Receipt, id string) error {
+	bucket := tx.Bucket(database.FingerprintBucket)
+	key := []byte(receipt.Fingerprint())
+	if bucket.Get(key) != nil {
+		return nil
+	}
+	return bucket.Put(key, []byte(id))
+}
+
+// sameItems reports whether both lists hold the same items regardless of order
+func sameItems(a, b []model.Item) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	key := func(item model.Item) string { return item.ShortDescription + "|" + item.Price }
+	keysA := make([]string, len(a))
+	keysB := make([]string, len(b))
+	for i := range a {
+		keysA[i] = key(a[i])
+		keysB[i] = key(b[i])
+	}
+	sort.Strings(keysA)
+	sort.Strings(keysB)
+	for i := range keysA {
+		if keysA[i] != keysB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
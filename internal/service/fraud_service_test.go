@@ -0,0 +1,118 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestAssessRisk(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	now := time.Date(2022, 3, 25, 12, 0, 0, 0, time.UTC)
+	original := model.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Items: []model.Item{
+			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Doritos", Price: "6.75"},
+		},
+		Total: "9.00",
+	}
+	processor := NewProcessor(db, Policy{}, 1)
+	_, err := processor.Submit(&original, Submitter{})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+
+	shuffled := original
+	shuffled.Retailer = "m&m corner  market"
+	shuffled.Items = []model.Item{original.Items[1], original.Items[0]}
+
+	otherItems := original
+	otherItems.Items = []model.Item{{ShortDescription: "Water", Price: "9.00"}}
+
+	future := original
+	future.PurchaseDate = "2022-04-02"
+
+	stale := original
+	stale.PurchaseDate = "2021-01-02"
+
+	tuned := original
+	tuned.PurchaseTime = "10:00"
+	tuned.Total = "10.00"
+
+	mismatch := original
+	mismatch.PurchaseTime = "10:00"
+	mismatch.Total = "9.01"
+
+	tests := []struct {
+		name    string
+		receipt model.Receipt
+		score   int
+		reasons int
+	}{
+		{"shuffled duplicate", shuffled, 90, 2},
+		{"duplicate with other items", otherItems, 60, 1},
+		{"future purchase", future, 80, 1},
+		{"stale purchase", stale, 30, 1},
+		{"tuned total", tuned, 60, 2},
+		{"total mismatch", mismatch, 30, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db.View(func(tx *bolt.Tx) error {
+				risk, err := assessRisk(tx, &test.receipt, now)
+				assert.NoError(t, err)
+				assert.Equal(t, test.score, risk.Score)
+				assert.Len(t, risk.Reasons, test.reasons)
+				return nil
+			})
+		})
+	}
+}
+
+func TestProcessorHoldsRiskyReceipts(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: time.Now().UTC().Format("2006-01-02"),
+		PurchaseTime: "14:33",
+		Items:        []model.Item{{ShortDescription: "Gatorade", Price: "2.25"}},
+		Total:        "2.25",
+	}
+	processor := NewProcessor(db, Policy{HoldThreshold: DefaultHoldThreshold}, 1)
+
+	id, err := processor.Submit(&receipt, Submitter{})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+	record, err := GetReceipt(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusScored, record.Status)
+	assert.Equal(t, 0, record.RiskScore)
+
+	id, err = processor.Submit(&receipt, Submitter{})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+	record, err = GetReceipt(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusPendingReview, record.Status)
+	assert.Equal(t, 90, record.RiskScore)
+	assert.NotZero(t, record.Points)
+
+	// Held receipts are not credited
+	points, err := GetPoints(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, points)
+}
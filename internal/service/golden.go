@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Suffixes of the golden file harness's files, name.receipt.json is scored and compared with name.golden.json
+const (
+	ReceiptFileSuffix = ".receipt.json"
+	GoldenFileSuffix  = ".golden.json"
+	// RulesetFileName is the ruleset of a golden directory
+	RulesetFileName = "ruleset.json"
+)
+
+// RulesetFile is a ruleset written as JSON for the golden file harness. Campaigns, products and
+// custom rules need an ID, so the breakdowns naming them are the same on every run.
+type RulesetFile struct {
+	Retailers []model.Retailer   `json:"retailers"`
+	Campaigns []model.Campaign   `json:"campaigns"`
+	Products  []model.Product    `json:"products"`
+	Rules     []model.CustomRule `json:"rules"`
+}
+
+// GoldenReport is the outcome of a golden file run, by the name of the receipt file without its suffix.
+type GoldenReport struct {
+	Passed  []string
+	Updated []string
+	Failed  []GoldenFailure
+}
+
+// GoldenFailure is a receipt whose breakdown does not match its golden file.
+type GoldenFailure struct {
+	Name   string
+	Reason string
+}
+
+// LoadRulesetFile validates the retailers, campaigns, products and custom rules of a ruleset file
+// and stores them in the database with their IDs.
+func LoadRulesetFile(path string, db *bolt.DB) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file RulesetFile
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for i := range file.Retailers {
+			retailer := &file.Retailers[i]
+			if retailer.ID == "" {
+				retailer.ID = RetailerID(retailer.Name)
+			}
+			if err := validateRetailer(retailer); err != nil {
+				return fmt.Errorf("retailer %s: %w", retailer.ID, err)
+			}
+			if err := putRetailer(tx, retailer); err != nil {
+				return fmt.Errorf("retailer %s: %w", retailer.ID, err)
+			}
+		}
+		for i := range file.Campaigns {
+			campaign := &file.Campaigns[i]
+			if campaign.ID == "" {
+				return fmt.Errorf("campaign %q needs an id", campaign.Name)
+			}
+			if err := validateCampaign(campaign); err != nil {
+				return fmt.Errorf("campaign %s: %w", campaign.ID, err)
+			}
+			if err := putCampaign(tx, campaign); err != nil {
+				return err
+			}
+		}
+		for i := range file.Products {
+			product := &file.Products[i]
+			if product.ID == "" {
+				return fmt.Errorf("product %q needs an id", product.Name)
+			}
+			if err := validateProduct(product); err != nil {
+				return fmt.Errorf("product %s: %w", product.ID, err)
+			}
+			if err := putProduct(tx, product); err != nil {
+				return fmt.Errorf("product %s: %w", product.ID, err)
+			}
+		}
+		for i := range file.Rules {
+			rule := &file.Rules[i]
+			if rule.ID == "" {
+				return fmt.Errorf("rule %q needs an id", rule.Name)
+			}
+			if _, err := CompileRule(*rule); err != nil {
+				return fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+			if err := putCustomRule(tx, rule); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunGoldenFiles scores every receipt file of the directory against the ruleset in the database, matching
+// its retailer and items like on ingest, and compares the breakdown with its golden file. With update
+// the golden files are written instead, for new receipts or after an intended change of the rules.
+func RunGoldenFiles(dir string, update bool, db *bolt.DB) (*GoldenReport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+ReceiptFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	report := &GoldenReport{}
+	rules := &rulesCache{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ReceiptFileSuffix)
+		got, err := goldenBreakdown(path, rules, db)
+		if err != nil {
+			report.Failed = append(report.Failed, GoldenFailure{Name: name, Reason: err.Error()})
+			continue
+		}
+
+		goldenPath := filepath.Join(dir, name+GoldenFileSuffix)
+		if update {
+			if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+				return nil, err
+			}
+			report.Updated = append(report.Updated, name)
+			continue
+		}
+		want, err := os.ReadFile(goldenPath)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			report.Failed = append(report.Failed, GoldenFailure{Name: name, Reason: "no golden file, run with -update to create it"})
+		case err != nil:
+			return nil, err
+		case !bytes.Equal(bytes.TrimSpace(want), bytes.TrimSpace(got)):
+			report.Failed = append(report.Failed, GoldenFailure{Name: name, Reason: "breakdown differs from the golden file:\n" + lineDiff(string(want), string(got))})
+		default:
+			report.Passed = append(report.Passed, name)
+		}
+	}
+	return report, nil
+}
+
+// goldenBreakdown scores a receipt file and returns its breakdown as indented JSON
+func goldenBreakdown(path string, rules *rulesCache, db *bolt.DB) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var receipt model.Receipt
+	if err := json.Unmarshal(data, &receipt); err != nil {
+		return nil, err
+	}
+	if err := receipt.Validate(); err != nil {
+		return nil, err
+	}
+
+	var breakdown model.Breakdown
+	err = db.View(func(tx *bolt.Tx) error {
+		if err := canonicalizeRetailer(tx, &receipt); err != nil {
+			return err
+		}
+		if err := matchProducts(tx, rules, &receipt); err != nil {
+			return err
+		}
+		ruleset, err := rules.loadRuleset(tx)
+		if err != nil {
+			return err
+		}
+		breakdown = CalculateBreakdown(&receipt, ruleset)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(breakdown, "", "  ")
+	return append(out, '\n'), err
+}
+
+// lineDiff lists the lines only in want with "-" and the lines only in got with "+", using their longest common subsequence
+func lineDiff(want, got string) string {
+	a := strings.Split(strings.TrimSpace(want), "\n")
+	b := strings.Split(strings.TrimSpace(got), "\n")
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || common[i+1][j] >= common[i][j+1]):
+			diff.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			diff.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return diff.String()
+}
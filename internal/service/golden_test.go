@@ -0,0 +1,107 @@
+package service
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// go test ./internal/service -run TestGoldenFiles -update regenerates the golden files
+var update = flag.Bool("update", false, "write the golden files of testdata/rules instead of comparing them")
+
+// TestGoldenFiles scores the receipts of testdata/rules against its ruleset. Rule authors add a
+// name.receipt.json there and run with -update to write its name.golden.json.
+func TestGoldenFiles(t *testing.T) {
+	dir := filepath.Join("testdata", "rules")
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	assert.NoError(t, LoadRulesetFile(filepath.Join(dir, RulesetFileName), db))
+
+	report, err := RunGoldenFiles(dir, *update, db)
+	assert.NoError(t, err)
+	for _, failure := range report.Failed {
+		t.Errorf("%s: %s", failure.Name, failure.Reason)
+	}
+	assert.NotEmpty(t, append(report.Passed, report.Updated...))
+}
+
+func TestRunGoldenFiles(t *testing.T) {
+	dir := t.TempDir()
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	write := func(name, data string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	write("simple.receipt.json", `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-02",
+	"purchaseTime": "13:13",
+	"total": "1.25",
+	"items": [
+		{"shortDescription": "Pepsi - 12-oz", "price": "1.25"}
+	]
+}`)
+	write("invalid.receipt.json", `{"retailer": "Target", "purchaseDate": "2022-13-01"}`)
+
+	report, err := RunGoldenFiles(dir, false, db)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Passed)
+	assert.Equal(t, []GoldenFailure{
+		{Name: "invalid", Reason: "field `purchaseDate` is not in the correct format"},
+		{Name: "simple", Reason: "no golden file, run with -update to create it"},
+	}, report.Failed)
+
+	report, err = RunGoldenFiles(dir, true, db)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"simple"}, report.Updated)
+
+	report, err = RunGoldenFiles(dir, false, db)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"simple"}, report.Passed)
+
+	// A rule change shows up as a diff of the breakdown
+	golden, err := os.ReadFile(filepath.Join(dir, "simple.golden.json"))
+	assert.NoError(t, err)
+	write("simple.golden.json", string(golden[:len(golden)-4])+"0\n}\n")
+	report, err = RunGoldenFiles(dir, false, db)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Failed, 2) {
+		assert.Contains(t, report.Failed[1].Reason, "-   \"total\": 30\n+   \"total\": 31\n")
+	}
+}
+
+func TestLoadRulesetFile(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	path := filepath.Join(t.TempDir(), RulesetFileName)
+
+	tests := []struct {
+		name    string
+		ruleset string
+		err     string
+	}{
+		{"unknown field", `{"rule": []}`, `json: unknown field "rule"`},
+		{"campaign without id", `{"campaigns": [{"name": "Double"}]}`, `campaign "Double" needs an id`},
+		{"invalid rule", `{"rules": [{"id": "broken", "name": "Broken", "points": "total +"}]}`, "rule broken: invalid rule: points: column 8: unexpected end of expression"},
+		{"valid", `{"rules": [{"id": "bonus", "name": "Bonus", "points": "10"}]}`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.NoError(t, os.WriteFile(path, []byte(test.ruleset), 0644))
+			err := LoadRulesetFile(path, db)
+			if test.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+
+	rule, err := GetCustomRule("bonus", db)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bonus", rule.Name)
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// creditAccount records the points of a scored receipt in its account's ledger.
+// Receipts submitted without an account are not credited anywhere.
+func creditAccount(tx *bolt.Tx, record *model.ReceiptRecord, now time.Time) error {
+	if record.AccountID == "" || record.Points == 0 {
+		return nil
+	}
+	return appendLedgerEntry(tx, record.AccountID, &model.LedgerEntry{
+		Type:      model.LedgerEarn,
+		ReceiptID: record.ID,
+		Points:    record.Points,
+		TierBonus: creditedTierBonus(record),
+		CreatedAt: now,
+	})
+}
+
+// creditedTierBonus is the part of the receipt's points its tier bonus added. Caps on the total apply
+// after the tier bonus and take back the tier bonus first.
+func creditedTierBonus(record *model.ReceiptRecord) int {
+	if record.Breakdown == nil {
+		return 0
+	}
+	base := record.Points
+	for _, award := range record.Breakdown.Rules {
+		if award.Rule == model.RuleTierBonus || (award.Rule == model.RuleCap && award.CappedRule == "") {
+			base -= award.Points
+		}
+	}
+	return max(0, record.Points-max(0, base))
+}
+
+// appendLedgerEntry adds an entry to the account's ledger, a nested bucket keyed by sequence, and sets its Seq
+func appendLedgerEntry(tx *bolt.Tx, account string, entry *model.LedgerEntry) error {
+	ledger, err := tx.Bucket(database.LedgerBucket).CreateBucketIfNotExists([]byte(account))
+	if err != nil {
+		return err
+	}
+	seq, err := ledger.NextSequence()
+	if err != nil {
+		return err
+	}
+	entry.Seq = seq
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return ledger.Put(queueKey(seq), data)
+}
+
+// GetBalance returns the sum of the entries in the account's ledger, zero for accounts without entries.
+func GetBalance(account string, db *bolt.DB) (int, error) {
+	balance := 0
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		balance, err = accountBalance(tx, account)
+		return err
+	})
+	return balance, err
+}
+
+func accountBalance(tx *bolt.Tx, account string) (int, error) {
+	ledger := tx.Bucket(database.LedgerBucket).Bucket([]byte(account))
+	if ledger == nil {
+		return 0, nil
+	}
+	balance := 0
+	err := ledger.ForEach(func(k, v []byte) error {
+		var entry model.LedgerEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		balance += entry.Points
+		return nil
+	})
+	return balance, err
+}
+
+// ledgerAccounts lists the accounts with a ledger
+func ledgerAccounts(tx *bolt.Tx) ([]string, error) {
+	var accounts []string
+	err := tx.Bucket(database.LedgerBucket).ForEach(func(k, v []byte) error {
+		if v == nil {
+			accounts = append(accounts, string(k))
+		}
+		return nil
+	})
+	return accounts, err
+}
+
+// ListLedger returns up to limit entries of the account's ledger, newest first.
+func ListLedger(account string, limit int, db *bolt.DB) ([]model.LedgerEntry, error) {
+	entries := []model.LedgerEntry{}
+	err := db.View(func(tx *bolt.Tx) error {
+		ledger := tx.Bucket(database.LedgerBucket).Bucket([]byte(account))
+		if ledger == nil {
+			return nil
+		}
+		cursor := ledger.Cursor()
+		for k, v := cursor.Last(); k != nil && len(entries) < limit; k, v = cursor.Prev() {
+			var entry model.LedgerEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Limits are business level caps on receipt submissions, a zero value disables a cap.
+type Limits struct {
+	// MaxPerRetailerPerDay caps the receipts an account can submit for one retailer per UTC day
+	MaxPerRetailerPerDay int
+}
+
+// LimitError is returned when a submission exceeds a cap, RetryAfter is when the cap resets.
+type LimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return e.Reason
+}
+
+// dayLayout formats the day prefix of the daily counter keys so they sort chronologically
+const dayLayout = "2006-01-02"
+
+// reserveDailyQuota counts the receipt against the submitter's daily cap for its retailer,
+// failing with a LimitError once the cap is reached. Every spelling of a registry retailer
+// shares one counter. It runs inside the transaction storing the receipt so concurrent
+// submissions cannot overshoot the cap.
+func reserveDailyQuota(tx *bolt.Tx, receipt *model.Receipt, submitter Submitter, limits Limits, now time.Time) error {
+	if limits.MaxPerRetailerPerDay <= 0 {
+		return nil
+	}
+	owner := submitter.AccountID
+	if owner == "" {
+		owner = submitter.ClientID
+	}
+
+	bucket := tx.Bucket(database.DailyCountsBucket)
+	today := now.UTC().Format(dayLayout)
+	if err := pruneDailyCounts(bucket, today); err != nil {
+		return err
+	}
+
+	key := []byte(today + "|" + owner + "|" + normalizeRetailerKey(receipt.RetailerName()))
+	count := 0
+	if data := bucket.Get(key); data != nil {
+		var err error
+		if count, err = strconv.Atoi(string(data)); err != nil {
+			return err
+		}
+	}
+	if count >= limits.MaxPerRetailerPerDay {
+		midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return &LimitError{
+			Reason:     fmt.Sprintf("daily limit of %d receipts for retailer %q reached", limits.MaxPerRetailerPerDay, receipt.Retailer),
+			RetryAfter: midnight.Sub(now),
+		}
+	}
+	return bucket.Put(key, []byte(strconv.Itoa(count+1)))
+}
+
+// pruneDailyCounts deletes the counters of previous days, the keys are prefixed with the day
+func pruneDailyCounts(bucket *bolt.Bucket, today string) error {
+	cursor := bucket.Cursor()
+	for k, _ := cursor.First(); k != nil && bytes.Compare(k, []byte(today)) < 0; k, _ = cursor.First() {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeRetailerKey folds case and whitespace so trivially different spellings share a counter
+func normalizeRetailerKey(retailer string) string {
+	return strings.Join(strings.Fields(strings.ToLower(retailer)), " ")
+}
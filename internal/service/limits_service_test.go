@@ -0,0 +1,44 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestReserveDailyQuota(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	limits := Limits{MaxPerRetailerPerDay: 1}
+	alice := Submitter{AccountID: "alice"}
+	reserve := func(retailer string, submitter Submitter, now time.Time) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			return reserveDailyQuota(tx, &model.Receipt{Retailer: retailer}, submitter, limits, now)
+		})
+	}
+
+	morning := time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC)
+	assert.NoError(t, reserve("M&M Corner Market", alice, morning))
+
+	// Spelling variations of the retailer share the counter
+	err := reserve("  m&m corner   MARKET", alice, morning)
+	var limitErr *LimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 18*time.Hour, limitErr.RetryAfter)
+
+	assert.NoError(t, reserve("M&M Corner Market", Submitter{AccountID: "bob"}, morning))
+
+	// The cap resets the next day and old counters are pruned
+	assert.NoError(t, reserve("M&M Corner Market", alice, morning.Add(24*time.Hour)))
+	db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket(database.DailyCountsBucket).Stats().KeyN)
+		return nil
+	})
+}
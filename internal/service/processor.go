@@ -0,0 +1,396 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// pollInterval is how often idle workers look for queued receipts they were not notified about
+const pollInterval = time.Second
+
+// Defaults of the processor's retries of receipts whose processing failed
+const (
+	DefaultMaxAttempts  = 5
+	DefaultRetryBackoff = 5 * time.Second
+)
+
+// Processor accepts receipts into a durable queue in the database and runs them
+// through validation, scoring, fraud checks and the ledger on a pool of workers.
+type Processor struct {
+	DB      *bolt.DB
+	Policy  Policy
+	Workers int
+	// Feed announces receipts as they finish processing
+	Feed *Feed
+	// MaxAttempts is how often a receipt is processed before it is rejected, failed attempts
+	// are retried after RetryBackoff, doubling with every attempt
+	MaxAttempts  int
+	RetryBackoff time.Duration
+
+	// rules are the compiled rules of the database
+	rules  *rulesCache
+	notify chan struct{}
+	done   chan struct{}
+	stop   sync.Once
+	wg     sync.WaitGroup
+}
+
+// NewProcessor returns a processor with the given number of workers, call Start to run them.
+func NewProcessor(db *bolt.DB, policy Policy, workers int) *Processor {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Processor{
+		DB:      db,
+		Policy:  policy,
+		Workers: workers,
+		Feed:    NewFeed(db),
+
+		MaxAttempts:  DefaultMaxAttempts,
+		RetryBackoff: DefaultRetryBackoff,
+		rules:        &rulesCache{},
+		notify:       make(chan struct{}, workers),
+		done:         make(chan struct{}),
+	}
+}
+
+// Submit matches the retailer against the registry and the items against the product catalog,
+// stores the receipt with status accepted and queues it for processing.
+// It fails with a LimitError when the submitter exceeds one of the policy's limits.
+func (p *Processor) Submit(receipt *model.Receipt, submitter Submitter) (string, error) {
+	now := time.Now().UTC()
+	record := model.ReceiptRecord{
+		ID:        uuid.New().String(),
+		Status:    model.StatusAccepted,
+		Receipt:   receipt,
+		ClientID:  submitter.ClientID,
+		AccountID: submitter.AccountID,
+		CreatedAt: now,
+	}
+	err := p.DB.Update(func(tx *bolt.Tx) error {
+		if err := canonicalizeRetailer(tx, receipt); err != nil {
+			return err
+		}
+		if err := matchProducts(tx, p.rules, receipt); err != nil {
+			return err
+		}
+		if err := reserveDailyQuota(tx, receipt, submitter, p.Policy.Limits, now); err != nil {
+			return err
+		}
+		if err := putRecord(tx, &record); err != nil {
+			return err
+		}
+		if err := indexAccountReceipt(tx, &record); err != nil {
+			return err
+		}
+		queue := tx.Bucket(database.QueueBucket)
+		seq, err := queue.NextSequence()
+		if err != nil {
+			return err
+		}
+		return queue.Put(queueKey(seq), []byte(record.ID))
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Wake an idle worker without blocking when all of them are busy
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+	return record.ID, nil
+}
+
+// Start requeues receipts that were being processed when the server stopped and starts the workers.
+func (p *Processor) Start() error {
+	if err := p.recover(); err != nil {
+		return err
+	}
+	for i := 0; i < p.Workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return nil
+}
+
+// Stop signals the workers to exit and waits for the receipts in flight to finish. It may be called
+// more than once, and also when Start was not called or failed.
+func (p *Processor) Stop() {
+	p.stop.Do(func() { close(p.done) })
+	p.wg.Wait()
+}
+
+// ProcessPending processes queued receipts on the calling goroutine until the queue is empty
+// and returns how many it processed.
+func (p *Processor) ProcessPending() (int, error) {
+	count := 0
+	for {
+		ok, err := p.processNext()
+		if err != nil || !ok {
+			return count, err
+		}
+		count++
+	}
+}
+
+func (p *Processor) work() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.ProcessPending(); err != nil {
+			log.Printf("processing receipts failed: %v\n", err)
+		}
+		select {
+		case <-p.done:
+			return
+		case <-p.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNext claims the oldest queued receipt and runs it through the pipeline.
+// It returns false when the queue is empty.
+func (p *Processor) processNext() (bool, error) {
+	key, id, err := p.claim()
+	if err != nil || id == "" {
+		return false, err
+	}
+
+	// The final transaction updates the record and releases the claim together,
+	// so a crash before it commits only causes the receipt to be processed again.
+	err = p.DB.Update(func(tx *bolt.Tx) error {
+		record, err := getRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := p.process(tx, record); err != nil {
+			return err
+		}
+		if err := putRecord(tx, record); err != nil {
+			return err
+		}
+		if err := appendFeedEvent(tx, record, *record.ProcessedAt); err != nil {
+			return err
+		}
+		return tx.Bucket(database.InflightBucket).Delete(key)
+	})
+	if err != nil {
+		log.Printf("processing receipt %s failed: %v\n", id, err)
+		if err := p.fail(key, id, err); err != nil {
+			// The claim stays in flight and is retried on the next start
+			log.Printf("releasing receipt %s failed: %v\n", id, err)
+		}
+		return true, nil
+	}
+	p.Feed.publish()
+	return true, nil
+}
+
+// fail releases the claim of a receipt whose processing failed. It goes back to the queue to be
+// retried after a backoff, or is rejected once it used up its attempts.
+func (p *Processor) fail(key []byte, id string, cause error) error {
+	rejected := false
+	err := p.DB.Update(func(tx *bolt.Tx) error {
+		record, err := getRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(database.InflightBucket).Delete(key); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		record.Attempts++
+		if record.Attempts < p.MaxAttempts {
+			retryAt := now.Add(p.RetryBackoff << (record.Attempts - 1))
+			record.Status = model.StatusAccepted
+			record.RetryAt = &retryAt
+			if err := putRecord(tx, record); err != nil {
+				return err
+			}
+			// The receipt keeps its place in the queue, claim skips it until it is due
+			return tx.Bucket(database.QueueBucket).Put(key, []byte(id))
+		}
+
+		rejected = true
+		record.Status = model.StatusRejected
+		record.RejectionReason = "processing failed: " + cause.Error()
+		record.RetryAt = nil
+		record.ProcessedAt = &now
+		if err := putRecord(tx, record); err != nil {
+			return err
+		}
+		if err := appendFeedEvent(tx, record, now); err != nil {
+			return err
+		}
+		return emitEvent(tx, model.EventReceiptRejected, record, 0, now)
+	})
+	if err == nil && rejected {
+		p.Feed.publish()
+	}
+	return err
+}
+
+// claim moves the oldest queued receipt that is due in flight and marks it as processing
+func (p *Processor) claim() ([]byte, string, error) {
+	var key []byte
+	var id string
+	err := p.DB.Update(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(database.QueueBucket)
+		now := time.Now().UTC()
+		// Entries without a record are dropped after the scan, deleting moves the cursor
+		var orphans [][]byte
+		var claimed *model.ReceiptRecord
+		c := queue.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			record, err := getRecord(tx, string(v))
+			if errors.Is(err, ErrIdNotFound) {
+				log.Printf("dropping queued receipt %s without a record\n", v)
+				orphans = append(orphans, append([]byte(nil), k...))
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if record.RetryAt != nil && now.Before(*record.RetryAt) {
+				continue
+			}
+			// Copy the entry before deleting it, bolt reuses the underlying memory
+			key = append([]byte(nil), k...)
+			id = string(v)
+			claimed = record
+			break
+		}
+		for _, k := range orphans {
+			if err := queue.Delete(k); err != nil {
+				return err
+			}
+		}
+		if claimed == nil {
+			return nil
+		}
+
+		if err := queue.Delete(key); err != nil {
+			return err
+		}
+		claimed.Status = model.StatusProcessing
+		claimed.RetryAt = nil
+		if err := putRecord(tx, claimed); err != nil {
+			return err
+		}
+		return tx.Bucket(database.InflightBucket).Put(key, []byte(id))
+	})
+	return key, id, err
+}
+
+// process runs the pipeline stages on a claimed receipt: validation, scoring, fraud, ledger and events
+func (p *Processor) process(tx *bolt.Tx, record *model.ReceiptRecord) error {
+	now := time.Now().UTC()
+	record.ProcessedAt = &now
+
+	if record.Receipt == nil {
+		record.Status = model.StatusRejected
+		record.RejectionReason = "receipt is missing"
+		return emitEvent(tx, model.EventReceiptRejected, record, 0, now)
+	}
+	if err := record.Receipt.Validate(); err != nil {
+		record.Status = model.StatusRejected
+		record.RejectionReason = err.Error()
+		return emitEvent(tx, model.EventReceiptRejected, record, 0, now)
+	}
+
+	ruleset, err := p.rules.loadRuleset(tx)
+	if err != nil {
+		return err
+	}
+	breakdown := CalculateBreakdown(record.Receipt, ruleset)
+	capRules(p.Policy.Caps, &breakdown)
+	if err := applyTierBonus(tx, record.AccountID, p.Policy.Tiers, &breakdown); err != nil {
+		return err
+	}
+	if err := capTotal(tx, record.AccountID, p.Policy.Caps, &breakdown, now); err != nil {
+		return err
+	}
+	record.Points = breakdown.Total
+	record.Breakdown = &breakdown
+
+	risk, err := assessRisk(tx, record.Receipt, now)
+	if err != nil {
+		return err
+	}
+	record.RiskScore = risk.Score
+	record.RiskReasons = risk.Reasons
+	if err := indexFingerprint(tx, record.Receipt, record.ID); err != nil {
+		return err
+	}
+	if p.Policy.HoldThreshold > 0 && risk.Score >= p.Policy.HoldThreshold {
+		log.Printf("holding receipt %s with risk score %d: %v\n", record.ID, risk.Score, risk.Reasons)
+		record.Status = model.StatusPendingReview
+		return enqueueReview(tx, record)
+	}
+
+	record.Status = model.StatusScored
+	if err := creditAccount(tx, record, now); err != nil {
+		return err
+	}
+	if _, err := evaluateTier(tx, record.AccountID, p.Policy.Tiers, now); err != nil {
+		return err
+	}
+	return emitEvent(tx, model.EventReceiptScored, record, record.Points, now)
+}
+
+// recover moves receipts left in flight by a previous run back to the front of the queue
+func (p *Processor) recover() error {
+	return p.DB.Update(func(tx *bolt.Tx) error {
+		inflight := tx.Bucket(database.InflightBucket)
+		queue := tx.Bucket(database.QueueBucket)
+		var keys [][]byte
+		err := inflight.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte(nil), k...))
+			// Keys keep their original sequence so recovered receipts stay in order
+			return queue.Put(k, v)
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := inflight.Delete(k); err != nil {
+				return err
+			}
+			record, err := getRecord(tx, string(queue.Get(k)))
+			if errors.Is(err, ErrIdNotFound) {
+				// Dropped by claim once it reaches the front of the queue
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			record.Status = model.StatusAccepted
+			if err := putRecord(tx, record); err != nil {
+				return err
+			}
+		}
+		if len(keys) > 0 {
+			log.Printf("requeued %d receipts left in flight\n", len(keys))
+		}
+		return nil
+	})
+}
+
+// queueKey encodes the queue sequence big-endian so keys sort in submission order
+func queueKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
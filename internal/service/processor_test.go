@@ -0,0 +1,223 @@
+package service
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+var gatoradeReceipt = model.Receipt{
+	Retailer:     "M&M Corner Market",
+	PurchaseDate: "2022-03-20",
+	PurchaseTime: "14:33",
+	Items: []model.Item{
+		{ShortDescription: "Gatorade", Price: "2.25"},
+		{ShortDescription: "Gatorade", Price: "2.25"},
+		{ShortDescription: "Gatorade", Price: "2.25"},
+		{ShortDescription: "Gatorade", Price: "2.25"},
+	},
+	Total: "9.00",
+}
+
+func ledgerEntries(t *testing.T, db *bolt.DB, account string) []model.LedgerEntry {
+	t.Helper()
+	entries := []model.LedgerEntry{}
+	db.View(func(tx *bolt.Tx) error {
+		ledger := tx.Bucket(database.LedgerBucket).Bucket([]byte(account))
+		if ledger == nil {
+			return nil
+		}
+		return ledger.ForEach(func(k, v []byte) error {
+			var entry model.LedgerEntry
+			assert.NoError(t, json.Unmarshal(v, &entry))
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	return entries
+}
+
+func TestProcessorLifecycle(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	processor := NewProcessor(db, Policy{}, 1)
+
+	receipt := gatoradeReceipt
+	id, err := processor.Submit(&receipt, Submitter{AccountID: "alice"})
+	assert.NoError(t, err)
+
+	record, err := GetReceipt(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusAccepted, record.Status)
+	_, err = GetPoints(id, db)
+	assert.ErrorIs(t, err, ErrNotProcessed)
+
+	processed, err := processor.ProcessPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, processed)
+
+	record, err = GetReceipt(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusScored, record.Status)
+	assert.Equal(t, 109, record.Points)
+	assert.NotNil(t, record.ProcessedAt)
+
+	// The scored points are credited to the submitter's account
+	entries := ledgerEntries(t, db, "alice")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, model.LedgerEarn, entries[0].Type)
+	assert.Equal(t, id, entries[0].ReceiptID)
+	assert.Equal(t, 109, entries[0].Points)
+}
+
+func TestProcessorStop(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	// Stopping a processor that never started, or stopping twice, does not panic
+	assert.NotPanics(t, NewProcessor(db, Policy{}, 1).Stop)
+	processor := NewProcessor(db, Policy{}, 2)
+	assert.NoError(t, processor.Start())
+	assert.NotPanics(t, processor.Stop)
+	assert.NotPanics(t, processor.Stop)
+}
+
+func TestProcessorRejectsInvalidReceipts(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	processor := NewProcessor(db, Policy{}, 1)
+
+	// Receipts accepted by an older version can fail validation in the pipeline
+	receipt := gatoradeReceipt
+	receipt.PurchaseTime = "25:00"
+	id, err := processor.Submit(&receipt, Submitter{AccountID: "alice"})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+
+	record, err := GetReceipt(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusRejected, record.Status)
+	assert.NotEmpty(t, record.RejectionReason)
+	assert.Empty(t, ledgerEntries(t, db, "alice"))
+}
+
+func TestProcessorRecoversInflightReceipts(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	processor := NewProcessor(db, Policy{}, 1)
+
+	receipt := gatoradeReceipt
+	id, err := processor.Submit(&receipt, Submitter{})
+	assert.NoError(t, err)
+
+	// Simulate a crash after a worker claimed the receipt
+	_, claimed, err := processor.claim()
+	assert.NoError(t, err)
+	assert.Equal(t, id, claimed)
+	record, _ := GetReceipt(id, db)
+	assert.Equal(t, model.StatusProcessing, record.Status)
+
+	restarted := NewProcessor(db, Policy{}, 1)
+	assert.NoError(t, restarted.recover())
+	record, _ = GetReceipt(id, db)
+	assert.Equal(t, model.StatusAccepted, record.Status)
+
+	processed, err := restarted.ProcessPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, processed)
+	db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 0, tx.Bucket(database.QueueBucket).Stats().KeyN)
+		assert.Equal(t, 0, tx.Bucket(database.InflightBucket).Stats().KeyN)
+		return nil
+	})
+}
+
+func TestProcessorRetriesFailedReceipts(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	processor := NewProcessor(db, Policy{}, 1)
+
+	// A corrupt campaign fails loading the ruleset
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.CampaignsBucket).Put([]byte("corrupt"), []byte("{"))
+	})
+	receipt := gatoradeReceipt
+	id, err := processor.Submit(&receipt, Submitter{AccountID: "alice"})
+	assert.NoError(t, err)
+
+	// The failed receipt goes back to the queue and is not due before its backoff
+	processed, err := processor.ProcessPending()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, processed)
+	record, _ := GetReceipt(id, db)
+	assert.Equal(t, model.StatusAccepted, record.Status)
+	assert.Equal(t, 1, record.Attempts)
+	assert.WithinDuration(t, time.Now().Add(DefaultRetryBackoff), *record.RetryAt, time.Second)
+	processed, _ = processor.ProcessPending()
+	assert.Equal(t, 0, processed)
+	db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 1, tx.Bucket(database.QueueBucket).Stats().KeyN)
+		assert.Equal(t, 0, tx.Bucket(database.InflightBucket).Stats().KeyN)
+		return nil
+	})
+
+	// It is rejected once it runs out of attempts
+	processor.RetryBackoff = 0
+	db.Update(func(tx *bolt.Tx) error {
+		record.RetryAt = nil
+		return putRecord(tx, record)
+	})
+	processed, err = processor.ProcessPending()
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultMaxAttempts-1, processed)
+	record, _ = GetReceipt(id, db)
+	assert.Equal(t, model.StatusRejected, record.Status)
+	assert.Equal(t, DefaultMaxAttempts, record.Attempts)
+	assert.Contains(t, record.RejectionReason, "processing failed: ")
+	assert.Nil(t, record.RetryAt)
+	assert.Empty(t, ledgerEntries(t, db, "alice"))
+
+	// Later receipts are processed once the campaign is fixed
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.CampaignsBucket).Delete([]byte("corrupt"))
+	})
+	receipt = gatoradeReceipt
+	id, err = processor.Submit(&receipt, Submitter{AccountID: "alice"})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+	record, _ = GetReceipt(id, db)
+	assert.Equal(t, model.StatusScored, record.Status)
+}
+
+func TestProcessorWorkers(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	processor := NewProcessor(db, Policy{}, 2)
+	assert.NoError(t, processor.Start())
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		receipt := gatoradeReceipt
+		id, err := processor.Submit(&receipt, Submitter{})
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+
+	assert.Eventually(t, func() bool {
+		for _, id := range ids {
+			if record, err := GetReceipt(id, db); err != nil || !record.Processed() {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	processor.Stop()
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidProduct is an error indicating that a product has an invalid matcher or bonus.
+var ErrInvalidProduct = errors.New("invalid product")
+
+// ErrProductExists is an error indicating that a SKU, exact or prefix matcher belongs to another product.
+var ErrProductExists = errors.New("product matcher already exists")
+
+// CreateProduct validates and adds a product to the catalog.
+func CreateProduct(product *model.Product, db *bolt.DB) error {
+	if err := validateProduct(product); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	product.ID = uuid.New().String()
+	product.CreatedAt = now
+	product.UpdatedAt = now
+	return db.Update(func(tx *bolt.Tx) error {
+		return putProduct(tx, product)
+	})
+}
+
+// GetProduct returns the product with the ID.
+func GetProduct(id string, db *bolt.DB) (*model.Product, error) {
+	var product *model.Product
+	err := db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(database.ProductsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrIdNotFound
+		}
+		product = &model.Product{}
+		return json.Unmarshal(data, product)
+	})
+	return product, err
+}
+
+// ListProducts returns the catalog.
+func ListProducts(db *bolt.DB) ([]model.Product, error) {
+	products := []model.Product{}
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		products, err = listProducts(tx)
+		return err
+	})
+	return products, err
+}
+
+// UpdateProduct replaces the product with the ID. Items already ingested keep their match,
+// receipts processed afterwards earn the new bonuses.
+func UpdateProduct(id string, product *model.Product, db *bolt.DB) error {
+	if err := validateProduct(product); err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(database.ProductsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrIdNotFound
+		}
+		var existing model.Product
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return err
+		}
+		product.ID = id
+		product.CreatedAt = existing.CreatedAt
+		product.UpdatedAt = time.Now().UTC()
+		return putProduct(tx, product)
+	})
+}
+
+// DeleteProduct removes the product from the catalog.
+func DeleteProduct(id string, db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(database.ProductsBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrIdNotFound
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+		return touchRuleset(tx)
+	})
+}
+
+func validateProduct(product *model.Product) error {
+	if product.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProduct)
+	}
+	if len(product.Matchers) == 0 {
+		return fmt.Errorf("%w: at least one matcher is required", ErrInvalidProduct)
+	}
+	for _, matcher := range product.Matchers {
+		if strings.TrimSpace(matcher.Value) == "" {
+			return fmt.Errorf("%w: %s matcher needs a value", ErrInvalidProduct, matcher.Type)
+		}
+		switch matcher.Type {
+		case model.MatchSKU, model.MatchExact, model.MatchPrefix:
+		case model.MatchRegex:
+			if _, err := regexp.Compile(matcher.Value); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidProduct, err)
+			}
+		default:
+			return fmt.Errorf("%w: unknown matcher type %q", ErrInvalidProduct, matcher.Type)
+		}
+	}
+	for _, bonus := range product.Bonuses {
+		if bonus.Points <= 0 {
+			return fmt.Errorf("%w: bonus points must be positive", ErrInvalidProduct)
+		}
+		if bonus.MaxUnits < 0 {
+			return fmt.Errorf("%w: maxUnits must not be negative", ErrInvalidProduct)
+		}
+		if bonus.StartsAt != nil && bonus.EndsAt != nil && !bonus.EndsAt.After(*bonus.StartsAt) {
+			return fmt.Errorf("%w: endsAt must be after startsAt", ErrInvalidProduct)
+		}
+	}
+	if product.Bonuses == nil {
+		product.Bonuses = []model.ProductBonus{}
+	}
+	return nil
+}
+
+func listProducts(tx *bolt.Tx) ([]model.Product, error) {
+	products := []model.Product{}
+	err := tx.Bucket(database.ProductsBucket).ForEach(func(k, v []byte) error {
+		var product model.Product
+		if err := json.Unmarshal(v, &product); err != nil {
+			return err
+		}
+		products = append(products, product)
+		return nil
+	})
+	return products, err
+}
+
+// putProduct stores the product, its SKU, exact and prefix matchers must not belong to another product
+func putProduct(tx *bolt.Tx, product *model.Product) error {
+	products, err := listProducts(tx)
+	if err != nil {
+		return err
+	}
+	for _, other := range products {
+		if other.ID == product.ID {
+			continue
+		}
+		for _, matcher := range product.Matchers {
+			for _, existing := range other.Matchers {
+				if matcher.Type != model.MatchRegex && matcher.Type == existing.Type &&
+					matcherValue(matcher) == matcherValue(existing) {
+					return fmt.Errorf("%w: %s %q is a matcher of %s", ErrProductExists, matcher.Type, matcher.Value, other.ID)
+				}
+			}
+		}
+	}
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(database.ProductsBucket).Put([]byte(product.ID), data); err != nil {
+		return err
+	}
+	return touchRuleset(tx)
+}
+
+// normalizeDescription folds case and spacing of item descriptions for the exact and prefix matchers
+func normalizeDescription(description string) string {
+	return strings.Join(strings.Fields(strings.ToLower(description)), " ")
+}
+
+// matcherValue is the value the matcher compares, descriptions are normalized and SKUs are not
+func matcherValue(matcher model.ProductMatcher) string {
+	if matcher.Type == model.MatchSKU {
+		return strings.TrimSpace(matcher.Value)
+	}
+	return normalizeDescription(matcher.Value)
+}
+
+// catalog is the product catalog with its matchers indexed for matching items
+type catalog struct {
+	skus     map[string]*model.Product
+	exact    map[string]*model.Product
+	prefixes []catalogPrefix
+	regexes  []catalogRegex
+}
+
+type catalogPrefix struct {
+	prefix  string
+	product *model.Product
+}
+
+type catalogRegex struct {
+	pattern *regexp.Regexp
+	product *model.Product
+}
+
+// newCatalog indexes the matchers of the products, compiling the regular expressions
+func newCatalog(products []model.Product) (*catalog, error) {
+	index := &catalog{skus: map[string]*model.Product{}, exact: map[string]*model.Product{}}
+	for i := range products {
+		product := &products[i]
+		for _, matcher := range product.Matchers {
+			switch matcher.Type {
+			case model.MatchSKU:
+				index.skus[matcherValue(matcher)] = product
+			case model.MatchExact:
+				index.exact[matcherValue(matcher)] = product
+			case model.MatchPrefix:
+				index.prefixes = append(index.prefixes, catalogPrefix{matcherValue(matcher), product})
+			case model.MatchRegex:
+				pattern, err := regexp.Compile(matcher.Value)
+				if err != nil {
+					return nil, fmt.Errorf("product %s: %w", product.ID, err)
+				}
+				index.regexes = append(index.regexes, catalogRegex{pattern, product})
+			}
+		}
+	}
+	// The longest prefix is the most specific
+	sort.SliceStable(index.prefixes, func(i, j int) bool {
+		return len(index.prefixes[i].prefix) > len(index.prefixes[j].prefix)
+	})
+	return index, nil
+}
+
+// match finds the product of the item, trying the SKU, then the exact description, the longest
+// prefix and the regular expressions in the order of the product IDs. It is nil when none matches.
+func (index *catalog) match(item *model.Item) *model.ProductMatch {
+	found := func(product *model.Product, matcher string) *model.ProductMatch {
+		return &model.ProductMatch{ProductID: product.ID, Name: product.Name, Matcher: matcher}
+	}
+	if product, ok := index.skus[strings.TrimSpace(item.SKU)]; ok && item.SKU != "" {
+		return found(product, model.MatchSKU)
+	}
+	description := normalizeDescription(item.ShortDescription)
+	if product, ok := index.exact[description]; ok {
+		return found(product, model.MatchExact)
+	}
+	for _, prefix := range index.prefixes {
+		if strings.HasPrefix(description, prefix.prefix) {
+			return found(prefix.product, model.MatchPrefix)
+		}
+	}
+	for _, regex := range index.regexes {
+		if regex.pattern.MatchString(strings.TrimSpace(item.ShortDescription)) {
+			return found(regex.product, model.MatchRegex)
+		}
+	}
+	return nil
+}
+
+// matchProducts records the catalog product of every item of the receipt on ingest
+func matchProducts(tx *bolt.Tx, rules *rulesCache, receipt *model.Receipt) error {
+	index, err := rules.loadCatalog(tx)
+	if err != nil {
+		return err
+	}
+	for i := range receipt.Items {
+		receipt.Items[i].Product = index.match(&receipt.Items[i])
+	}
+	return nil
+}
+
+// applyProductBonuses awards the bonuses of the products the items were matched to, for every unit
+// bought up to the bonus's cap. Bonuses with a window only apply to purchases within it.
+func applyProductBonuses(products map[string]model.Product, receipt *model.Receipt, breakdown *model.Breakdown) {
+	units := map[string]int{}
+	var order []string
+	for _, item := range receipt.Items {
+		if item.Product == nil {
+			continue
+		}
+		if _, ok := units[item.Product.ProductID]; !ok {
+			order = append(order, item.Product.ProductID)
+		}
+		units[item.Product.ProductID] += item.Count()
+	}
+
+	purchasedAt, purchaseErr := receipt.PurchasedAt()
+	for _, id := range order {
+		product, ok := products[id]
+		if !ok {
+			continue
+		}
+		for _, bonus := range product.Bonuses {
+			if (bonus.StartsAt != nil || bonus.EndsAt != nil) && purchaseErr != nil ||
+				bonus.StartsAt != nil && purchasedAt.Before(*bonus.StartsAt) ||
+				bonus.EndsAt != nil && !purchasedAt.Before(*bonus.EndsAt) {
+				continue
+			}
+			count := units[id]
+			if bonus.MaxUnits > 0 {
+				count = min(count, bonus.MaxUnits)
+			}
+			breakdown.Rules = append(breakdown.Rules, model.RuleAward{
+				Rule:        model.RuleProductBonus,
+				Description: fmt.Sprintf("%d x %s at %d points", count, product.Name, bonus.Points),
+				Points:      count * bonus.Points,
+				ProductID:   id,
+			})
+			breakdown.Total += count * bonus.Points
+			log.Printf("Points after product %s: %d\n", id, breakdown.Total)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMatchProducts(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	products := []*model.Product{
+		{Name: "Mountain Dew 12 pack", Matchers: []model.ProductMatcher{{Type: model.MatchExact, Value: "Mountain Dew 12PK"}, {Type: model.MatchSKU, Value: "MTD-12"}}},
+		{Name: "Mountain Dew", Matchers: []model.ProductMatcher{{Type: model.MatchPrefix, Value: "mountain dew"}}},
+		{Name: "Mountain Dew Code Red", Matchers: []model.ProductMatcher{{Type: model.MatchPrefix, Value: "Mountain Dew Code"}}},
+		{Name: "Doritos", Matchers: []model.ProductMatcher{{Type: model.MatchRegex, Value: `(?i)^doritos\b`}}},
+	}
+	for _, product := range products {
+		assert.NoError(t, CreateProduct(product, db))
+	}
+
+	tests := []struct {
+		item    model.Item
+		product string
+		matcher string
+	}{
+		{model.Item{ShortDescription: "  MOUNTAIN  dew 12pk "}, products[0].ID, model.MatchExact},
+		{model.Item{ShortDescription: "Soda", SKU: "MTD-12"}, products[0].ID, model.MatchSKU},
+		{model.Item{ShortDescription: "Mountain Dew 2L"}, products[1].ID, model.MatchPrefix},
+		{model.Item{ShortDescription: "Mountain Dew Code Red 2L"}, products[2].ID, model.MatchPrefix},
+		{model.Item{ShortDescription: "Doritos Nacho Cheese"}, products[3].ID, model.MatchRegex},
+		{model.Item{ShortDescription: "Pepsi"}, "", ""},
+	}
+	receipt := &model.Receipt{}
+	for _, test := range tests {
+		receipt.Items = append(receipt.Items, test.item)
+	}
+	assert.NoError(t, db.View(func(tx *bolt.Tx) error {
+		return matchProducts(tx, &rulesCache{}, receipt)
+	}))
+	for i, test := range tests {
+		if test.product == "" {
+			assert.Nil(t, receipt.Items[i].Product, test.item.ShortDescription)
+			continue
+		}
+		if assert.NotNil(t, receipt.Items[i].Product, test.item.ShortDescription) {
+			assert.Equal(t, test.product, receipt.Items[i].Product.ProductID, test.item.ShortDescription)
+			assert.Equal(t, test.matcher, receipt.Items[i].Product.Matcher, test.item.ShortDescription)
+		}
+	}
+}
+
+func TestProductCatalog(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	exact := []model.ProductMatcher{{Type: model.MatchExact, Value: "Mountain Dew 12PK"}}
+	assert.ErrorIs(t, CreateProduct(&model.Product{Name: "No matchers"}, db), ErrInvalidProduct)
+	assert.ErrorIs(t, CreateProduct(&model.Product{Name: "Fuzzy", Matchers: []model.ProductMatcher{{Type: "fuzzy", Value: "dew"}}}, db), ErrInvalidProduct)
+	assert.ErrorIs(t, CreateProduct(&model.Product{Name: "Regex", Matchers: []model.ProductMatcher{{Type: model.MatchRegex, Value: "("}}}, db), ErrInvalidProduct)
+	assert.ErrorIs(t, CreateProduct(&model.Product{Name: "Bonus", Matchers: exact, Bonuses: []model.ProductBonus{{Points: 0}}}, db), ErrInvalidProduct)
+
+	product := &model.Product{Name: "Mountain Dew 12 pack", Matchers: exact}
+	assert.NoError(t, CreateProduct(product, db))
+	assert.Equal(t, []model.ProductBonus{}, product.Bonuses)
+	// Matchers other than regexes belong to one product
+	assert.ErrorIs(t, CreateProduct(&model.Product{Name: "Dew", Matchers: []model.ProductMatcher{{Type: model.MatchExact, Value: "mountain dew 12pk"}}}, db), ErrProductExists)
+
+	update := &model.Product{Name: "Mountain Dew 12 pack", Matchers: exact, Bonuses: []model.ProductBonus{{Points: 50}}}
+	assert.NoError(t, UpdateProduct(product.ID, update, db))
+	assert.ErrorIs(t, UpdateProduct("unknown", update, db), ErrIdNotFound)
+	stored, err := GetProduct(product.ID, db)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ProductBonus{{Points: 50}}, stored.Bonuses)
+
+	assert.NoError(t, DeleteProduct(product.ID, db))
+	assert.ErrorIs(t, DeleteProduct(product.ID, db), ErrIdNotFound)
+	products, err := ListProducts(db)
+	assert.NoError(t, err)
+	assert.Empty(t, products)
+}
+
+func TestApplyProductBonuses(t *testing.T) {
+	june := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	july := june.AddDate(0, 1, 0)
+	dew := model.Product{ID: "dew", Name: "Mountain Dew 12 pack", Bonuses: []model.ProductBonus{{Points: 50, MaxUnits: 3}}}
+	doritos := model.Product{ID: "doritos", Name: "Doritos", Bonuses: []model.ProductBonus{{Points: 20, StartsAt: &june, EndsAt: &july}}}
+	ruleset := &Ruleset{Products: map[string]model.Product{"dew": dew, "doritos": doritos}}
+
+	receipt := func(date string) *model.Receipt {
+		return &model.Receipt{
+			PurchaseDate: date,
+			PurchaseTime: "10:00",
+			Items: []model.Item{
+				{ShortDescription: "Mountain Dew 12PK", Price: "12.98", Quantity: 2, Product: &model.ProductMatch{ProductID: "dew"}},
+				{ShortDescription: "MTN DEW 12PK", Price: "12.98", Quantity: 2, Product: &model.ProductMatch{ProductID: "dew"}},
+				{ShortDescription: "Doritos", Price: "3.35", Product: &model.ProductMatch{ProductID: "doritos"}},
+				{ShortDescription: "Unknown", Price: "1.00", Product: &model.ProductMatch{ProductID: "deleted"}},
+			},
+			Total: "30.31",
+		}
+	}
+
+	// 4 units of Mountain Dew capped at 3 and Doritos within their window
+	awards := func(breakdown model.Breakdown) map[string]int {
+		points := map[string]int{}
+		for _, award := range breakdown.Rules {
+			if award.Rule == model.RuleProductBonus {
+				points[award.ProductID] += award.Points
+			}
+		}
+		return points
+	}
+	assert.Equal(t, map[string]int{"dew": 150, "doritos": 20}, awards(CalculateBreakdown(receipt("2024-06-15"), ruleset)))
+	assert.Equal(t, map[string]int{"dew": 150}, awards(CalculateBreakdown(receipt("2024-07-01"), ruleset)))
+	assert.Equal(t, map[string]int{}, awards(CalculateBreakdown(receipt("2024-06-15"), nil)))
+}
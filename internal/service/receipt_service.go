@@ -1,7 +1,9 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"math"
 	"strconv"
@@ -9,91 +11,109 @@ import (
 	"time"
 	"unicode"
 
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
 	model "github.com/VineethKanaparthi/receipt-processor/pkg"
-	"github.com/google/uuid"
 	bolt "go.etcd.io/bbolt"
 )
 
 // ErrIdNotFound is an error indicating that the ID was not found in the database.
 var ErrIdNotFound = errors.New("id not found")
 
-// ProcessReceipt processes a receipt, calculates points, and stores the points in the database.
-func ProcessReceipt(receipt *model.Receipt, db *bolt.DB) (string, error) {
-	log.Printf("%+v\n", receipt)
-	points := CalculatePoints(receipt)
-	log.Println(points)
-	id := uuid.New().String()
-	err := db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte("points"))
-		return bucket.Put([]byte(id), []byte(strconv.Itoa(points)))
-	})
-	if err != nil {
-		return id, err
-	}
-	return id, nil
+// ErrNotProcessed is an error indicating that the receipt has been accepted but not processed yet.
+var ErrNotProcessed = errors.New("receipt has not been processed yet")
+
+// Submitter identifies who submitted a receipt and which loyalty account it is credited to.
+type Submitter struct {
+	ClientID  string
+	AccountID string
+}
+
+// Policy configures the checks applied while processing receipts.
+type Policy struct {
+	Limits Limits
+	Caps   Caps
+	// HoldThreshold is the risk score at which a receipt is held instead of credited, zero disables holding
+	HoldThreshold int
+	// Tiers are the membership tiers, lowest first, whose multipliers apply to the receipts of
+	// accounts, none disables tiers
+	Tiers []model.Tier
+	// ExpiryMonths is how many months after they were earned unspent points expire, zero keeps them forever
+	ExpiryMonths int
 }
 
-// Calculate points for a receipt based on the defined rules
-func CalculatePoints(receipt *model.Receipt) int {
-	points := 0
+// Calculate points for a receipt based on the defined rules and the ruleset, a nil ruleset applies the base rules only
+func CalculatePoints(receipt *model.Receipt, ruleset *Ruleset) int {
+	return CalculateBreakdown(receipt, ruleset).Total
+}
+
+// CalculateBreakdown applies the rules to a receipt and records the points each of them awarded
+func CalculateBreakdown(receipt *model.Receipt, ruleset *Ruleset) model.Breakdown {
+	breakdown := model.Breakdown{Rules: []model.RuleAward{}}
 
-	// Rule 1: One point for every alphanumeric character in the retailer name
-	points += countAlphanumericCharacters(receipt.Retailer)
-	log.Printf("Points after Rule 1: %d\n", points)
+	// Rule 1: One point for every alphanumeric character in the retailer name, the canonical
+	// name when the retailer is in the registry so every spelling of it scores the same
+	breakdown.Add(model.RuleRetailerName, "one point for every alphanumeric character in the retailer name",
+		countAlphanumericCharacters(receipt.RetailerName()))
+	log.Printf("Points after Rule 1: %d\n", breakdown.Total)
 
 	// Rule 2: 50 points if the total is a round dollar amount with no cents
 	// Rule 3: 25 points if the total is a multiple of 0.25
 	total, err := strconv.ParseFloat(receipt.Total, 64)
 	if err == nil {
 		if total == math.Floor(total) {
-			points += 50 // 50 points if the total is a round dollar amount
+			breakdown.Add(model.RuleRoundTotal, "total is a round dollar amount with no cents", 50)
 		}
 		if math.Mod(total, 0.25) == 0 {
-			points += 25 // 25 points if the total is a multiple of 0.25
+			breakdown.Add(model.RuleQuarterTotal, "total is a multiple of 0.25", 25)
 		}
 	}
-	log.Printf("Points after Rule 2 & 3: %d\n", points)
+	log.Printf("Points after Rule 2 & 3: %d\n", breakdown.Total)
 
-	// Rule 4: 5 points for every two items on the receipt
-	points += 5 * (len(receipt.Items) / 2)
-	log.Printf("len of items: %d\n", len(receipt.Items))
-	log.Printf("Points after Rule 4: %d\n", points)
+	// Rule 4: 5 points for every two items on the receipt, counting quantities
+	breakdown.Add(model.RuleItemPairs, "5 points for every two items", 5*(receipt.ItemCount()/2))
+	log.Printf("count of items: %d\n", receipt.ItemCount())
+	log.Printf("Points after Rule 4: %d\n", breakdown.Total)
 
 	// Rule 5: If the trimmed length of the item description is a multiple of 3, multiply the price by 0.2
 	// and round up to the nearest integer. The result is the number of points earned.
 	for _, item := range receipt.Items {
-		trimmedLength := len(strings.Trim(item.ShortDescription, " "))
-		log.Printf("item trimmed: %s, length: %d\n", strings.Trim(item.ShortDescription, " "), trimmedLength)
-		if trimmedLength%3 == 0 {
+		trimmed := strings.Trim(item.ShortDescription, " ")
+		log.Printf("item trimmed: %s, length: %d\n", trimmed, len(trimmed))
+		if len(trimmed)%3 == 0 {
 			priceFloat, _ := strconv.ParseFloat(item.Price, 64)
-			points += int(math.Ceil(priceFloat * 0.2))
+			breakdown.Add(model.RuleItemDescription, fmt.Sprintf("description of %q is a multiple of 3 long", trimmed),
+				int(math.Ceil(priceFloat*0.2)))
 		}
 	}
-	log.Printf("Points after Rule 5: %d\n", points)
+	log.Printf("Points after Rule 5: %d\n", breakdown.Total)
+
+	// Rules 6 and 7 use the clock of the store, a receipt printed in another offset is converted to its time zone
+	local, _ := receipt.LocalPurchaseTime()
 
 	// Rule 6: 6 points if the day in the purchase date is odd
 	if receipt.PurchaseDate != "" {
-		purchaseDate, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
-		purchaseDay := purchaseDate.Day()
+		purchaseDay := local.Day()
 		log.Println(purchaseDay)
 		if purchaseDay%2 != 0 {
-			points += 6
+			breakdown.Add(model.RuleOddDay, "day in the purchase date is odd", 6)
 		}
 	}
-	log.Printf("Points after Rule 6: %d\n", points)
+	log.Printf("Points after Rule 6: %d\n", breakdown.Total)
 
 	// Rule 7: 10 points if the time of purchase is after 2:00pm and before 4:00pm
 	if receipt.PurchaseTime != "" {
-		purchaseTime, _ := time.Parse("15:04", receipt.PurchaseTime)
+		purchaseTime := time.Date(0, 1, 1, local.Hour(), local.Minute(), 0, 0, time.UTC)
 		log.Printf("%+v\n", purchaseTime)
 		if purchaseTime.After(time.Date(0, 1, 1, 14, 0, 0, 0, time.UTC)) &&
 			purchaseTime.Before(time.Date(0, 1, 1, 16, 0, 0, 0, time.UTC)) {
-			points += 10
+			breakdown.Add(model.RuleAfternoon, "time of purchase is after 2:00pm and before 4:00pm", 10)
 		}
 	}
-	log.Printf("Points after Rule 7: %d\n", points)
+	log.Printf("Points after Rule 7: %d\n", breakdown.Total)
 
-	return points
+	ruleset.apply(receipt, &breakdown)
+
+	return breakdown
 }
 
 // countAlphanumericCharacters counts the number of alphanumeric characters in a string.
@@ -107,19 +127,48 @@ func countAlphanumericCharacters(s string) int {
 	return count
 }
 
-// GetPoints retrieves points from the database based on the provided ID.
+// GetPoints retrieves the points credited for the receipt with the provided ID, held and rejected
+// receipts have none. It fails with ErrNotProcessed while the receipt waits for a worker.
 func GetPoints(id string, db *bolt.DB) (int, error) {
-	var points int
+	record, err := GetReceipt(id, db)
+	if err != nil {
+		return 0, err
+	}
+	if !record.Processed() {
+		return 0, ErrNotProcessed
+	}
+	return record.CreditedPoints(), nil
+}
+
+// GetReceipt retrieves the stored receipt record for the provided ID.
+func GetReceipt(id string, db *bolt.DB) (*model.ReceiptRecord, error) {
+	var record *model.ReceiptRecord
 	err := db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte("points"))
-		data := bucket.Get([]byte(id))
-		if data == nil {
-			return ErrIdNotFound
-		}
-		var converr error
-		points, converr = strconv.Atoi(string(data))
-		return converr
+		var err error
+		record, err = getRecord(tx, id)
+		return err
 	})
+	return record, err
+}
 
-	return points, err
+// getRecord decodes the receipt record stored under id.
+func getRecord(tx *bolt.Tx, id string) (*model.ReceiptRecord, error) {
+	data := tx.Bucket(database.ReceiptsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrIdNotFound
+	}
+	var record model.ReceiptRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// putRecord encodes and stores the receipt record under its ID.
+func putRecord(tx *bolt.Tx, record *model.ReceiptRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(database.ReceiptsBucket).Put([]byte(record.ID), data)
 }
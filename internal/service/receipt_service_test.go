@@ -371,10 +371,35 @@ func TestCalculatePoints(t *testing.T) {
 			},
 			28,
 		},
+		{
+			// Quantities count towards the item pairs, the total includes the discount, tax and tip
+			model.Receipt{
+				Retailer:     "Target",
+				PurchaseDate: "2022-01-01",
+				PurchaseTime: "13:01",
+				Items: []model.Item{
+					{
+						ShortDescription: "Mountain Dew 12PK",
+						Price:            "19.47",
+						Quantity:         3,
+						UnitPrice:        "6.49",
+					}, {
+						ShortDescription: "Emils Cheese Pizza",
+						Price:            "12.25",
+					},
+				},
+				Subtotal:  "30.00",
+				Discounts: []model.Adjustment{{Description: "Coupon", Amount: "1.72"}},
+				Taxes:     []model.Adjustment{{Description: "Sales tax", Amount: "2.40"}},
+				Tip:       "0.60",
+				Total:     "33.00",
+			},
+			100,
+		},
 	}
 	for _, test := range tests {
 		t.Run("CalculatePoints", func(t *testing.T) {
-			points := CalculatePoints(&test.receipt)
+			points := CalculatePoints(&test.receipt, nil)
 
 			// Add assertions based on the expected points for this receipt
 			assert.Equal(t, test.points, points)
@@ -382,3 +407,35 @@ func TestCalculatePoints(t *testing.T) {
 	}
 
 }
+
+func TestCalculatePointsTimeZones(t *testing.T) {
+	// One item worth 25 points, plus 6 on an odd day and 10 in the afternoon on the store's clock
+	tests := []struct {
+		name           string
+		date, time     string
+		purchaseOffset string
+		timeZone       string
+		points         int
+	}{
+		{"no time zone", "2022-01-01", "14:30", "", "", 41},
+		{"store clock", "2022-01-01", "14:30", "", "Asia/Kolkata", 41},
+		{"utc converted to the afternoon", "2022-01-02", "20:30", "+00:00", "America/Chicago", 35},
+		{"utc converted to the previous day", "2022-01-03", "01:30", "+00:00", "America/Los_Angeles", 25},
+		{"offset without a time zone", "2022-01-01", "14:30", "-05:00", "", 41},
+		{"after clocks moved forward", "2024-03-10", "18:30", "+00:00", "America/New_York", 35},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receipt := model.Receipt{
+				PurchaseDate:   test.date,
+				PurchaseTime:   test.time,
+				PurchaseOffset: test.purchaseOffset,
+				TimeZone:       test.timeZone,
+				Items:          []model.Item{{ShortDescription: "Pepsi", Price: "1.25"}},
+				Total:          "1.25",
+			}
+			assert.NoError(t, receipt.Validate())
+			assert.Equal(t, test.points, CalculatePoints(&receipt, nil))
+		})
+	}
+}
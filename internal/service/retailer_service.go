@@ -0,0 +1,299 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidRetailer is an error indicating that a retailer has an invalid ID or name.
+var ErrInvalidRetailer = errors.New("invalid retailer")
+
+// ErrRetailerExists is an error indicating that a retailer ID, name or alias belongs to another retailer.
+var ErrRetailerExists = errors.New("retailer already exists")
+
+// retailerIDPattern is the slug form of retailer IDs
+var retailerIDPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// retailerAbbreviations expands the abbreviations printed on receipts, words mapped to "" are dropped
+var retailerAbbreviations = map[string]string{
+	"mkt":  "market",
+	"mkts": "markets",
+	"mrkt": "market",
+	"co":   "company",
+	"corp": "corporation",
+	"intl": "international",
+	"ctr":  "center",
+	"and":  "",
+	"the":  "",
+	"inc":  "",
+	"llc":  "",
+	"ltd":  "",
+}
+
+// minFuzzyLength is the shortest normalized name matched fuzzily, shorter names must match exactly
+const minFuzzyLength = 6
+
+// NormalizeRetailerName reduces a retailer name to the key the registry matches on: lower case
+// letters and digits only, with common abbreviations expanded, so "M & M CORNER MKT" and
+// "M&M Corner Market" have the same key.
+func NormalizeRetailerName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var key strings.Builder
+	for _, word := range words {
+		if expanded, ok := retailerAbbreviations[word]; ok {
+			word = expanded
+		}
+		key.WriteString(word)
+	}
+	return key.String()
+}
+
+// RetailerID derives the ID of a retailer from its name, like mm-corner-market
+func RetailerID(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	return strings.Join(words, "-")
+}
+
+// CreateRetailer adds a retailer to the registry, its ID is derived from the name when empty.
+func CreateRetailer(retailer *model.Retailer, db *bolt.DB) error {
+	if retailer.ID == "" {
+		retailer.ID = RetailerID(retailer.Name)
+	}
+	if err := validateRetailer(retailer); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	retailer.CreatedAt = now
+	retailer.UpdatedAt = now
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(database.RetailersBucket).Get([]byte(retailer.ID)) != nil {
+			return fmt.Errorf("%w: %s", ErrRetailerExists, retailer.ID)
+		}
+		return putRetailer(tx, retailer)
+	})
+}
+
+// GetRetailer returns the retailer with the ID.
+func GetRetailer(id string, db *bolt.DB) (*model.Retailer, error) {
+	var retailer *model.Retailer
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		retailer, err = getRetailer(tx, id)
+		return err
+	})
+	return retailer, err
+}
+
+// ListRetailers returns the registry ordered by ID.
+func ListRetailers(db *bolt.DB) ([]model.Retailer, error) {
+	retailers := []model.Retailer{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.RetailersBucket).ForEach(func(k, v []byte) error {
+			var retailer model.Retailer
+			if err := json.Unmarshal(v, &retailer); err != nil {
+				return err
+			}
+			retailers = append(retailers, retailer)
+			return nil
+		})
+	})
+	return retailers, err
+}
+
+// UpdateRetailer replaces the name and aliases of the retailer. Receipts already
+// ingested keep the canonical name they were matched to.
+func UpdateRetailer(id, name string, aliases []string, db *bolt.DB) (*model.Retailer, error) {
+	var retailer *model.Retailer
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		retailer, err = getRetailer(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := deleteRetailerNames(tx, retailer); err != nil {
+			return err
+		}
+		retailer.Name = name
+		retailer.Aliases = aliases
+		retailer.UpdatedAt = time.Now().UTC()
+		if err := validateRetailer(retailer); err != nil {
+			return err
+		}
+		return putRetailer(tx, retailer)
+	})
+	return retailer, err
+}
+
+// DeleteRetailer removes the retailer from the registry.
+func DeleteRetailer(id string, db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		retailer, err := getRetailer(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := deleteRetailerNames(tx, retailer); err != nil {
+			return err
+		}
+		return tx.Bucket(database.RetailersBucket).Delete([]byte(id))
+	})
+}
+
+// MatchRetailer finds the retailer of the registry a receipt's retailer name refers to, nil when there is none.
+func MatchRetailer(name string, db *bolt.DB) (*model.RetailerMatch, error) {
+	var match *model.RetailerMatch
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		match, err = matchRetailer(tx, name)
+		return err
+	})
+	return match, err
+}
+
+// matchRetailer looks the normalized name up among the names and aliases of the registry,
+// then falls back to the closest of them within an edit distance of a fifth of its length.
+func matchRetailer(tx *bolt.Tx, name string) (*model.RetailerMatch, error) {
+	key := NormalizeRetailerName(name)
+	if key == "" {
+		return nil, nil
+	}
+	names := tx.Bucket(database.RetailerNamesBucket)
+	if id := names.Get([]byte(key)); id != nil {
+		retailer, err := getRetailer(tx, string(id))
+		if err != nil {
+			return nil, err
+		}
+		match := model.RetailerMatchAlias
+		if NormalizeRetailerName(retailer.Name) == key {
+			match = model.RetailerMatchName
+		}
+		return &model.RetailerMatch{RetailerID: retailer.ID, Name: retailer.Name, Match: match}, nil
+	}
+	if len(key) < minFuzzyLength {
+		return nil, nil
+	}
+
+	var closest []byte
+	best := len(key)/5 + 1
+	err := names.ForEach(func(k, v []byte) error {
+		if distance := editDistance(key, string(k)); distance < best {
+			best = distance
+			closest = v
+		}
+		return nil
+	})
+	if err != nil || closest == nil {
+		return nil, err
+	}
+	retailer, err := getRetailer(tx, string(closest))
+	if err != nil {
+		return nil, err
+	}
+	return &model.RetailerMatch{RetailerID: retailer.ID, Name: retailer.Name, Match: model.RetailerMatchFuzzy}, nil
+}
+
+// canonicalizeRetailer records the registry retailer of the receipt on ingest
+func canonicalizeRetailer(tx *bolt.Tx, receipt *model.Receipt) error {
+	match, err := matchRetailer(tx, receipt.Retailer)
+	if err != nil {
+		return err
+	}
+	receipt.CanonicalRetailer = match
+	return nil
+}
+
+func validateRetailer(retailer *model.Retailer) error {
+	if !retailerIDPattern.MatchString(retailer.ID) {
+		return fmt.Errorf("%w: id must be lower case letters and digits separated by dashes", ErrInvalidRetailer)
+	}
+	if NormalizeRetailerName(retailer.Name) == "" {
+		return fmt.Errorf("%w: name must have letters or digits", ErrInvalidRetailer)
+	}
+	for _, alias := range retailer.Aliases {
+		if NormalizeRetailerName(alias) == "" {
+			return fmt.Errorf("%w: alias %q must have letters or digits", ErrInvalidRetailer, alias)
+		}
+	}
+	if retailer.Aliases == nil {
+		retailer.Aliases = []string{}
+	}
+	return nil
+}
+
+func getRetailer(tx *bolt.Tx, id string) (*model.Retailer, error) {
+	data := tx.Bucket(database.RetailersBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrIdNotFound
+	}
+	var retailer model.Retailer
+	if err := json.Unmarshal(data, &retailer); err != nil {
+		return nil, err
+	}
+	return &retailer, nil
+}
+
+// putRetailer stores the retailer and indexes its name and aliases, which must not belong to another retailer
+func putRetailer(tx *bolt.Tx, retailer *model.Retailer) error {
+	names := tx.Bucket(database.RetailerNamesBucket)
+	for _, name := range append([]string{retailer.Name}, retailer.Aliases...) {
+		key := []byte(NormalizeRetailerName(name))
+		if id := names.Get(key); id != nil && string(id) != retailer.ID {
+			return fmt.Errorf("%w: %q is a name of %s", ErrRetailerExists, name, id)
+		}
+		if err := names.Put(key, []byte(retailer.ID)); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(retailer)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(database.RetailersBucket).Put([]byte(retailer.ID), data)
+}
+
+func deleteRetailerNames(tx *bolt.Tx, retailer *model.Retailer) error {
+	names := tx.Bucket(database.RetailerNamesBucket)
+	for _, name := range append([]string{retailer.Name}, retailer.Aliases...) {
+		key := []byte(NormalizeRetailerName(name))
+		if string(names.Get(key)) != retailer.ID {
+			continue
+		}
+		if err := names.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
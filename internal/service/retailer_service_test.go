@@ -0,0 +1,123 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeRetailerName(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"M&M Corner Market", "mmcornermarket"},
+		{"M & M CORNER MKT", "mmcornermarket"},
+		{"  The Home Depot, Inc. ", "homedepot"},
+		{"Café Zürich", "cafézürich"},
+		{"&&", ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.key, NormalizeRetailerName(test.name), test.name)
+	}
+	assert.Equal(t, "m-m-corner-market", RetailerID("M&M Corner Market"))
+}
+
+func TestMatchRetailer(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	assert.NoError(t, CreateRetailer(&model.Retailer{ID: "mm-corner-market", Name: "M&M Corner Market", Aliases: []string{"MM Corner"}}, db))
+	assert.NoError(t, CreateRetailer(&model.Retailer{Name: "Target"}, db))
+
+	tests := []struct {
+		name     string
+		retailer string
+		match    string
+	}{
+		{"M & M CORNER MKT", "mm-corner-market", model.RetailerMatchName},
+		{"mm corner", "mm-corner-market", model.RetailerMatchAlias},
+		{"M&M Cornr Markt", "mm-corner-market", model.RetailerMatchFuzzy},
+		{"TARGET", "target", model.RetailerMatchName},
+		// Short names must match exactly
+		{"Targt", "", ""},
+		{"Walgreens", "", ""},
+	}
+	for _, test := range tests {
+		match, err := MatchRetailer(test.name, db)
+		assert.NoError(t, err)
+		if test.retailer == "" {
+			assert.Nil(t, match, test.name)
+			continue
+		}
+		if assert.NotNil(t, match, test.name) {
+			assert.Equal(t, test.retailer, match.RetailerID, test.name)
+			assert.Equal(t, test.match, match.Match, test.name)
+		}
+	}
+}
+
+func TestRetailerRegistry(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	assert.ErrorIs(t, CreateRetailer(&model.Retailer{ID: "Not A Slug", Name: "Target"}, db), ErrInvalidRetailer)
+	assert.ErrorIs(t, CreateRetailer(&model.Retailer{Name: "&"}, db), ErrInvalidRetailer)
+
+	target := &model.Retailer{Name: "Target", Aliases: []string{"Target Store"}}
+	assert.NoError(t, CreateRetailer(target, db))
+	assert.Equal(t, "target", target.ID)
+	assert.ErrorIs(t, CreateRetailer(&model.Retailer{Name: "Target"}, db), ErrRetailerExists)
+	// Names and aliases belong to one retailer
+	assert.ErrorIs(t, CreateRetailer(&model.Retailer{ID: "target-2", Name: "TARGET STORE"}, db), ErrRetailerExists)
+
+	// Replaced aliases no longer match
+	updated, err := UpdateRetailer("target", "Target", []string{"Tgt"}, db)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Tgt"}, updated.Aliases)
+	match, err := MatchRetailer("Target Store", db)
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+	match, err = MatchRetailer("TGT", db)
+	assert.NoError(t, err)
+	assert.Equal(t, "target", match.RetailerID)
+
+	retailers, err := ListRetailers(db)
+	assert.NoError(t, err)
+	assert.Len(t, retailers, 1)
+
+	assert.NoError(t, DeleteRetailer("target", db))
+	assert.ErrorIs(t, DeleteRetailer("target", db), ErrIdNotFound)
+	_, err = GetRetailer("target", db)
+	assert.ErrorIs(t, err, ErrIdNotFound)
+	match, err = MatchRetailer("Target", db)
+	assert.NoError(t, err)
+	assert.Nil(t, match)
+}
+
+func TestCanonicalRetailerPoints(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	assert.NoError(t, CreateRetailer(&model.Retailer{Name: "M&M Corner Market"}, db))
+
+	processor := NewProcessor(db, Policy{}, 1)
+	var points []int
+	for _, name := range []string{"M&M Corner Market", "M & M CORNER MKT"} {
+		receipt := &model.Receipt{Retailer: name, PurchaseDate: "2022-01-02", PurchaseTime: "10:00", Items: []model.Item{{ShortDescription: "Pepsi", Price: "1.25"}}, Total: "1.25"}
+		id, err := processor.Submit(receipt, Submitter{})
+		assert.NoError(t, err)
+		_, err = processor.ProcessPending()
+		assert.NoError(t, err)
+
+		record, err := GetReceipt(id, db)
+		assert.NoError(t, err)
+		assert.Equal(t, name, record.Receipt.Retailer)
+		assert.Equal(t, "M&M Corner Market", record.Receipt.CanonicalRetailer.Name)
+		points = append(points, record.Points)
+	}
+	// 14 for the canonical name and 25 for the total
+	assert.Equal(t, []int{39, 39}, points)
+}
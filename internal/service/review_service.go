@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotPendingReview is an error indicating that the receipt is not waiting for a review.
+var ErrNotPendingReview = errors.New("receipt is not pending review")
+
+// ErrNotScored is an error indicating that the receipt has no credited points to reverse.
+var ErrNotScored = errors.New("receipt is not scored")
+
+// ListPendingReviews returns the receipts waiting for a review, oldest first.
+func ListPendingReviews(db *bolt.DB) ([]model.ReceiptRecord, error) {
+	records := []model.ReceiptRecord{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.ReviewQueueBucket).ForEach(func(k, v []byte) error {
+			record, err := getRecord(tx, string(v))
+			if err != nil {
+				return err
+			}
+			records = append(records, *record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// ReviewReceipt records the reviewer's decision on a pending receipt. Approved receipts are
+// credited their points up to what is left of the account's daily cap, rejected receipts are voided.
+func ReviewReceipt(id string, approve bool, reviewer, notes string, caps Caps, db *bolt.DB) (*model.ReceiptRecord, error) {
+	var record *model.ReceiptRecord
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		record, err = getRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		if record.Status != model.StatusPendingReview {
+			return ErrNotPendingReview
+		}
+
+		review := &model.Review{
+			Decision:   model.DecisionRejected,
+			Reviewer:   reviewer,
+			Notes:      notes,
+			ReviewedAt: time.Now().UTC(),
+		}
+		record.Status = model.StatusRejected
+		record.Review = review
+		event, points := model.EventReceiptRejected, 0
+		if approve {
+			review.Decision = model.DecisionApproved
+			record.Status = model.StatusScored
+			// The daily cap is checked again, receipts approved since it was held count against it
+			if record.Breakdown == nil {
+				record.Breakdown = &model.Breakdown{Rules: []model.RuleAward{}, Total: record.Points}
+			}
+			if err := capTotal(tx, record.AccountID, caps, record.Breakdown, review.ReviewedAt); err != nil {
+				return err
+			}
+			record.Points = record.Breakdown.Total
+			if err := creditAccount(tx, record, review.ReviewedAt); err != nil {
+				return err
+			}
+			event, points = model.EventReceiptScored, record.Points
+		}
+		if err := emitEvent(tx, event, record, points, review.ReviewedAt); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(database.ReviewQueueBucket).Delete(database.ReviewQueueKey(record.CreatedAt, record.ID)); err != nil {
+			return err
+		}
+		return putRecord(tx, record)
+	})
+	return record, err
+}
+
+// ReverseReceipt takes back the points credited for a scored receipt, for example after
+// fraud is discovered later. The account's ledger is debited with the receipt's unspent points
+// and the receipt is marked reversed.
+func ReverseReceipt(id, reviewer, notes string, db *bolt.DB) (*model.ReceiptRecord, error) {
+	var record *model.ReceiptRecord
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		record, err = getRecord(tx, id)
+		if err != nil {
+			return err
+		}
+		if record.Status != model.StatusScored {
+			return ErrNotScored
+		}
+
+		now := time.Now().UTC()
+		record.Status = model.StatusReversed
+		record.Reversal = &model.Review{
+			Decision:   model.DecisionReversed,
+			Reviewer:   reviewer,
+			Notes:      notes,
+			ReviewedAt: now,
+		}
+		reversed := record.Points
+		if record.AccountID != "" && record.Points != 0 {
+			// Points of the receipt that expired or were redeemed are gone already, only the rest is debited
+			reversed, err = unspentPoints(tx, record.AccountID, record.ID)
+			if err != nil {
+				return err
+			}
+			err := appendLedgerEntry(tx, record.AccountID, &model.LedgerEntry{
+				Type:      model.LedgerReversal,
+				ReceiptID: record.ID,
+				Points:    -reversed,
+				CreatedAt: now,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := emitEvent(tx, model.EventPointsReversed, record, -reversed, now); err != nil {
+			return err
+		}
+		return putRecord(tx, record)
+	})
+	return record, err
+}
+
+// enqueueReview adds a pending receipt to the review queue
+func enqueueReview(tx *bolt.Tx, record *model.ReceiptRecord) error {
+	return tx.Bucket(database.ReviewQueueBucket).Put(database.ReviewQueueKey(record.CreatedAt, record.ID), []byte(record.ID))
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// rulesetVersionKey in the meta bucket changes with every write to the campaigns, products and custom rules
+var rulesetVersionKey = []byte("rulesetVersion")
+
+// Ruleset is the configurable part of the points rules, applied after the base rules.
+// It is compiled once from the database and reused until the rules change.
+type Ruleset struct {
+	Campaigns []model.Campaign
+	// Products are the catalog by ID, items are matched to them on ingest
+	Products map[string]model.Product
+	// Rules are the compiled custom rules
+	Rules []CompiledRule
+}
+
+// rulesCache keeps the ruleset and the product catalog of one database compiled until the rules
+// change, each compiled when it is first needed.
+type rulesCache struct {
+	mu      sync.Mutex
+	version string
+	ruleset *Ruleset
+	catalog *catalog
+}
+
+// LoadRuleset reads the configured rules from the database.
+func LoadRuleset(db *bolt.DB) (*Ruleset, error) {
+	var ruleset *Ruleset
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		ruleset, err = (&rulesCache{}).loadRuleset(tx)
+		return err
+	})
+	return ruleset, err
+}
+
+// loadRuleset returns the ruleset of the transaction's version, compiling it when the rules changed
+// since it was last compiled. A stored rule that no longer compiles fails the load.
+func (cache *rulesCache) loadRuleset(tx *bolt.Tx) (*Ruleset, error) {
+	if ruleset, _ := cache.current(tx); ruleset != nil {
+		return ruleset, nil
+	}
+
+	ruleset := &Ruleset{Products: map[string]model.Product{}}
+	var err error
+	ruleset.Campaigns, err = listCampaigns(tx)
+	if err != nil {
+		return nil, err
+	}
+	products, err := listProducts(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		ruleset.Products[product.ID] = product
+	}
+	if ruleset.Rules, err = loadCustomRules(tx); err != nil {
+		return nil, err
+	}
+	cache.store(tx, func(cache *rulesCache) { cache.ruleset = ruleset })
+	return ruleset, nil
+}
+
+// loadCatalog returns the product catalog of the transaction's version, indexing it when the rules
+// changed since it was last indexed.
+func (cache *rulesCache) loadCatalog(tx *bolt.Tx) (*catalog, error) {
+	if _, index := cache.current(tx); index != nil {
+		return index, nil
+	}
+
+	products, err := listProducts(tx)
+	if err != nil {
+		return nil, err
+	}
+	index, err := newCatalog(products)
+	if err != nil {
+		return nil, err
+	}
+	cache.store(tx, func(cache *rulesCache) { cache.catalog = index })
+	return index, nil
+}
+
+// current returns what the cache compiled from the transaction's version, nil when the rules changed
+func (cache *rulesCache) current(tx *bolt.Tx) (*Ruleset, *catalog) {
+	version := rulesetVersion(tx)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.version != version {
+		return nil, nil
+	}
+	return cache.ruleset, cache.catalog
+}
+
+// store records what was compiled from the transaction's version, dropping what was compiled from another
+func (cache *rulesCache) store(tx *bolt.Tx, set func(cache *rulesCache)) {
+	version := rulesetVersion(tx)
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.version != version {
+		cache.version, cache.ruleset, cache.catalog = version, nil, nil
+	}
+	set(cache)
+}
+
+func rulesetVersion(tx *bolt.Tx) string {
+	bucket := tx.Bucket(database.MetaBucket)
+	if bucket == nil {
+		return ""
+	}
+	return string(bucket.Get(rulesetVersionKey))
+}
+
+// touchRuleset gives the rules a new version so they are compiled again. The version is unique, a
+// rolled back write never shares it with a later one.
+func touchRuleset(tx *bolt.Tx) error {
+	bucket, err := tx.CreateBucketIfNotExists(database.MetaBucket)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(rulesetVersionKey, []byte(uuid.New().String()))
+}
+
+// apply awards the configured rules on top of the base rules in the breakdown, a nil ruleset awards nothing
+func (ruleset *Ruleset) apply(receipt *model.Receipt, breakdown *model.Breakdown) {
+	if ruleset == nil {
+		return
+	}
+	// Campaign multipliers apply to the base rules, not to sponsored product bonuses
+	applyCampaigns(ruleset.Campaigns, receipt, breakdown)
+	applyProductBonuses(ruleset.Products, receipt, breakdown)
+	applyCustomRules(ruleset.Rules, receipt, breakdown)
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidTiers is an error indicating that a tier configuration cannot be used.
+var ErrInvalidTiers = errors.New("invalid tiers")
+
+// ExampleTiers are a starting point for configuring tiers, in the format of ParseTiers
+const ExampleTiers = "Bronze:0:1,Silver:1000:1.25,Gold:5000:1.5"
+
+// ParseTiers reads tiers written as name:minPoints:multiplier separated by commas,
+// like "Bronze:0:1,Silver:1000:1.25,Gold:5000:1.5", lowest tier first.
+func ParseTiers(spec string) ([]model.Tier, error) {
+	var tiers []model.Tier
+	for _, field := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%w: %q is not name:minPoints:multiplier", ErrInvalidTiers, field)
+		}
+		minPoints, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q has no whole number of points", ErrInvalidTiers, field)
+		}
+		multiplier, err := strconv.ParseFloat(parts[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q has no multiplier", ErrInvalidTiers, field)
+		}
+		tiers = append(tiers, model.Tier{Name: parts[0], MinPoints: minPoints, Multiplier: multiplier})
+	}
+	return tiers, ValidateTiers(tiers)
+}
+
+// ValidateTiers checks that the tiers are ordered by their points, starting at zero so every account has one.
+func ValidateTiers(tiers []model.Tier) error {
+	names := map[string]bool{}
+	for i, tier := range tiers {
+		if tier.Name == "" || names[tier.Name] {
+			return fmt.Errorf("%w: tier names must be unique and not empty", ErrInvalidTiers)
+		}
+		names[tier.Name] = true
+		if i == 0 && tier.MinPoints != 0 {
+			return fmt.Errorf("%w: the lowest tier must start at 0 points", ErrInvalidTiers)
+		}
+		if i > 0 && tier.MinPoints <= tiers[i-1].MinPoints {
+			return fmt.Errorf("%w: %s must need more points than %s", ErrInvalidTiers, tier.Name, tiers[i-1].Name)
+		}
+		if tier.Multiplier < 1 {
+			return fmt.Errorf("%w: the multiplier of %s must be at least 1", ErrInvalidTiers, tier.Name)
+		}
+	}
+	return nil
+}
+
+// GetAccountTier returns the membership status and tier history of the account, nil for accounts
+// that never earned points while tiers were enabled.
+func GetAccountTier(account string, db *bolt.DB) (*model.AccountTier, error) {
+	var status *model.AccountTier
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		status, err = getAccountTier(tx, account)
+		return err
+	})
+	return status, err
+}
+
+func getAccountTier(tx *bolt.Tx, account string) (*model.AccountTier, error) {
+	data := tx.Bucket(database.AccountTiersBucket).Get([]byte(account))
+	if data == nil {
+		return nil, nil
+	}
+	var status model.AccountTier
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// tierFor returns the highest tier the points reach
+func tierFor(tiers []model.Tier, points int) model.Tier {
+	tier := tiers[0]
+	for _, next := range tiers[1:] {
+		if points >= next.MinPoints {
+			tier = next
+		}
+	}
+	return tier
+}
+
+// tierIndex returns the position of the named tier, -1 when it is no longer configured
+func tierIndex(tiers []model.Tier, name string) int {
+	for i, tier := range tiers {
+		if tier.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// trailingPoints sums the points the account earned in the 12 months before now, leaving out reversed
+// receipts and the tier bonus so a tier does not help keep itself
+func trailingPoints(tx *bolt.Tx, account string, now time.Time) (int, error) {
+	ledger := tx.Bucket(database.LedgerBucket).Bucket([]byte(account))
+	if ledger == nil {
+		return 0, nil
+	}
+	since := now.AddDate(-1, 0, 0)
+	var earned []model.LedgerEntry
+	reversed := map[string]bool{}
+	err := ledger.ForEach(func(k, v []byte) error {
+		var entry model.LedgerEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return err
+		}
+		switch {
+		case entry.Type == model.LedgerReversal:
+			reversed[entry.ReceiptID] = true
+		case entry.Type == model.LedgerEarn && entry.CreatedAt.After(since):
+			earned = append(earned, entry)
+		}
+		return nil
+	})
+	// A reversal takes back all the points of its receipt, even when it debited less because they were spent or expired
+	points := 0
+	for _, entry := range earned {
+		if !reversed[entry.ReceiptID] {
+			points += entry.Points - entry.TierBonus
+		}
+	}
+	return points, err
+}
+
+// evaluateTier moves the account to the tier its trailing points reach and records the change in its
+// history. It reports whether the tier changed, and does nothing when tiers are disabled.
+func evaluateTier(tx *bolt.Tx, account string, tiers []model.Tier, now time.Time) (bool, error) {
+	if account == "" || len(tiers) == 0 {
+		return false, nil
+	}
+	points, err := trailingPoints(tx, account, now)
+	if err != nil {
+		return false, err
+	}
+	status, err := getAccountTier(tx, account)
+	if err != nil {
+		return false, err
+	}
+	tier := tierFor(tiers, points)
+
+	changed := false
+	if status == nil {
+		status = &model.AccountTier{Tier: tier.Name, Since: now}
+		status.History = append(status.History, model.TierChange{
+			To: tier.Name, Reason: model.TierEnrollment, TrailingPoints: points, ChangedAt: now,
+		})
+		changed = true
+	} else if status.Tier != tier.Name {
+		reason := model.TierPromotion
+		if tierIndex(tiers, tier.Name) < tierIndex(tiers, status.Tier) {
+			reason = model.TierDemotion
+		}
+		log.Printf("account %s %s from %s to %s with %d trailing points\n", account, reason, status.Tier, tier.Name, points)
+		status.History = append(status.History, model.TierChange{
+			From: status.Tier, To: tier.Name, Reason: reason, TrailingPoints: points, ChangedAt: now,
+		})
+		status.Tier = tier.Name
+		status.Since = now
+		changed = true
+	}
+	status.TrailingPoints = points
+	status.EvaluatedAt = now
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return false, err
+	}
+	return changed, tx.Bucket(database.AccountTiersBucket).Put([]byte(account), data)
+}
+
+// applyTierBonus multiplies the points of the breakdown by the multiplier of the account's tier,
+// accounts not evaluated yet are in the lowest tier
+func applyTierBonus(tx *bolt.Tx, account string, tiers []model.Tier, breakdown *model.Breakdown) error {
+	if account == "" || len(tiers) == 0 {
+		return nil
+	}
+	tier := tiers[0]
+	status, err := getAccountTier(tx, account)
+	if err != nil {
+		return err
+	}
+	if status != nil {
+		i := tierIndex(tiers, status.Tier)
+		if i < 0 {
+			return nil
+		}
+		tier = tiers[i]
+	}
+	bonus := int(math.Round(float64(breakdown.Total) * (tier.Multiplier - 1)))
+	breakdown.Add(model.RuleTierBonus, fmt.Sprintf("%s tier, %gx points", tier.Name, tier.Multiplier), bonus)
+	log.Printf("Points after tier bonus: %d\n", breakdown.Total)
+	return nil
+}
+
+// TierJob re-evaluates the tier of every account, demoting accounts as points earned over a year ago stop
+// counting and catching up with credits and reversals made by reviewers.
+type TierJob struct {
+	DB    *bolt.DB
+	Tiers []model.Tier
+	// Interval is how often the tiers are evaluated
+	Interval time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTierJob returns a job evaluating the tiers hourly, call Start to run it.
+func NewTierJob(db *bolt.DB, tiers []model.Tier) *TierJob {
+	return &TierJob{DB: db, Tiers: tiers, Interval: time.Hour}
+}
+
+// Start evaluates the tiers in the background until Stop is called.
+func (j *TierJob) Start() {
+	j.done = make(chan struct{})
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		ticker := time.NewTicker(j.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.done:
+				return
+			case <-ticker.C:
+				if _, err := j.EvaluateAll(time.Now().UTC()); err != nil {
+					log.Printf("evaluating tiers failed: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop waits for the current evaluation to finish.
+func (j *TierJob) Stop() {
+	close(j.done)
+	j.wg.Wait()
+}
+
+// EvaluateAll evaluates the tier of every account with a ledger and returns how many changed tier.
+// Each account is evaluated in its own transaction so receipts keep processing during the scan.
+func (j *TierJob) EvaluateAll(now time.Time) (int, error) {
+	var accounts []string
+	err := j.DB.View(func(tx *bolt.Tx) error {
+		var err error
+		accounts, err = ledgerAccounts(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	changes := 0
+	for _, account := range accounts {
+		err := j.DB.Update(func(tx *bolt.Tx) error {
+			changed, err := evaluateTier(tx, account, j.Tiers, now)
+			if changed {
+				changes++
+			}
+			return err
+		})
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := ParseTiers(ExampleTiers)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Tier{
+		{Name: "Bronze", MinPoints: 0, Multiplier: 1},
+		{Name: "Silver", MinPoints: 1000, Multiplier: 1.25},
+		{Name: "Gold", MinPoints: 5000, Multiplier: 1.5},
+	}, tiers)
+
+	for _, spec := range []string{
+		"Bronze:0",
+		"Bronze:zero:1",
+		"Bronze:0:x",
+		"Bronze:10:1,Silver:100:2",
+		"Bronze:0:1,Silver:0:2",
+		"Bronze:0:1,Bronze:100:2",
+		"Bronze:0:0.5",
+		":0:1",
+	} {
+		_, err := ParseTiers(spec)
+		assert.ErrorIs(t, err, ErrInvalidTiers, spec)
+	}
+}
+
+func TestTiers(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	tiers, err := ParseTiers("Bronze:0:1,Silver:50:2")
+	assert.NoError(t, err)
+	processor := NewProcessor(db, Policy{Tiers: tiers}, 1)
+
+	// Each receipt is worth 31 points before the tier bonus
+	submit := func() *model.ReceiptRecord {
+		receipt := model.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-01-02",
+			PurchaseTime: "13:13",
+			Items:        []model.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}},
+			Total:        "1.25",
+		}
+		id, err := processor.Submit(&receipt, Submitter{AccountID: "alice"})
+		assert.NoError(t, err)
+		_, err = processor.ProcessPending()
+		assert.NoError(t, err)
+		record, err := GetReceipt(id, db)
+		assert.NoError(t, err)
+		return record
+	}
+
+	status, err := GetAccountTier("alice", db)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+
+	// New accounts enroll in the lowest tier, and are promoted once their points reach the next
+	assert.Equal(t, 31, submit().Points)
+	status, err = GetAccountTier("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bronze", status.Tier)
+	assert.Equal(t, 31, status.TrailingPoints)
+
+	assert.Equal(t, 31, submit().Points)
+	status, err = GetAccountTier("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, "Silver", status.Tier)
+	assert.Equal(t, 62, status.TrailingPoints)
+
+	// Silver doubles the points
+	record := submit()
+	assert.Equal(t, 62, record.Points)
+	assert.Equal(t, model.RuleAward{Rule: model.RuleTierBonus, Description: "Silver tier, 2x points", Points: 31},
+		record.Breakdown.Rules[len(record.Breakdown.Rules)-1])
+	// but the bonus does not count toward the tier
+	status, err = GetAccountTier("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 93, status.TrailingPoints)
+	entries := ledgerEntries(t, db, "alice")
+	assert.Equal(t, 31, entries[len(entries)-1].TierBonus)
+
+	// Receipts without an account get no bonus
+	receipt := model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-02", PurchaseTime: "13:13", Total: "1.25",
+		Items: []model.Item{{ShortDescription: "Pepsi - 12-oz", Price: "1.25"}}}
+	id, err := processor.Submit(&receipt, Submitter{})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+	points, err := GetPoints(id, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 31, points)
+
+	// The job keeps the tier while the points count, and demotes the account once they are over a year old
+	job := NewTierJob(db, tiers)
+	changes, err := job.EvaluateAll(time.Now().UTC())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, changes)
+	later := time.Now().UTC().AddDate(1, 0, 1)
+	changes, err = job.EvaluateAll(later)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changes)
+
+	status, err = GetAccountTier("alice", db)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bronze", status.Tier)
+	assert.Equal(t, 0, status.TrailingPoints)
+	assert.True(t, later.Equal(status.Since))
+	var reasons []string
+	for _, change := range status.History {
+		reasons = append(reasons, change.From+">"+change.To+" "+change.Reason)
+	}
+	assert.Equal(t, []string{">Bronze enrollment", "Bronze>Silver promotion", "Silver>Bronze demotion"}, reasons)
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Headers sent with every webhook delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// ErrInvalidWebhook is an error indicating that a subscription has an invalid URL or event type.
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// eventTypes lists the events a webhook can subscribe to
+var eventTypes = map[string]bool{
+	model.EventReceiptScored:   true,
+	model.EventReceiptRejected: true,
+	model.EventPointsReversed:  true,
+}
+
+// CreateWebhook subscribes the URL to the event types. A secret for signing payloads
+// is generated when none is given.
+func CreateWebhook(rawURL string, events []string, secret string, db *bolt.DB) (*model.Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http(s) url", ErrInvalidWebhook)
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: at least one event is required", ErrInvalidWebhook)
+	}
+	for _, event := range events {
+		if !eventTypes[event] {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+	if secret == "" {
+		data := make([]byte, 32)
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(data)
+	}
+
+	webhook := &model.Webhook{
+		ID:        uuid.New().String(),
+		URL:       rawURL,
+		Events:    events,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(webhook)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(database.WebhooksBucket).Put([]byte(webhook.ID), data)
+	})
+	return webhook, err
+}
+
+// ListWebhooks returns the subscriptions without their secrets.
+func ListWebhooks(db *bolt.DB) ([]model.Webhook, error) {
+	webhooks := []model.Webhook{}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.WebhooksBucket).ForEach(func(k, v []byte) error {
+			var webhook model.Webhook
+			if err := json.Unmarshal(v, &webhook); err != nil {
+				return err
+			}
+			webhook.Secret = ""
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	})
+	return webhooks, err
+}
+
+// DeleteWebhook removes the subscription, its delivery log is kept.
+func DeleteWebhook(id string, db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(database.WebhooksBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrIdNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// ListDeliveries returns the delivery log of the webhook, oldest first.
+func ListDeliveries(webhookID string, db *bolt.DB) ([]model.Delivery, error) {
+	deliveries := []model.Delivery{}
+	err := db.View(func(tx *bolt.Tx) error {
+		log := tx.Bucket(database.DeliveriesBucket).Bucket([]byte(webhookID))
+		if log == nil {
+			if tx.Bucket(database.WebhooksBucket).Get([]byte(webhookID)) == nil {
+				return ErrIdNotFound
+			}
+			return nil
+		}
+		return log.ForEach(func(k, v []byte) error {
+			var delivery model.Delivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, delivery)
+			return nil
+		})
+	})
+	return deliveries, err
+}
+
+// emitEvent queues a delivery of the event to every subscribed webhook. It runs in the
+// transaction making the change the event describes, so events are never lost or invented.
+func emitEvent(tx *bolt.Tx, eventType string, record *model.ReceiptRecord, points int, now time.Time) error {
+	event := model.Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: now,
+		Data: model.EventData{
+			ReceiptID: record.ID,
+			AccountID: record.AccountID,
+			Status:    record.Status,
+			Points:    points,
+		},
+	}
+	return tx.Bucket(database.WebhooksBucket).ForEach(func(k, v []byte) error {
+		var webhook model.Webhook
+		if err := json.Unmarshal(v, &webhook); err != nil {
+			return err
+		}
+		if !webhook.Subscribes(eventType) {
+			return nil
+		}
+
+		log, err := tx.Bucket(database.DeliveriesBucket).CreateBucketIfNotExists(k)
+		if err != nil {
+			return err
+		}
+		seq, err := log.NextSequence()
+		if err != nil {
+			return err
+		}
+		delivery := model.Delivery{
+			ID:            strconv.FormatUint(seq, 10),
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Status:        model.DeliveryPending,
+			Attempts:      []model.DeliveryAttempt{},
+			NextAttemptAt: now,
+		}
+		if err := putDelivery(tx, &delivery); err != nil {
+			return err
+		}
+		return tx.Bucket(database.PendingBucket).Put(pendingKey(webhook.ID, seq), nil)
+	})
+}
+
+func putDelivery(tx *bolt.Tx, delivery *model.Delivery) error {
+	seq, err := strconv.ParseUint(delivery.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(database.DeliveriesBucket).Bucket([]byte(delivery.WebhookID)).Put(queueKey(seq), data)
+}
+
+// pendingKey indexes a pending delivery by webhook ID followed by its sequence in the webhook's log
+func pendingKey(webhookID string, seq uint64) []byte {
+	return append([]byte(webhookID+"|"), queueKey(seq)...)
+}
+
+// Sign returns the signature of a payload sent at timestamp, the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret. Receivers recompute it to
+// verify the payload and reject stale timestamps to prevent replays.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers pending webhook events, retrying failures with exponential backoff.
+type Dispatcher struct {
+	DB     *bolt.DB
+	Client *http.Client
+	// MaxAttempts is how often a delivery is tried before it is marked failed
+	MaxAttempts int
+	// Backoff is the delay before the first retry, it doubles with every attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Interval is how often pending deliveries are checked
+	Interval time.Duration
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher with the default retry schedule, call Start to run it.
+func NewDispatcher(db *bolt.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 8,
+		Backoff:     30 * time.Second,
+		MaxBackoff:  time.Hour,
+		Interval:    time.Second,
+	}
+}
+
+// Start delivers pending events in the background until Stop is called.
+func (d *Dispatcher) Start() {
+	d.done = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+				if _, err := d.DeliverDue(time.Now().UTC()); err != nil {
+					log.Printf("delivering webhooks failed: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop waits for the current round of deliveries to finish.
+func (d *Dispatcher) Stop() {
+	close(d.done)
+	d.wg.Wait()
+}
+
+// DeliverDue attempts every pending delivery whose next attempt is due and returns how many it attempted.
+func (d *Dispatcher) DeliverDue(now time.Time) (int, error) {
+	type due struct {
+		delivery model.Delivery
+		secret   string
+		url      string
+	}
+	var batch []due
+	err := d.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(database.PendingBucket).ForEach(func(k, v []byte) error {
+			webhookID, seq := string(k[:len(k)-9]), k[len(k)-8:]
+			data := tx.Bucket(database.DeliveriesBucket).Bucket([]byte(webhookID)).Get(seq)
+			var delivery model.Delivery
+			if err := json.Unmarshal(data, &delivery); err != nil {
+				return err
+			}
+			if delivery.NextAttemptAt.After(now) {
+				return nil
+			}
+			var webhook model.Webhook
+			if data := tx.Bucket(database.WebhooksBucket).Get([]byte(webhookID)); data != nil {
+				if err := json.Unmarshal(data, &webhook); err != nil {
+					return err
+				}
+			}
+			batch = append(batch, due{delivery: delivery, secret: webhook.Secret, url: webhook.URL})
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range batch {
+		delivery := item.delivery
+		attempt := model.DeliveryAttempt{At: now}
+		if item.url == "" {
+			attempt.Error = "webhook was deleted"
+			delivery.Attempts = append(delivery.Attempts, attempt)
+			delivery.Status = model.DeliveryFailed
+		} else {
+			attempt.StatusCode, err = d.post(item.url, item.secret, &delivery, now)
+			if err != nil {
+				attempt.Error = err.Error()
+			}
+			delivery.Attempts = append(delivery.Attempts, attempt)
+			d.schedule(&delivery, err == nil, now)
+		}
+
+		err = d.DB.Update(func(tx *bolt.Tx) error {
+			if err := putDelivery(tx, &delivery); err != nil {
+				return err
+			}
+			if delivery.Status == model.DeliveryPending {
+				return nil
+			}
+			seq, _ := strconv.ParseUint(delivery.ID, 10, 64)
+			return tx.Bucket(database.PendingBucket).Delete(pendingKey(delivery.WebhookID, seq))
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// post sends the signed event and returns the response status, non-2xx responses are errors
+func (d *Dispatcher) post(url, secret string, delivery *model.Delivery, now time.Time) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(DeliveryHeader, delivery.WebhookID+"/"+delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// schedule marks the delivery delivered, failed after the last attempt, or due again after the backoff
+func (d *Dispatcher) schedule(delivery *model.Delivery, ok bool, now time.Time) {
+	switch {
+	case ok:
+		delivery.Status = model.DeliveryDelivered
+	case len(delivery.Attempts) >= d.MaxAttempts:
+		delivery.Status = model.DeliveryFailed
+	default:
+		backoff := d.Backoff << (len(delivery.Attempts) - 1)
+		if backoff > d.MaxBackoff || backoff <= 0 {
+			backoff = d.MaxBackoff
+		}
+		delivery.NextAttemptAt = now.Add(backoff)
+	}
+}
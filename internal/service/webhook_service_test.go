@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/VineethKanaparthi/receipt-processor/internal/database"
+	model "github.com/VineethKanaparthi/receipt-processor/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+
+	// The receiver fails the first delivery and verifies the signature of every request
+	var mu sync.Mutex
+	var received []model.Event
+	requests := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, Sign("secret", r.Header.Get(TimestampHeader), body), r.Header.Get(SignatureHeader))
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event model.Event
+		assert.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, event.Type, r.Header.Get(EventHeader))
+		received = append(received, event)
+	}))
+	defer receiver.Close()
+
+	_, err := CreateWebhook("ftp://example.com", []string{model.EventReceiptScored}, "", db)
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	_, err = CreateWebhook(receiver.URL, []string{"receipt.lost"}, "", db)
+	assert.ErrorIs(t, err, ErrInvalidWebhook)
+	webhook, err := CreateWebhook(receiver.URL, []string{model.EventReceiptScored, model.EventPointsReversed}, "secret", db)
+	assert.NoError(t, err)
+
+	processor := NewProcessor(db, Policy{}, 1)
+	receipt := gatoradeReceipt
+	id, err := processor.Submit(&receipt, Submitter{AccountID: "alice"})
+	assert.NoError(t, err)
+	// Rejections are not delivered to webhooks that did not subscribe to them
+	_, err = processor.Submit(&model.Receipt{PurchaseTime: "25:00"}, Submitter{AccountID: "alice"})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+
+	dispatcher := NewDispatcher(db)
+	now := time.Now().UTC()
+	attempted, err := dispatcher.DeliverDue(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	// The failed delivery is retried once its backoff has passed
+	attempted, err = dispatcher.DeliverDue(now.Add(dispatcher.Backoff - time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, attempted)
+	attempted, err = dispatcher.DeliverDue(now.Add(dispatcher.Backoff))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	assert.Len(t, received, 1)
+	assert.Equal(t, model.EventReceiptScored, received[0].Type)
+	assert.Equal(t, id, received[0].Data.ReceiptID)
+	assert.Equal(t, 109, received[0].Data.Points)
+
+	deliveries, err := ListDeliveries(webhook.ID, db)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, model.DeliveryDelivered, deliveries[0].Status)
+	assert.Len(t, deliveries[0].Attempts, 2)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].Attempts[0].StatusCode)
+	assert.Equal(t, http.StatusOK, deliveries[0].Attempts[1].StatusCode)
+
+	// Reversing the receipt debits the ledger and emits points.reversed
+	record, err := ReverseReceipt(id, "admin", "chargeback", db)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusReversed, record.Status)
+	entries := ledgerEntries(t, db, "alice")
+	assert.Len(t, entries, 2)
+	assert.Equal(t, model.LedgerReversal, entries[1].Type)
+	assert.Equal(t, -109, entries[1].Points)
+	_, err = ReverseReceipt(id, "admin", "", db)
+	assert.ErrorIs(t, err, ErrNotScored)
+
+	_, err = dispatcher.DeliverDue(time.Now().UTC())
+	assert.NoError(t, err)
+	assert.Len(t, received, 2)
+	assert.Equal(t, model.EventPointsReversed, received[1].Type)
+	assert.Equal(t, -109, received[1].Data.Points)
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	db := database.NewBoltDatabase(filepath.Join(t.TempDir(), "receipts.db"))
+	defer db.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	webhook, err := CreateWebhook(receiver.URL, []string{model.EventReceiptRejected}, "", db)
+	assert.NoError(t, err)
+	processor := NewProcessor(db, Policy{}, 1)
+	_, err = processor.Submit(&model.Receipt{PurchaseTime: "25:00"}, Submitter{})
+	assert.NoError(t, err)
+	_, err = processor.ProcessPending()
+	assert.NoError(t, err)
+
+	dispatcher := NewDispatcher(db)
+	dispatcher.MaxAttempts = 3
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		_, err := dispatcher.DeliverDue(now)
+		assert.NoError(t, err)
+		now = now.Add(dispatcher.MaxBackoff)
+	}
+
+	deliveries, err := ListDeliveries(webhook.ID, db)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, model.DeliveryFailed, deliveries[0].Status)
+	assert.Len(t, deliveries[0].Attempts, 3)
+	// The backoff doubles after every failed attempt
+	assert.Equal(t, 2*dispatcher.Backoff, deliveries[0].NextAttemptAt.Sub(deliveries[0].Attempts[1].At))
+}
@@ -0,0 +1,64 @@
+package model
+
+// Rules awarding points, see the README for their definitions
+const (
+	RuleRetailerName    = "retailer_name"
+	RuleRoundTotal      = "round_total"
+	RuleQuarterTotal    = "quarter_total"
+	RuleItemPairs       = "item_pairs"
+	RuleItemDescription = "item_description"
+	RuleOddDay          = "odd_day"
+	RuleAfternoon       = "afternoon"
+	// RuleCampaign is the bonus of a campaign, the award names the campaign
+	RuleCampaign = "campaign"
+	// RuleProductBonus is the sponsored bonus of a catalog product, the award names the product
+	RuleProductBonus = "product_bonus"
+	// RuleCustom is the award of a custom rule, the award names the rule
+	RuleCustom = "custom"
+	// RuleTierBonus is the bonus of the account's membership tier on top of the other rules
+	RuleTierBonus = "tier_bonus"
+	// RuleCap takes back the points over a cap, the award names the cap
+	RuleCap = "cap"
+)
+
+// Caps on the points of receipts
+const (
+	// CapPerRule bounds the points one rule awards a receipt
+	CapPerRule = "per_rule"
+	// CapPerReceipt bounds the points of a receipt
+	CapPerReceipt = "per_receipt"
+	// CapPerAccountPerDay bounds the points an account earns per UTC day
+	CapPerAccountPerDay = "per_account_per_day"
+)
+
+// RuleAward is the points a single rule awarded a receipt.
+type RuleAward struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Points      int    `json:"points"`
+	// CampaignID is the campaign that awarded the points of a campaign award
+	CampaignID string `json:"campaignId,omitempty"`
+	// ProductID is the product that awarded the points of a product bonus
+	ProductID string `json:"productId,omitempty"`
+	// RuleID is the custom rule that awarded the points of a custom award
+	RuleID string `json:"ruleId,omitempty"`
+	// Cap is the cap that took back points of a cap award
+	Cap string `json:"cap,omitempty"`
+	// CappedRule is the rule whose points a per rule cap took back
+	CappedRule string `json:"cappedRule,omitempty"`
+}
+
+// Breakdown explains how a receipt's points were calculated, rules that awarded nothing are left out.
+type Breakdown struct {
+	Rules []RuleAward `json:"rules"`
+	Total int         `json:"total"`
+}
+
+// Add records the points awarded by a rule.
+func (breakdown *Breakdown) Add(rule, description string, points int) {
+	if points == 0 {
+		return
+	}
+	breakdown.Rules = append(breakdown.Rules, RuleAward{Rule: rule, Description: description, Points: points})
+	breakdown.Total += points
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Stacking modes of campaigns
+const (
+	// StackingStack campaigns combine with the other stackable campaigns a receipt qualifies for
+	StackingStack = "stack"
+	// StackingExclusive campaigns combine with no other, a receipt gets the best exclusive campaign
+	// or the stackable ones, whichever is worth more
+	StackingExclusive = "exclusive"
+)
+
+// Campaign is a promotion awarding bonus points on receipts from its retailers purchased within
+// its window, like "2x points at Target this weekend" or "+100 points for spending $50 at Walgreens".
+type Campaign struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// RetailerIDs are the registry retailers the campaign applies to, every retailer when empty
+	RetailerIDs []string `json:"retailerIds"`
+	// StartsAt and EndsAt bound the purchase time, EndsAt is exclusive
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+	// MinTotal is the least the receipt total has to be, like 50.00
+	MinTotal string `json:"minTotal,omitempty"`
+	// Multiplier multiplies the points of the base rules, 2 doubles them
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Bonus is a flat number of points
+	Bonus     int       `json:"bonus,omitempty"`
+	Stacking  string    `json:"stacking"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
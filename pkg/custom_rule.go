@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// CustomRule is a rule written in the expression language, awarding its points to the receipts
+// meeting its condition, like 50 points for Target receipts of $25 or more bought in the afternoon.
+type CustomRule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Condition is a bool expression over the receipt, like
+	// retailer.canonical == "target" && total >= 25.00 && hour(purchase) in 14..16.
+	// Every receipt meets an empty condition.
+	Condition string `json:"condition,omitempty"`
+	// Points is a number expression of the points awarded, rounded, like 50 or floor(total) * 2
+	Points    string    `json:"points"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// FeedEvent announces a receipt that finished processing on the live feed.
+type FeedEvent struct {
+	Seq       uint64    `json:"seq"`
+	ReceiptID string    `json:"receiptId"`
+	Retailer  string    `json:"retailer"`
+	Points    int       `json:"points"`
+	Status    string    `json:"status"`
+	AccountID string    `json:"accountId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// Types of ledger entries
+const (
+	// LedgerEarn credits the points of a scored receipt
+	LedgerEarn = "earn"
+	// LedgerReversal debits the points of a reversed receipt
+	LedgerReversal = "reversal"
+	// LedgerRedemption debits the points an account spent, taken from its oldest points first
+	LedgerRedemption = "redemption"
+	// LedgerExpiry debits the points of a receipt left unspent when they expired
+	LedgerExpiry = "expiry"
+)
+
+// LedgerEntry is a single movement of points in an account's ledger.
+type LedgerEntry struct {
+	Seq       uint64 `json:"seq"`
+	Type      string `json:"type"`
+	ReceiptID string `json:"receiptId,omitempty"`
+	Points    int    `json:"points"`
+	// TierBonus is the part of the points of an earn entry that the account's tier added, it does
+	// not count toward the tiers
+	TierBonus int       `json:"tierBonus,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PointLot is the unspent points an account earned with one receipt, spent oldest first.
+type PointLot struct {
+	ReceiptID string    `json:"receiptId,omitempty"`
+	Points    int       `json:"points"`
+	EarnedAt  time.Time `json:"earnedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
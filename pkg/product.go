@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// Types of product matchers
+const (
+	// MatchSKU matches items by their SKU
+	MatchSKU = "sku"
+	// MatchExact matches item descriptions equal to the value, ignoring case and spacing
+	MatchExact = "exact"
+	// MatchPrefix matches item descriptions starting with the value, ignoring case and spacing
+	MatchPrefix = "prefix"
+	// MatchRegex matches item descriptions with a regular expression
+	MatchRegex = "regex"
+)
+
+// Product is a product of the catalog, items matching one of its matchers earn its bonuses.
+type Product struct {
+	ID       string           `json:"id"`
+	Name     string           `json:"name"`
+	Brand    string           `json:"brand,omitempty"`
+	Matchers []ProductMatcher `json:"matchers"`
+	Bonuses  []ProductBonus   `json:"bonuses"`
+	// CreatedAt and UpdatedAt are set by the catalog
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ProductMatcher recognizes items of a product by SKU or by their description.
+type ProductMatcher struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ProductBonus is sponsored points earned by every unit of the product bought.
+type ProductBonus struct {
+	// Points per unit bought
+	Points int `json:"points"`
+	// MaxUnits caps the units earning the bonus on one receipt, unlimited when zero
+	MaxUnits int `json:"maxUnits,omitempty"`
+	// StartsAt and EndsAt bound the purchase time when set, EndsAt is exclusive
+	StartsAt *time.Time `json:"startsAt,omitempty"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+}
+
+// ProductMatch is the product of the catalog an item was matched to on ingest.
+type ProductMatch struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	// Matcher is the type of the matcher that recognized the item
+	Matcher string `json:"matcher"`
+}
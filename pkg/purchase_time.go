@@ -0,0 +1,84 @@
+package model
+
+import (
+	"time"
+	// Time zones are embedded so receipts can be read on the store's clock in minimal images
+	_ "time/tzdata"
+)
+
+// dstShifts are the clock changes of daylight saving time transitions, Lord Howe Island shifts by 30 minutes
+var dstShifts = []time.Duration{-time.Hour, -30 * time.Minute, 30 * time.Minute, time.Hour}
+
+// Location is the time zone of the store, or nil when the receipt has none
+func (receipt *Receipt) Location() (*time.Location, error) {
+	if receipt.TimeZone == "" {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(receipt.TimeZone)
+	if err != nil {
+		return nil, &ValidationError{Field: "timeZone", Message: "is not a known IANA time zone"}
+	}
+	return location, nil
+}
+
+// PurchasedAt combines the purchase date and time into an instant. The date and time are read
+// with the purchase offset when there is one, otherwise on the clock of the store's time zone.
+// Clock times skipped when daylight saving time starts are invalid, and those repeated when it
+// ends are the first of the two.
+func (receipt *Receipt) PurchasedAt() (time.Time, error) {
+	clock, err := time.Parse("2006-01-02 15:04", receipt.PurchaseDate+" "+receipt.PurchaseTime)
+	if err != nil {
+		return time.Time{}, &ValidationError{Field: "purchaseTime", Message: "and purchaseDate are not in the correct format"}
+	}
+
+	if receipt.PurchaseOffset != "" {
+		offset, err := time.Parse("-07:00", receipt.PurchaseOffset)
+		if err != nil {
+			return time.Time{}, &ValidationError{Field: "purchaseOffset", Message: "is not a UTC offset like -05:00"}
+		}
+		_, seconds := offset.Zone()
+		return time.Date(clock.Year(), clock.Month(), clock.Day(), clock.Hour(), clock.Minute(), 0, 0, time.FixedZone("", seconds)), nil
+	}
+
+	location, err := receipt.Location()
+	if err != nil || location == nil {
+		return clock, err
+	}
+	instant := time.Date(clock.Year(), clock.Month(), clock.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+	if !sameClock(instant, clock) {
+		return time.Time{}, &ValidationError{Field: "purchaseTime", Message: "does not exist in " + receipt.TimeZone + ", the clocks were moved forward"}
+	}
+	for _, shift := range dstShifts {
+		if earlier := instant.Add(shift); shift < 0 && sameClock(earlier, clock) {
+			instant = earlier
+		}
+	}
+	return instant, nil
+}
+
+// LocalPurchaseTime is the purchase date and time on the store's clock, which the time rules use.
+// Receipts without a time zone keep the clock they were printed with. When the date or time is
+// missing the other is returned as printed.
+func (receipt *Receipt) LocalPurchaseTime() (time.Time, error) {
+	location, err := receipt.Location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if receipt.PurchaseDate == "" || receipt.PurchaseTime == "" {
+		date, _ := time.Parse("2006-01-02", receipt.PurchaseDate)
+		clock, _ := time.Parse("15:04", receipt.PurchaseTime)
+		return time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC), nil
+	}
+
+	instant, err := receipt.PurchasedAt()
+	if err != nil || location == nil {
+		return instant, err
+	}
+	return instant.In(location), nil
+}
+
+// sameClock reports whether the instant shows the wall clock date and time
+func sameClock(instant, clock time.Time) bool {
+	return instant.Year() == clock.Year() && instant.YearDay() == clock.YearDay() &&
+		instant.Hour() == clock.Hour() && instant.Minute() == clock.Minute()
+}
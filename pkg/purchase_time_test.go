@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurchasedAt(t *testing.T) {
+	tests := []struct {
+		name           string
+		date, time     string
+		purchaseOffset string
+		timeZone       string
+		instant        string
+		err            string
+	}{
+		{"utc", "2024-03-10", "14:30", "", "", "2024-03-10T14:30:00Z", ""},
+		{"offset", "2024-03-10", "14:30", "-05:00", "America/Chicago", "2024-03-10T19:30:00Z", ""},
+		{"time zone", "2024-07-01", "14:30", "", "America/New_York", "2024-07-01T18:30:00Z", ""},
+		{"skipped when clocks move forward", "2024-03-10", "02:30", "", "America/New_York", "", "does not exist in America/New_York"},
+		{"skipped time with an offset", "2024-03-10", "02:30", "-05:00", "America/New_York", "2024-03-10T07:30:00Z", ""},
+		{"repeated when clocks move back", "2024-11-03", "01:30", "", "America/New_York", "2024-11-03T05:30:00Z", ""},
+		{"repeated time with an offset", "2024-11-03", "01:30", "-05:00", "America/New_York", "2024-11-03T06:30:00Z", ""},
+		{"half hour shift", "2024-04-07", "01:45", "", "Australia/Lord_Howe", "2024-04-06T14:45:00Z", ""},
+		{"unknown time zone", "2024-03-10", "14:30", "", "Mars/Olympus_Mons", "", "not a known IANA time zone"},
+		{"invalid offset", "2024-03-10", "14:30", "5h", "", "", "not a UTC offset"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receipt := Receipt{PurchaseDate: test.date, PurchaseTime: test.time, PurchaseOffset: test.purchaseOffset, TimeZone: test.timeZone}
+			instant, err := receipt.PurchasedAt()
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				assert.ErrorContains(t, receipt.Validate(), test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.instant, instant.UTC().Format(time.RFC3339))
+		})
+	}
+}
+
+func TestLocalPurchaseTime(t *testing.T) {
+	receipt := Receipt{PurchaseDate: "2024-11-03", PurchaseTime: "06:30", PurchaseOffset: "+00:00", TimeZone: "America/New_York"}
+	local, err := receipt.LocalPurchaseTime()
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-11-03T01:30:00-05:00", local.Format(time.RFC3339))
+}
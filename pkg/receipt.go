@@ -1,10 +1,32 @@
 package model
 
 import (
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
 	"time"
 )
 
+// Tender types of payment lines
+const (
+	TenderCash     = "cash"
+	TenderCredit   = "credit"
+	TenderDebit    = "debit"
+	TenderGiftCard = "gift_card"
+	TenderMobile   = "mobile"
+	TenderOther    = "other"
+)
+
+var tenders = map[string]bool{
+	TenderCash:     true,
+	TenderCredit:   true,
+	TenderDebit:    true,
+	TenderGiftCard: true,
+	TenderMobile:   true,
+	TenderOther:    true,
+}
+
 // Receipt represents the structure of a receipt.
 type Receipt struct {
 	Retailer     string `json:"retailer"`
@@ -12,28 +34,261 @@ type Receipt struct {
 	PurchaseTime string `json:"purchaseTime"`
 	Items        []Item `json:"items" binding:"dive"`
 	Total        string `json:"total" binding:"numeric"`
+
+	// The lines below are optional. When a receipt has any of them, the total must equal
+	// the item prices less the discounts plus the taxes and the tip.
+
+	// Subtotal is the item prices less the discounts, before taxes and the tip
+	Subtotal  string       `json:"subtotal,omitempty" binding:"omitempty,numeric"`
+	Discounts []Adjustment `json:"discounts,omitempty" binding:"dive"`
+	Taxes     []Adjustment `json:"taxes,omitempty" binding:"dive"`
+	Tip       string       `json:"tip,omitempty" binding:"omitempty,numeric"`
+	// Payments are the tenders the total was paid with, they must add up to the total
+	Payments []Payment `json:"payments,omitempty" binding:"dive"`
+
+	// PurchaseOffset is the UTC offset of the purchase date and time, like -05:00.
+	// Without one they are read on the clock of the time zone.
+	PurchaseOffset string `json:"purchaseOffset,omitempty"`
+	// TimeZone is the IANA time zone of the store, like America/Chicago. The time rules
+	// use the store's clock, receipts without a time zone or offset are in UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	Store    *Store `json:"store,omitempty"`
+
+	// CanonicalRetailer is set on ingest when the retailer matches the registry, Retailer keeps the name as sent
+	CanonicalRetailer *RetailerMatch `json:"canonicalRetailer,omitempty"`
+}
+
+// RetailerName is the canonical name of the retailer when it is in the registry, otherwise the name as sent
+func (receipt *Receipt) RetailerName() string {
+	if receipt.CanonicalRetailer != nil {
+		return receipt.CanonicalRetailer.Name
+	}
+	return receipt.Retailer
+}
+
+// Store is where the purchase was made.
+type Store struct {
+	ID         string `json:"id,omitempty"`
+	Address    string `json:"address,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	// Country is the ISO 3166-1 alpha-2 code of the country
+	Country string `json:"country,omitempty"`
+}
+
+// ValidationError reports a receipt field that is not in the correct format
+type ValidationError struct {
+	// Field is the JSON name of the field
+	Field   string
+	Message string
 }
 
-// Validate validates that the receipt variables are in the correct format
+func (err *ValidationError) Error() string {
+	return "field `" + err.Field + "` " + err.Message
+}
+
+// Validate validates that the receipt variables are in the correct format and that its lines add up
 func (receipt *Receipt) Validate() error {
 	if receipt.PurchaseDate != "" {
 		_, err := time.Parse("2006-01-02", receipt.PurchaseDate)
 		if err != nil {
-			return errors.New("field `purchaseDate` is not in the correct format")
+			return &ValidationError{Field: "purchaseDate", Message: "is not in the correct format"}
 		}
 	}
 
 	if receipt.PurchaseTime != "" {
 		_, err := time.Parse("15:04", receipt.PurchaseTime)
 		if err != nil {
-			return errors.New("field `purchaseTime` is not in the correct format")
+			return &ValidationError{Field: "purchaseTime", Message: "is not in the correct format"}
+		}
+	}
+
+	if _, err := receipt.LocalPurchaseTime(); err != nil {
+		return err
+	}
+
+	for i := range receipt.Items {
+		if err := receipt.Items[i].validate(fmt.Sprintf("items/%d/", i)); err != nil {
+			return err
+		}
+	}
+	for i, discount := range receipt.Discounts {
+		if ParseCents(discount.Amount) < 0 {
+			return &ValidationError{Field: fmt.Sprintf("discounts/%d/amount", i), Message: "must not be negative"}
+		}
+	}
+	for i, tax := range receipt.Taxes {
+		if ParseCents(tax.Amount) < 0 {
+			return &ValidationError{Field: fmt.Sprintf("taxes/%d/amount", i), Message: "must not be negative"}
+		}
+	}
+	if receipt.TipCents() < 0 {
+		return &ValidationError{Field: "tip", Message: "must not be negative"}
+	}
+
+	if receipt.Subtotal != "" && ParseCents(receipt.Subtotal) != receipt.ItemCents()-receipt.DiscountCents() {
+		return &ValidationError{Field: "subtotal", Message: "does not equal the item prices less the discounts"}
+	}
+	if receipt.Itemized() && ParseCents(receipt.Total) != receipt.ExpectedTotalCents() {
+		return &ValidationError{Field: "total", Message: "does not equal the item prices less the discounts plus the taxes and tip"}
+	}
+	if len(receipt.Payments) > 0 {
+		var paid int64
+		for i, payment := range receipt.Payments {
+			if !tenders[payment.Tender] {
+				return &ValidationError{Field: fmt.Sprintf("payments/%d/tender", i), Message: "is not a known tender type"}
+			}
+			paid += ParseCents(payment.Amount)
+		}
+		if paid != ParseCents(receipt.Total) {
+			return &ValidationError{Field: "payments", Message: "do not add up to the total"}
 		}
 	}
 	return nil
 }
 
+// Itemized reports whether the receipt has any discount, tax, tip or subtotal lines
+func (receipt *Receipt) Itemized() bool {
+	return receipt.Subtotal != "" || len(receipt.Discounts) > 0 || len(receipt.Taxes) > 0 || receipt.Tip != ""
+}
+
+// ItemCount is the number of items bought, counting quantities
+func (receipt *Receipt) ItemCount() int {
+	count := 0
+	for _, item := range receipt.Items {
+		count += item.Count()
+	}
+	return count
+}
+
+// ItemCents is the sum of the item prices in cents
+func (receipt *Receipt) ItemCents() int64 {
+	var sum int64
+	for _, item := range receipt.Items {
+		sum += ParseCents(item.Price)
+	}
+	return sum
+}
+
+// DiscountCents is the sum of the receipt discounts in cents, item discounts are part of the item prices
+func (receipt *Receipt) DiscountCents() int64 {
+	return sumAdjustments(receipt.Discounts)
+}
+
+// TaxCents is the sum of the tax lines in cents
+func (receipt *Receipt) TaxCents() int64 {
+	return sumAdjustments(receipt.Taxes)
+}
+
+// TipCents is the tip in cents
+func (receipt *Receipt) TipCents() int64 {
+	return ParseCents(receipt.Tip)
+}
+
+// ExpectedTotalCents is the total the lines of the receipt add up to
+func (receipt *Receipt) ExpectedTotalCents() int64 {
+	return receipt.ItemCents() - receipt.DiscountCents() + receipt.TaxCents() + receipt.TipCents()
+}
+
+// MaxQuantity is the most units of an item one receipt line can have
+const MaxQuantity = 100
+
 // Item represents the structure of an item in a receipt.
 type Item struct {
 	ShortDescription string `json:"shortDescription"`
-	Price            string `json:"price" binding:"numeric"`
+	// Price is the price paid for the line, the unit price times the quantity less the discount
+	Price string `json:"price" binding:"numeric"`
+	// Quantity bought, 1 when omitted. Items of more than one need a unit price.
+	Quantity  int    `json:"quantity,omitempty" binding:"min=0,max=100"`
+	UnitPrice string `json:"unitPrice,omitempty" binding:"omitempty,numeric"`
+	Discount  string `json:"discount,omitempty" binding:"omitempty,numeric"`
+	SKU       string `json:"sku,omitempty"`
+	// UPC is the UPC or EAN barcode number, its check digit is validated
+	UPC string `json:"upc,omitempty"`
+	// Product is set on ingest when the item matches the product catalog
+	Product *ProductMatch `json:"product,omitempty"`
+}
+
+// Count is the quantity of the item bought
+func (item *Item) Count() int {
+	return max(1, item.Quantity)
+}
+
+// validate checks the line arithmetic and barcode of the item, prefix is its path in the receipt
+func (item *Item) validate(prefix string) error {
+	if item.Quantity > MaxQuantity {
+		return &ValidationError{Field: prefix + "quantity", Message: fmt.Sprintf("must be at most %d", MaxQuantity)}
+	}
+	if item.Count() > 1 && item.UnitPrice == "" {
+		return &ValidationError{Field: prefix + "unitPrice", Message: "is required for a quantity of more than 1"}
+	}
+	discount := ParseCents(item.Discount)
+	if discount < 0 {
+		return &ValidationError{Field: prefix + "discount", Message: "must not be negative"}
+	}
+	if item.UnitPrice != "" {
+		if ParseCents(item.UnitPrice) < 0 {
+			return &ValidationError{Field: prefix + "unitPrice", Message: "must not be negative"}
+		}
+		if ParseCents(item.Price) != int64(item.Count())*ParseCents(item.UnitPrice)-discount {
+			return &ValidationError{Field: prefix + "price", Message: "does not equal the unit price times the quantity less the discount"}
+		}
+	}
+	if item.UPC != "" && !validGTIN(item.UPC) {
+		return &ValidationError{Field: prefix + "upc", Message: "is not a valid UPC or EAN"}
+	}
+	return nil
+}
+
+// validGTIN checks the length and check digit of a UPC-A, UPC-E expanded, EAN-8, EAN-13 or GTIN-14 number
+func validGTIN(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		digit := int(code[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		// Digits are weighted 3 and 1 alternately, starting with 3 left of the check digit
+		if (len(code)-1-i)%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// Adjustment is a discount or tax line of a receipt.
+type Adjustment struct {
+	Description string `json:"description"`
+	Amount      string `json:"amount" binding:"numeric"`
+}
+
+func sumAdjustments(adjustments []Adjustment) int64 {
+	var sum int64
+	for _, adjustment := range adjustments {
+		sum += ParseCents(adjustment.Amount)
+	}
+	return sum
+}
+
+// Payment is a tender the receipt was paid with.
+type Payment struct {
+	Tender string `json:"tender"`
+	Amount string `json:"amount" binding:"numeric"`
+}
+
+// Fingerprint identifies the receipt by retailer, purchase date, time and total,
+// ignoring case and spacing of the retailer. Items are not part of it, so
+// resubmissions of the same purchase share a fingerprint however their items were edited. Retailers in the
+// registry are identified by their canonical name, whatever spelling was sent.
+func (receipt *Receipt) Fingerprint() string {
+	retailer := strings.Join(strings.Fields(strings.ToLower(receipt.RetailerName())), " ")
+	sum := sha256.Sum256([]byte(retailer + "|" + receipt.PurchaseDate + "|" + receipt.PurchaseTime + "|" + receipt.Total))
+	return hex.EncodeToString(sum[:])
 }
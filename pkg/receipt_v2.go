@@ -0,0 +1,111 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ReceiptV2 is the receipt payload of the v2 API. Amounts are integer cents, the purchase
+// time carries its UTC offset and items have a quantity. It is stored as a Receipt, so both
+// API versions share the points rules and storage.
+type ReceiptV2 struct {
+	Retailer string `json:"retailer" binding:"required"`
+	// TimeZone is the IANA time zone of the store, the time rules convert the purchase time to it
+	TimeZone string `json:"timeZone,omitempty"`
+	Store    *Store `json:"store,omitempty"`
+	// PurchasedAt is the time of the purchase with its UTC offset, the time rules use the store clock
+	PurchasedAt time.Time `json:"purchasedAt" binding:"required"`
+	// AccountID credits the receipt to a loyalty account, it defaults to the account of the bearer token
+	AccountID  string   `json:"accountId,omitempty"`
+	Items      []ItemV2 `json:"items" binding:"required,min=1,dive"`
+	TotalCents int64    `json:"totalCents" binding:"min=0"`
+	// CanonicalRetailer is the registry retailer the receipt was matched to on ingest, it is read only
+	CanonicalRetailer *RetailerMatch `json:"canonicalRetailer,omitempty"`
+}
+
+// ItemV2 is a line of a v2 receipt.
+type ItemV2 struct {
+	Description string `json:"description" binding:"required"`
+	// Quantity of the item bought, 1 when omitted
+	Quantity       int   `json:"quantity,omitempty" binding:"min=0,max=100"`
+	UnitPriceCents int64 `json:"unitPriceCents" binding:"min=0"`
+	// Product is the catalog product the item was matched to on ingest, it is read only
+	Product *ProductMatch `json:"product,omitempty"`
+}
+
+// ToReceipt adapts the receipt to the v1 model.
+func (receipt *ReceiptV2) ToReceipt() *Receipt {
+	v1 := &Receipt{
+		Retailer:       receipt.Retailer,
+		PurchaseDate:   receipt.PurchasedAt.Format("2006-01-02"),
+		PurchaseTime:   receipt.PurchasedAt.Format("15:04"),
+		PurchaseOffset: receipt.PurchasedAt.Format("-07:00"),
+		TimeZone:       receipt.TimeZone,
+		Store:          receipt.Store,
+		Total:          FormatCents(receipt.TotalCents),
+	}
+	for _, item := range receipt.Items {
+		quantity := max(1, item.Quantity)
+		v1.Items = append(v1.Items, Item{
+			ShortDescription: item.Description,
+			Price:            FormatCents(int64(quantity) * item.UnitPriceCents),
+			Quantity:         quantity,
+			UnitPrice:        FormatCents(item.UnitPriceCents),
+		})
+	}
+	return v1
+}
+
+// ReceiptToV2 adapts a stored receipt to the v2 model. Consecutive identical items without a
+// quantity are merged into one line, receipts without a time zone or offset are in UTC.
+func ReceiptToV2(receipt *Receipt, accountID string) *ReceiptV2 {
+	purchasedAt, _ := receipt.PurchasedAt()
+	if location, err := receipt.Location(); err == nil && location != nil && receipt.PurchaseOffset == "" {
+		purchasedAt = purchasedAt.In(location)
+	}
+
+	v2 := &ReceiptV2{
+		Retailer:    receipt.Retailer,
+		TimeZone:    receipt.TimeZone,
+		Store:       receipt.Store,
+		PurchasedAt: purchasedAt,
+		AccountID:   accountID,
+		Items:       []ItemV2{},
+		TotalCents:  ParseCents(receipt.Total),
+
+		CanonicalRetailer: receipt.CanonicalRetailer,
+	}
+	for _, item := range receipt.Items {
+		if item.Quantity == 0 {
+			price := ParseCents(item.Price)
+			if last := len(v2.Items) - 1; last >= 0 && v2.Items[last].Description == item.ShortDescription && v2.Items[last].UnitPriceCents == price {
+				v2.Items[last].Quantity++
+				continue
+			}
+			v2.Items = append(v2.Items, ItemV2{Description: item.ShortDescription, Quantity: 1, UnitPriceCents: price, Product: item.Product})
+			continue
+		}
+		unitPrice := ParseCents(item.UnitPrice)
+		if item.UnitPrice == "" {
+			unitPrice = ParseCents(item.Price) / int64(item.Quantity)
+		}
+		v2.Items = append(v2.Items, ItemV2{Description: item.ShortDescription, Quantity: item.Quantity, UnitPriceCents: unitPrice, Product: item.Product})
+	}
+	return v2
+}
+
+// FormatCents formats an amount in cents as a v1 decimal amount, like 6.49
+func FormatCents(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// ParseCents parses a v1 decimal amount into cents, invalid amounts are zero
+func ParseCents(amount string) int64 {
+	value, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(math.Round(value * 100))
+}
@@ -0,0 +1,4 @@
+// Package receiptpb holds the gRPC service and messages generated from proto/receipt.proto.
+package receiptpb
+
+//go:generate protoc -I ../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative receipt.proto
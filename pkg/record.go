@@ -0,0 +1,71 @@
+package model
+
+import "time"
+
+// Statuses of a stored receipt
+const (
+	// StatusAccepted receipts are queued for processing
+	StatusAccepted = "accepted"
+	// StatusProcessing receipts have been claimed by a worker
+	StatusProcessing = "processing"
+	// StatusScored receipts have their points credited
+	StatusScored = "scored"
+	// StatusPendingReview receipts exceeded the risk threshold and wait for a reviewer, they are not credited
+	StatusPendingReview = "pending_review"
+	// StatusRejected receipts failed validation or review and earn no points
+	StatusRejected = "rejected"
+	// StatusReversed receipts had their credited points taken back
+	StatusReversed = "reversed"
+)
+
+// Review decisions
+const (
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+	DecisionReversed = "reversed"
+)
+
+// Review records the manual decision on a receipt held for review.
+type Review struct {
+	Decision   string    `json:"decision"`
+	Reviewer   string    `json:"reviewer"`
+	Notes      string    `json:"notes,omitempty"`
+	ReviewedAt time.Time `json:"reviewedAt"`
+}
+
+// ReceiptRecord is the stored representation of a processed receipt.
+type ReceiptRecord struct {
+	ID          string   `json:"id"`
+	Points      int      `json:"points"`
+	Status      string   `json:"status"`
+	RiskScore   int      `json:"riskScore"`
+	RiskReasons []string `json:"riskReasons,omitempty"`
+	Receipt     *Receipt `json:"receipt,omitempty"`
+	ClientID    string   `json:"clientId,omitempty"`
+	AccountID   string   `json:"accountId,omitempty"`
+	Review      *Review  `json:"review,omitempty"`
+	// Breakdown explains how the points were calculated
+	Breakdown *Breakdown `json:"breakdown,omitempty"`
+	// Reversal records who took back the points of a scored receipt and why
+	Reversal *Review `json:"reversal,omitempty"`
+	// RejectionReason explains why processing rejected the receipt
+	RejectionReason string `json:"rejectionReason,omitempty"`
+	// Attempts counts the times processing failed, RetryAt is when the receipt is tried again
+	Attempts    int        `json:"attempts,omitempty"`
+	RetryAt     *time.Time `json:"retryAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+}
+
+// Processed reports whether the receipt made it through the processing pipeline.
+func (record *ReceiptRecord) Processed() bool {
+	return record.Status != StatusAccepted && record.Status != StatusProcessing
+}
+
+// CreditedPoints returns the points the receipt earned, or zero while it is not credited.
+func (record *ReceiptRecord) CreditedPoints() int {
+	if record.Status != StatusScored {
+		return 0
+	}
+	return record.Points
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Ways a receipt's retailer name matched the registry
+const (
+	RetailerMatchName  = "name"
+	RetailerMatchAlias = "alias"
+	RetailerMatchFuzzy = "fuzzy"
+)
+
+// Retailer is a canonical retailer of the registry. Receipts naming it or one of its aliases,
+// or a close spelling of them, are credited to it.
+type Retailer struct {
+	// ID is a slug like mm-corner-market
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// RetailerMatch is the retailer of the registry a receipt was matched to on ingest.
+type RetailerMatch struct {
+	RetailerID string `json:"retailerId"`
+	// Name is the canonical name of the retailer
+	Name string `json:"name"`
+	// Match is how the receipt's retailer matched: name, alias or fuzzy
+	Match string `json:"match"`
+}
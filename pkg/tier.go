@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// Reasons of tier changes
+const (
+	// TierEnrollment is an account's first tier
+	TierEnrollment = "enrollment"
+	// TierPromotion moves an account up after its trailing points reached a higher tier
+	TierPromotion = "promotion"
+	// TierDemotion moves an account down after points earned over a year ago stopped counting
+	TierDemotion = "demotion"
+)
+
+// Tier is a membership level, accounts reach it by earning MinPoints in the trailing 12 months.
+type Tier struct {
+	Name      string `json:"name"`
+	MinPoints int    `json:"minPoints"`
+	// Multiplier multiplies the points of the account's receipts, 1.5 adds half of them as a bonus
+	Multiplier float64 `json:"multiplier"`
+}
+
+// AccountTier is the membership status of an account.
+type AccountTier struct {
+	Tier string `json:"tier"`
+	// TrailingPoints are the points earned in the 12 months before EvaluatedAt
+	TrailingPoints int       `json:"trailingPoints"`
+	Since          time.Time `json:"since"`
+	EvaluatedAt    time.Time `json:"evaluatedAt"`
+	// History lists the account's tier changes, oldest first
+	History []TierChange `json:"history"`
+}
+
+// TierChange is an enrollment, promotion or demotion of an account.
+type TierChange struct {
+	From           string    `json:"from,omitempty"`
+	To             string    `json:"to"`
+	Reason         string    `json:"reason"`
+	TrailingPoints int       `json:"trailingPoints"`
+	ChangedAt      time.Time `json:"changedAt"`
+}
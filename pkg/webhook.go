@@ -0,0 +1,69 @@
+package model
+
+import "time"
+
+// Event types delivered to webhook subscriptions
+const (
+	EventReceiptScored   = "receipt.scored"
+	EventReceiptRejected = "receipt.rejected"
+	EventPointsReversed  = "points.reversed"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription of a URL to receipt events, payloads are signed with Secret.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Subscribes reports whether the webhook receives events of the given type.
+func (webhook *Webhook) Subscribes(eventType string) bool {
+	for _, event := range webhook.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the payload posted to webhooks.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      EventData `json:"data"`
+}
+
+// EventData describes the receipt an event is about.
+type EventData struct {
+	ReceiptID string `json:"receiptId"`
+	AccountID string `json:"accountId,omitempty"`
+	Status    string `json:"status"`
+	Points    int    `json:"points"`
+}
+
+// Delivery tracks sending one event to one webhook, including every attempt.
+type Delivery struct {
+	ID            string            `json:"id"`
+	WebhookID     string            `json:"webhookId"`
+	Event         Event             `json:"event"`
+	Status        string            `json:"status"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+	NextAttemptAt time.Time         `json:"nextAttemptAt"`
+}
+
+// DeliveryAttempt is the outcome of a single POST to a webhook.
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
@@ -0,0 +1,9 @@
+// Package receiptprocessor holds the assets shipped inside the receipt processor binary.
+package receiptprocessor
+
+import _ "embed"
+
+// OpenAPISpec is the OpenAPI specification of the REST API in api.yml
+//
+//go:embed api.yml
+var OpenAPISpec []byte